@@ -0,0 +1,604 @@
+package stats
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAggregationInterval is the default interval at which an
+	// AggregatingHandler forwards the measures it aggregated.
+	DefaultAggregationInterval = 10 * time.Second
+
+	// DefaultMaxAggregatedSeries is the default limit on the number of unique
+	// name and tag sets that an AggregatingHandler tracks in a single window.
+	DefaultMaxAggregatedSeries = 10000
+)
+
+// AggregatingHandler is a measure handler which folds the measures it receives
+// over a time window before forwarding them to another handler.
+//
+// Within a window, counters are summed, gauges retain the last value that they
+// were set to, and histograms are reduced to their count, sum, min and max
+// values plus the number of observations that fell into each bucket registered
+// in Buckets. At the end of each window, the handler forwards one measure per
+// unique name and tag set it has seen.
+//
+// Sets retain the distinct values they received, and are forwarded as one field
+// per distinct value, so the handler they are forwarded to keeps counting the
+// distinct values across windows.
+//
+// Histograms of a field named "f" are forwarded as the "f.count" and "f.sum"
+// counters and the "f.min" and "f.max" gauges. When buckets were registered for
+// the histogram, the counts of observations less than or equal to the upper
+// bound of each bucket are forwarded as the "f.bucket" counter, on a measure
+// carrying an extra "le" tag set to the bound, like prometheus buckets. The
+// count of all observations is forwarded with the "le" tag set to "+Inf".
+// When Summarize is set, histograms are forwarded as the fields of the
+// summaries it creates instead (see the sketch package for an example).
+//
+// At each window, the handler also reports its own state on a measure named
+// "stats.aggregator", with the following fields:
+//
+//   - series (gauge): number of unique name and tag sets in the window
+//   - overflow (counter): number of measures which were forwarded unaggregated
+//     because MaxSeries was reached
+//   - dropped (counter): number of fields which could not be aggregated because
+//     they carried a null value
+//
+// AggregatingHandler values must not be copied after their first use.
+type AggregatingHandler struct {
+	// The handler that aggregated measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler Handler
+
+	// Length of the aggregation windows. If zero, DefaultAggregationInterval
+	// is used. When negative, no background flushing is done and the program
+	// is responsible for calling Flush to end the aggregation windows.
+	Interval time.Duration
+
+	// Maximum number of unique name and tag sets aggregated within a window.
+	// Once this limit is reached, measures for new series are forwarded to
+	// the handler as-is. If zero, DefaultMaxAggregatedSeries is used.
+	MaxSeries int
+
+	// Buckets is the registry of histogram buckets used by the handler,
+	// If nil, stats.Buckets is used instead.
+	Buckets HistogramBuckets
+
+	// Summarize, if not nil, is called to create the summary of each histogram
+	// field of a window, which then replaces the count, sum, min, max and
+	// bucket fields of the histogram. The function receives the key of the
+	// histogram and its first value in the window.
+	Summarize func(key Key, first Value) HistogramSummary
+
+	once   sync.Once
+	mutex  sync.RWMutex
+	series map[string]*aggregate
+	done   chan struct{}
+	join   chan struct{}
+	closed uint32
+
+	overflow uint64
+	dropped  uint64
+}
+
+// HistogramSummary is the interface implemented by the summaries of histogram
+// fields created by the Summarize function of an AggregatingHandler.
+type HistogramSummary interface {
+	// Add adds the value x to the summary, weighted by the inverse of its
+	// sample rate. Durations are passed in seconds.
+	Add(x, weight float64)
+
+	// AppendFields appends the fields forwarded at the end of the window for
+	// the histogram field named name.
+	AppendFields(fields []Field, name string) []Field
+}
+
+// NewAggregatingHandler returns a new AggregatingHandler which forwards the
+// measures it aggregates to handler at the given interval.
+func NewAggregatingHandler(handler Handler, interval time.Duration) *AggregatingHandler {
+	return &AggregatingHandler{
+		Handler:  handler,
+		Interval: interval,
+	}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *AggregatingHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	h.once.Do(h.start)
+
+	if atomic.LoadUint32(&h.closed) != 0 {
+		return
+	}
+
+	kb := aggregateKeyPool.Get().(*aggregateKey)
+	maxSeries := h.maxSeries()
+
+	for i := range measures {
+		m := &measures[i]
+		kb.b = appendAggregateKey(kb.b[:0], m)
+
+		if !h.aggregate(kb.b, m, maxSeries) {
+			atomic.AddUint64(&h.overflow, 1)
+			h.Handler.HandleMeasures(t, *m)
+		}
+	}
+
+	aggregateKeyPool.Put(kb)
+}
+
+// aggregate folds m into the series identified by key, and returns false if m
+// must be forwarded unaggregated because the series limit was reached.
+func (h *AggregatingHandler) aggregate(key []byte, m *Measure, maxSeries int) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for {
+		// The closed flag is checked under the lock, so measures handled
+		// concurrently with Close are either part of the last window or
+		// dropped.
+		if atomic.LoadUint32(&h.closed) != 0 {
+			return true
+		}
+
+		if a := h.series[string(key)]; a != nil {
+			// The read lock is held while updating the aggregate so a
+			// concurrent call to Flush cannot forward the window before the
+			// update completed.
+			a.update(h, m.Fields, m.SampleRate)
+			return true
+		}
+
+		if len(h.series) >= maxSeries {
+			return false
+		}
+
+		// The series is created under the write lock, then looked up again
+		// since the window may have been flushed in between.
+		h.mutex.RUnlock()
+		h.mutex.Lock()
+		if h.series[string(key)] == nil && len(h.series) < maxSeries {
+			h.series[string(key)] = newAggregate(m)
+		}
+		h.mutex.Unlock()
+		h.mutex.RLock()
+	}
+}
+
+// Flush forwards the measures aggregated in the current window to the handler,
+// then flushes it. Flush satisfies the Flusher interface.
+func (h *AggregatingHandler) Flush() {
+	h.once.Do(h.start)
+	h.flush(time.Now())
+}
+
+// Close stops the background flushing of the handler, forwards the last
+// aggregation window, then closes the handler it wraps. Close satisfies the
+// Closer interface.
+//
+// Measures passed to HandleMeasures after Close was called are dropped without
+// being reported on the "stats.aggregator" measure, since the handler that it
+// would be forwarded to is closed.
+func (h *AggregatingHandler) Close() error {
+	h.once.Do(h.start)
+
+	if !atomic.CompareAndSwapUint32(&h.closed, 0, 1) {
+		return nil
+	}
+
+	if h.done != nil {
+		close(h.done)
+		<-h.join
+	}
+
+	h.forward(time.Now())
+	return closeHandler(h.Handler)
+}
+
+func (h *AggregatingHandler) start() {
+	h.series = make(map[string]*aggregate)
+
+	interval := h.interval()
+	if interval < 0 {
+		return
+	}
+
+	h.done = make(chan struct{})
+	h.join = make(chan struct{})
+
+	go func() {
+		defer close(h.join)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				h.flush(now)
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+func (h *AggregatingHandler) flush(now time.Time) {
+	h.forward(now)
+	flush(h.Handler)
+}
+
+// forward passes the measures aggregated in the current window to the handler.
+func (h *AggregatingHandler) forward(now time.Time) {
+	h.mutex.Lock()
+	series := h.series
+	if len(series) != 0 {
+		h.series = make(map[string]*aggregate, len(series))
+	}
+	h.mutex.Unlock()
+
+	overflow := atomic.SwapUint64(&h.overflow, 0)
+	dropped := atomic.SwapUint64(&h.dropped, 0)
+
+	if len(series) != 0 || overflow != 0 || dropped != 0 {
+		measures := make([]Measure, 0, len(series)+1)
+
+		for _, a := range series {
+			measures = a.appendMeasures(measures)
+		}
+
+		measures = append(measures, Measure{
+			Name: "stats.aggregator",
+			Fields: []Field{
+				MakeField("series", len(series), Gauge),
+				MakeField("overflow", overflow, Counter),
+				MakeField("dropped", dropped, Counter),
+			},
+		})
+
+		h.Handler.HandleMeasures(now, measures...)
+	}
+}
+
+func (h *AggregatingHandler) interval() time.Duration {
+	if h.Interval != 0 {
+		return h.Interval
+	}
+	return DefaultAggregationInterval
+}
+
+func (h *AggregatingHandler) maxSeries() int {
+	if h.MaxSeries != 0 {
+		return h.MaxSeries
+	}
+	return DefaultMaxAggregatedSeries
+}
+
+func (h *AggregatingHandler) buckets() HistogramBuckets {
+	if h.Buckets != nil {
+		return h.Buckets
+	}
+	return Buckets
+}
+
+type aggregate struct {
+	mutex  sync.Mutex
+	name   string
+	tags   []Tag
+	fields []aggregateField
+}
+
+func newAggregate(m *Measure) *aggregate {
+	return &aggregate{
+		name: m.Name,
+		tags: copyTags(m.Tags),
+	}
+}
+
+func (a *aggregate) update(h *AggregatingHandler, fields []Field, rate float64) {
+	// Sampled measures are weighted by the inverse of their sample rate so the
+	// aggregated values account for the measures that were dropped.
+	weight := 1.0
+	if rate > 0 && rate < 1 {
+		weight = 1 / rate
+	}
+
+	a.mutex.Lock()
+
+	for _, f := range fields {
+		if f.Value.Type() == Null {
+			atomic.AddUint64(&h.dropped, 1)
+			continue
+		}
+		a.lookup(h, f).update(f.Value, weight)
+	}
+
+	a.mutex.Unlock()
+}
+
+func (a *aggregate) lookup(h *AggregatingHandler, f Field) *aggregateField {
+	ftype := f.Type()
+
+	for i := range a.fields {
+		if af := &a.fields[i]; af.name == f.Name && af.ftype == ftype {
+			return af
+		}
+	}
+
+	af := aggregateField{name: f.Name, ftype: ftype}
+
+	if ftype == Histogram {
+		key := Key{Measure: a.name, Field: f.Name}
+
+		if h.Summarize != nil {
+			af.summary = h.Summarize(key, f.Value)
+		} else {
+			af.buckets = h.buckets()[key]
+			af.counts = make([]float64, len(af.buckets))
+		}
+	}
+
+	a.fields = append(a.fields, af)
+	return &a.fields[len(a.fields)-1]
+}
+
+func (a *aggregate) appendMeasures(measures []Measure) []Measure {
+	fields := make([]Field, 0, 4*len(a.fields))
+
+	for i := range a.fields {
+		fields = a.fields[i].appendFields(fields)
+	}
+
+	measures = append(measures, Measure{
+		Name:   a.name,
+		Fields: fields,
+		Tags:   a.tags,
+	})
+
+	for i := range a.fields {
+		af := &a.fields[i]
+
+		if len(af.buckets) == 0 {
+			continue
+		}
+
+		// Like prometheus buckets, the counts are cumulative, and the last
+		// bucket counts all the observations.
+		count := 0.0
+
+		for j, limit := range af.buckets {
+			if count += af.counts[j]; count == 0 {
+				continue
+			}
+			measures = a.appendBucket(measures, af.name, formatBucket(limit), count)
+		}
+
+		if last := af.buckets[len(af.buckets)-1]; !math.IsInf(valueFloat(last), +1) {
+			measures = a.appendBucket(measures, af.name, "+Inf", af.count)
+		}
+	}
+
+	return measures
+}
+
+func (a *aggregate) appendBucket(measures []Measure, name, le string, count float64) []Measure {
+	return append(measures, Measure{
+		Name:   a.name,
+		Fields: []Field{MakeField(name+".bucket", roundCount(count), Counter)},
+		Tags:   mergeTags(a.tags, []Tag{{Name: "le", Value: le}}),
+	})
+}
+
+type aggregateField struct {
+	name    string
+	ftype   FieldType
+	value   Value
+	count   float64
+	sum     weightedSum
+	min     Value
+	max     Value
+	buckets []Value
+	counts  []float64
+	members map[Value]struct{}
+	order   []Value
+	summary HistogramSummary
+}
+
+func (f *aggregateField) update(v Value, weight float64) {
+	switch f.ftype {
+	case Counter:
+		f.sum.add(v, weight)
+
+	case Gauge:
+		f.value = v
+
+	case Distinct:
+		if f.members == nil {
+			f.members = make(map[Value]struct{})
+		}
+		if _, ok := f.members[v]; !ok {
+			f.members[v] = struct{}{}
+			f.order = append(f.order, v)
+		}
+
+	default:
+		x := valueFloat(v)
+
+		if f.summary != nil {
+			f.summary.Add(x, weight)
+			return
+		}
+
+		if f.count == 0 {
+			f.min, f.max = v, v
+		} else {
+			if x < valueFloat(f.min) {
+				f.min = v
+			}
+			if x > valueFloat(f.max) {
+				f.max = v
+			}
+		}
+
+		for i, limit := range f.buckets {
+			if x <= valueFloat(limit) {
+				f.counts[i] += weight
+				break
+			}
+		}
+
+		f.sum.add(v, weight)
+		f.count += weight
+	}
+}
+
+func (f *aggregateField) appendFields(fields []Field) []Field {
+	switch f.ftype {
+	case Counter:
+		fields = append(fields, Field{Name: f.name, Value: f.sum.value()})
+		fields[len(fields)-1].setType(Counter)
+
+	case Gauge:
+		fields = append(fields, Field{Name: f.name, Value: f.value})
+		fields[len(fields)-1].setType(Gauge)
+
+	case Distinct:
+		for _, v := range f.order {
+			fields = append(fields, makeField(f.name, v, Distinct))
+		}
+
+	default:
+		if f.summary != nil {
+			return f.summary.AppendFields(fields, f.name)
+		}
+		fields = append(fields,
+			MakeField(f.name+".count", roundCount(f.count), Counter),
+			MakeField(f.name+".sum", f.sum.value(), Counter),
+			MakeField(f.name+".min", f.min, Gauge),
+			MakeField(f.name+".max", f.max, Gauge),
+		)
+	}
+	return fields
+}
+
+// addValues returns the sum of v1 and v2, using the type of v2 unless v1 is
+// the zero value.
+func addValues(v1, v2 Value) Value {
+	if v1.Type() == Null {
+		if v2.Type() == Bool {
+			return uint64Value(v2.bits)
+		}
+		return v2
+	}
+
+	switch t1, t2 := v1.Type(), v2.Type(); {
+	case t1 == Int && t2 == Int:
+		return int64Value(v1.Int() + v2.Int())
+	case t1 == Uint && (t2 == Uint || t2 == Bool):
+		return uint64Value(v1.Uint() + v2.bits)
+	case t1 == Duration && t2 == Duration:
+		return durationValue(v1.Duration() + v2.Duration())
+	default:
+		return float64Value(valueFloat(v1) + valueFloat(v2))
+	}
+}
+
+// weightedSum is a sum of values weighted by the inverse of their sample rate.
+// Weighted values are accumulated as floats and only rounded to the type of
+// the values when the sum is read, so the rounding errors of the individual
+// values don't add up.
+type weightedSum struct {
+	exact    Value
+	weighted float64
+	wtype    Type
+}
+
+func (s *weightedSum) add(v Value, weight float64) {
+	if weight == 1 {
+		s.exact = addValues(s.exact, v)
+		return
+	}
+
+	// Values of different types are summed as floats.
+	switch t := v.Type(); {
+	case s.wtype == Null:
+		s.wtype = t
+	case s.wtype != t:
+		s.wtype = Float
+	}
+
+	s.weighted += valueFloat(v) * weight
+}
+
+func (s *weightedSum) value() Value {
+	if s.wtype == Null {
+		return s.exact
+	}
+
+	var v Value
+	switch s.wtype {
+	case Int:
+		v = int64Value(int64(math.Round(s.weighted)))
+	case Uint:
+		v = uint64Value(uint64(math.Round(s.weighted)))
+	case Duration:
+		v = durationValue(time.Duration(math.Round(s.weighted * float64(time.Second))))
+	default:
+		v = float64Value(s.weighted)
+	}
+	return addValues(s.exact, v)
+}
+
+func roundCount(count float64) uint64 {
+	return uint64(math.Round(count))
+}
+
+// valueFloat returns a float64 representation of v, durations are expressed in
+// seconds.
+func valueFloat(v Value) float64 {
+	switch v.Type() {
+	case Bool:
+		if v.Bool() {
+			return 1.0
+		}
+	case Int:
+		return float64(v.Int())
+	case Uint:
+		return float64(v.Uint())
+	case Float:
+		return v.Float()
+	case Duration:
+		return v.Duration().Seconds()
+	}
+	return 0.0
+}
+
+func formatBucket(v Value) string {
+	return strconv.FormatFloat(valueFloat(v), 'g', -1, 64)
+}
+
+type aggregateKey struct {
+	b []byte
+}
+
+var aggregateKeyPool = sync.Pool{
+	New: func() interface{} { return &aggregateKey{b: make([]byte, 0, 256)} },
+}
+
+func appendAggregateKey(b []byte, m *Measure) []byte {
+	b = append(b, m.Name...)
+
+	for _, t := range m.Tags {
+		b = append(b, 0)
+		b = append(b, t.Name...)
+		b = append(b, 0)
+		b = append(b, t.Value...)
+	}
+
+	return b
+}
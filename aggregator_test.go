@@ -0,0 +1,245 @@
+package stats_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestAggregatingHandler(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	t.Run("counters are summed and gauges keep the last value", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AggregatingHandler{Handler: h, Interval: -1}
+		e := stats.NewEngine("test", a)
+
+		for i := 0; i != 10; i++ {
+			e.Incr("requests.count", stats.T("status", "ok"))
+			e.Set("requests.pending", i, stats.T("status", "ok"))
+		}
+		e.Incr("requests.count", stats.T("status", "error"))
+
+		assert.Empty(t, h.Measures())
+		a.Flush()
+
+		measures := h.Measures()
+		assert.Equal(t, 1, h.FlushCalls())
+		assert.Contains(t, measures, stats.Measure{
+			Name: "test.requests",
+			Fields: []stats.Field{
+				stats.MakeField("count", 10, stats.Counter),
+				stats.MakeField("pending", 9, stats.Gauge),
+			},
+			Tags: []stats.Tag{stats.T("status", "ok")},
+		})
+		assert.Contains(t, measures, stats.Measure{
+			Name:   "test.requests",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("status", "error")},
+		})
+		assert.Contains(t, measures, stats.Measure{
+			Name: "stats.aggregator",
+			Fields: []stats.Field{
+				stats.MakeField("series", 2, stats.Gauge),
+				stats.MakeField("overflow", uint64(0), stats.Counter),
+				stats.MakeField("dropped", uint64(0), stats.Counter),
+			},
+		})
+
+		h.Clear()
+		a.Flush()
+		assert.Empty(t, h.Measures(), "empty windows must not produce measures")
+	})
+
+	t.Run("sets forward their distinct values", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AggregatingHandler{Handler: h, Interval: -1}
+		e := stats.NewEngine("test", a)
+
+		for _, user := range []string{"alice", "bob", "alice", "carol", "bob"} {
+			e.Unique("users", user)
+		}
+		a.Flush()
+
+		assert.Contains(t, h.Measures(), stats.Measure{
+			Name: "test",
+			Fields: []stats.Field{
+				stats.MakeField("users", stats.HashValue("alice"), stats.Distinct),
+				stats.MakeField("users", stats.HashValue("bob"), stats.Distinct),
+				stats.MakeField("users", stats.HashValue("carol"), stats.Distinct),
+			},
+		})
+	})
+
+	t.Run("histograms are reduced to count, sum, min, max and cumulative buckets", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AggregatingHandler{
+			Handler:  h,
+			Interval: -1,
+			Buckets: stats.HistogramBuckets{
+				{Measure: "rpc", Field: "rtt"}: {
+					stats.ValueOf(10 * time.Millisecond),
+					stats.ValueOf(100 * time.Millisecond),
+				},
+			},
+		}
+		e := stats.NewEngine("", a)
+
+		e.Observe("rpc.rtt", 5*time.Millisecond)
+		e.Observe("rpc.rtt", 50*time.Millisecond)
+		e.Observe("rpc.rtt", 20*time.Millisecond)
+		e.Observe("rpc.rtt", time.Second)
+		a.Flush()
+
+		measures := h.Measures()
+		assert.Contains(t, measures, stats.Measure{
+			Name: "rpc",
+			Fields: []stats.Field{
+				stats.MakeField("rtt.count", uint64(4), stats.Counter),
+				stats.MakeField("rtt.sum", 1075*time.Millisecond, stats.Counter),
+				stats.MakeField("rtt.min", 5*time.Millisecond, stats.Gauge),
+				stats.MakeField("rtt.max", time.Second, stats.Gauge),
+			},
+		})
+		assert.Contains(t, measures, stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("rtt.bucket", uint64(1), stats.Counter)},
+			Tags:   []stats.Tag{stats.T("le", "0.01")},
+		})
+		assert.Contains(t, measures, stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("rtt.bucket", uint64(3), stats.Counter)},
+			Tags:   []stats.Tag{stats.T("le", "0.1")},
+		})
+		assert.Contains(t, measures, stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("rtt.bucket", uint64(4), stats.Counter)},
+			Tags:   []stats.Tag{stats.T("le", "+Inf")},
+		})
+	})
+
+	t.Run("sampled counters are rounded once per window", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AggregatingHandler{Handler: h, Interval: -1}
+
+		// Each increment accounts for 1/0.3 = 3.33 calls, rounding them
+		// individually would report 30 calls instead of 33.
+		for i := 0; i != 10; i++ {
+			a.HandleMeasures(time.Time{}, stats.Measure{
+				Name:       "rpc",
+				Fields:     []stats.Field{stats.MakeField("calls", 1, stats.Counter)},
+				SampleRate: 0.3,
+			})
+		}
+		a.HandleMeasures(time.Time{}, stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("calls", 1, stats.Counter)},
+		})
+		a.Flush()
+
+		assert.Contains(t, h.Measures(), stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("calls", 34, stats.Counter)},
+		})
+	})
+
+	t.Run("series over the limit are forwarded unaggregated", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AggregatingHandler{Handler: h, Interval: -1, MaxSeries: 1}
+		e := stats.NewEngine("", a)
+
+		e.Incr("calls", stats.T("id", "1"))
+		e.Incr("calls", stats.T("id", "2"))
+		e.Incr("calls", stats.T("id", "1"))
+
+		assert.Equal(t, []stats.Measure{{
+			Fields: []stats.Field{stats.MakeField("calls", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("id", "2")},
+		}}, h.Measures())
+
+		a.Flush()
+		assert.Contains(t, h.Measures(), stats.Measure{
+			Name: "stats.aggregator",
+			Fields: []stats.Field{
+				stats.MakeField("series", 1, stats.Gauge),
+				stats.MakeField("overflow", uint64(1), stats.Counter),
+				stats.MakeField("dropped", uint64(0), stats.Counter),
+			},
+		})
+	})
+
+	t.Run("closing the handler forwards the last window and drops later measures", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := stats.NewAggregatingHandler(h, time.Hour)
+		e := stats.NewEngine("", a)
+
+		e.Incr("calls")
+		assert.NoError(t, a.Close())
+		assert.Len(t, h.Measures(), 2)
+
+		h.Clear()
+		e.Incr("calls")
+		a.Flush()
+		assert.Empty(t, h.Measures())
+	})
+}
+
+func TestAggregatingHandlerConcurrentClose(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	a := &stats.AggregatingHandler{Handler: h, Interval: -1}
+	e := stats.NewEngine("", a)
+
+	const goroutines, calls = 8, 10000
+	wg := sync.WaitGroup{}
+
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range calls {
+				e.Incr("calls")
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, a.Close())
+	wg.Wait()
+
+	// The measures handled after Close are dropped, nothing is forwarded by
+	// later flushes.
+	n := len(h.Measures())
+	a.Flush()
+	assert.Len(t, h.Measures(), n)
+
+	// Calls are either part of the last window or dropped, they are never
+	// counted twice.
+	total := 0
+	for _, m := range h.Select("calls") {
+		total += int(m.Value.Int())
+	}
+	assert.LessOrEqual(t, total, goroutines*calls)
+}
+
+func BenchmarkAggregatingHandler(b *testing.B) {
+	a := &stats.AggregatingHandler{Handler: stats.Discard, Interval: -1}
+	e := stats.NewEngine("test", a, stats.T("service", "test-service"))
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.Incr("calls", stats.T("status", "ok"))
+		}
+	})
+}
@@ -0,0 +1,337 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAsyncQueueSize is the default number of measures that an
+	// AsyncHandler can hold in its queue.
+	DefaultAsyncQueueSize = 8192
+
+	// DefaultAsyncBatchSize is the default maximum number of measures that the
+	// workers of an AsyncHandler pass to the handler it wraps in one call.
+	DefaultAsyncBatchSize = 256
+)
+
+// QueuePolicy is an enumeration of the actions that an AsyncHandler can take
+// when its queue is full.
+type QueuePolicy int
+
+const (
+	// DropNewest drops the measures that don't fit in the queue.
+	DropNewest QueuePolicy = iota
+
+	// DropOldest evicts the oldest measures of the queue to make room for the
+	// new ones.
+	DropOldest
+
+	// Block blocks the caller of HandleMeasures until there is room in the
+	// queue.
+	Block
+)
+
+func (p QueuePolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// AsyncHandler is a measure handler which decouples the goroutines producing
+// measures from the handler that they are forwarded to.
+//
+// HandleMeasures copies the measures into a bounded queue and returns
+// immediately (unless Policy is Block and the queue is full). The queue is
+// drained by worker goroutines which forward the measures to the wrapped
+// handler, so a slow backend doesn't add latency to the program. When more
+// than one worker is configured, the order in which measures are forwarded is
+// not guaranteed.
+//
+// The handler reports its queue depth and the number of measures it dropped on
+// a measure named "stats.async", which is forwarded to the wrapped handler when
+// it is flushed, and at most every few seconds while measures are handled.
+//
+// The program must call Close to drain the queue and stop the workers.
+type AsyncHandler struct {
+	// The handler that measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler Handler
+
+	// Maximum number of measures held in the queue. If zero,
+	// DefaultAsyncQueueSize is used.
+	QueueSize int
+
+	// Maximum number of measures forwarded to Handler in one call. If zero,
+	// DefaultAsyncBatchSize is used.
+	BatchSize int
+
+	// Number of goroutines draining the queue, one if zero.
+	Workers int
+
+	// Action taken when the queue is full, DropNewest by default.
+	Policy QueuePolicy
+
+	once     sync.Once
+	join     sync.WaitGroup
+	mutex    sync.Mutex
+	notEmpty sync.Cond
+	notFull  sync.Cond
+	drained  sync.Cond
+	closed   bool
+
+	// Ring buffer of queued measures.
+	queue []asyncEntry
+	head  int
+	size  int
+
+	// Number of measures ever pushed to the queue, and number of measures that
+	// were forwarded or evicted from the queue. Flush waits for the latter to
+	// catch up with the former.
+	pushed  uint64
+	handled uint64
+
+	dropped    uint64
+	reportTime time.Time
+}
+
+// NewAsyncHandler returns a new AsyncHandler which forwards measures to
+// handler, queuing up to size measures and applying policy when the queue is
+// full.
+func NewAsyncHandler(handler Handler, size int, policy QueuePolicy) *AsyncHandler {
+	return &AsyncHandler{
+		Handler:   handler,
+		QueueSize: size,
+		Policy:    policy,
+	}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *AsyncHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	if len(measures) == 0 {
+		return
+	}
+
+	h.init()
+	h.mutex.Lock()
+
+	for i := range measures {
+		for h.size == len(h.queue) && h.Policy == Block && !h.closed {
+			// The measures queued by this call so far must be picked up by the
+			// workers for the queue to have free slots.
+			h.notEmpty.Signal()
+			h.notFull.Wait()
+		}
+
+		if h.closed {
+			h.dropped += uint64(len(measures) - i)
+			break
+		}
+
+		if h.size == len(h.queue) {
+			if h.Policy != DropOldest {
+				h.dropped++
+				continue
+			}
+			h.queue[h.head] = asyncEntry{}
+			h.head = (h.head + 1) % len(h.queue)
+			h.size--
+			h.handled++
+			h.dropped++
+		}
+
+		h.queue[(h.head+h.size)%len(h.queue)] = asyncEntry{time: t, measure: measures[i].Clone()}
+		h.size++
+		h.pushed++
+	}
+
+	h.notEmpty.Signal()
+
+	if h.Policy == DropOldest {
+		// Evicted measures count as handled, Flush may be waiting on them.
+		h.drained.Broadcast()
+	}
+
+	h.mutex.Unlock()
+}
+
+// Flush waits for the measures queued before the call to be forwarded, then
+// flushes the wrapped handler. Flush satisfies the Flusher interface.
+func (h *AsyncHandler) Flush() {
+	h.drain()
+	h.report(time.Now())
+	flush(h.Handler)
+}
+
+// drain waits for the measures queued before the call to be forwarded.
+func (h *AsyncHandler) drain() {
+	h.init()
+	h.mutex.Lock()
+
+	for pushed := h.pushed; h.handled < pushed; {
+		h.drained.Wait()
+	}
+
+	h.mutex.Unlock()
+}
+
+// Close drains the queue, stops the workers, and closes the wrapped handler.
+// Measures passed to HandleMeasures after Close was called are dropped.
+func (h *AsyncHandler) Close() error {
+	h.init()
+	h.mutex.Lock()
+	closed := h.closed
+	h.closed = true
+	h.notEmpty.Broadcast()
+	h.notFull.Broadcast()
+	h.mutex.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	h.join.Wait()
+	h.report(time.Now())
+	return closeHandler(h.Handler)
+}
+
+func (h *AsyncHandler) init() {
+	h.once.Do(func() {
+		h.notEmpty.L = &h.mutex
+		h.notFull.L = &h.mutex
+		h.drained.L = &h.mutex
+		h.queue = make([]asyncEntry, h.queueSize())
+		h.reportTime = time.Now()
+
+		for i := h.workers(); i != 0; i-- {
+			h.join.Add(1)
+			go h.run()
+		}
+	})
+}
+
+func (h *AsyncHandler) run() {
+	defer h.join.Done()
+
+	batch := make([]Measure, 0, h.batchSize())
+	var t time.Time
+	var ok bool
+
+	for {
+		if t, batch, ok = h.dequeue(batch[:0]); !ok {
+			return
+		}
+
+		h.Handler.HandleMeasures(t, batch...)
+
+		for i := range batch {
+			batch[i] = Measure{}
+		}
+
+		if h.complete(len(batch)) {
+			h.report(time.Now())
+		}
+	}
+}
+
+// dequeue removes from the queue a run of measures sharing the same time, and
+// appends them to batch. It blocks until the queue is not empty, and returns
+// false if the handler was closed and the queue was drained.
+func (h *AsyncHandler) dequeue(batch []Measure) (time.Time, []Measure, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for h.size == 0 && !h.closed {
+		h.notEmpty.Wait()
+	}
+
+	if h.size == 0 {
+		return time.Time{}, batch, false
+	}
+
+	t := h.queue[h.head].time
+
+	for h.size != 0 && len(batch) < cap(batch) {
+		e := &h.queue[h.head]
+		if !e.time.Equal(t) {
+			break
+		}
+		batch = append(batch, e.measure)
+		*e = asyncEntry{}
+		h.head = (h.head + 1) % len(h.queue)
+		h.size--
+	}
+
+	if h.size != 0 {
+		// Let other workers pick up the remaining measures.
+		h.notEmpty.Signal()
+	}
+
+	h.notFull.Broadcast()
+	return t, batch, true
+}
+
+// complete marks n measures as forwarded, it returns true if the self-metrics
+// of the handler are due to be reported.
+func (h *AsyncHandler) complete(n int) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.handled += uint64(n)
+	h.drained.Broadcast()
+
+	return time.Since(h.reportTime) >= asyncReportInterval
+}
+
+func (h *AsyncHandler) report(now time.Time) {
+	h.mutex.Lock()
+	queued := h.size
+	dropped := h.dropped
+	h.dropped = 0
+	h.reportTime = now
+	h.mutex.Unlock()
+
+	h.Handler.HandleMeasures(now, Measure{
+		Name: "stats.async",
+		Fields: []Field{
+			MakeField("queued", queued, Gauge),
+			MakeField("dropped", dropped, Counter),
+		},
+	})
+}
+
+func (h *AsyncHandler) queueSize() int {
+	if h.QueueSize > 0 {
+		return h.QueueSize
+	}
+	return DefaultAsyncQueueSize
+}
+
+func (h *AsyncHandler) batchSize() int {
+	if h.BatchSize > 0 {
+		return h.BatchSize
+	}
+	return DefaultAsyncBatchSize
+}
+
+func (h *AsyncHandler) workers() int {
+	if h.Workers > 0 {
+		return h.Workers
+	}
+	return 1
+}
+
+const asyncReportInterval = 10 * time.Second
+
+type asyncEntry struct {
+	time    time.Time
+	measure Measure
+}
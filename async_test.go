@@ -0,0 +1,199 @@
+package stats_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestAsyncHandler(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	t.Run("flush waits for queued measures to be forwarded", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := &stats.AsyncHandler{Handler: h, Workers: 4}
+		defer a.Close()
+		e := stats.NewEngine("", a)
+
+		for i := 0; i != 100; i++ {
+			e.Incr("calls.count")
+		}
+
+		a.Flush()
+		assert.Len(t, h.Measures(), 101)
+		assert.Equal(t, 1, h.FlushCalls())
+		assert.Contains(t, h.Measures(), stats.Measure{
+			Name: "stats.async",
+			Fields: []stats.Field{
+				stats.MakeField("queued", 0, stats.Gauge),
+				stats.MakeField("dropped", uint64(0), stats.Counter),
+			},
+		})
+	})
+
+	for _, test := range []struct {
+		policy stats.QueuePolicy
+		values []int
+	}{
+		{policy: stats.DropNewest, values: []int{0, 1, 2}},
+		{policy: stats.DropOldest, values: []int{0, 2, 3}},
+	} {
+		t.Run("full queues are handled with the "+test.policy.String()+" policy", func(t *testing.T) {
+			h := &gateHandler{entered: make(chan struct{}, 1), release: make(chan struct{})}
+			a := stats.NewAsyncHandler(h, 2, test.policy)
+			defer a.Close()
+			e := stats.NewEngine("", a)
+
+			e.Set("value", 0)
+			<-h.entered // the worker holds the first measure
+			e.Set("value", 1)
+			e.Set("value", 2)
+			e.Set("value", 3)
+			close(h.release)
+			a.Flush()
+
+			assert.Equal(t, test.values, h.values())
+			assert.Equal(t, uint64(1), h.dropped())
+		})
+	}
+
+	t.Run("full queues block the caller with the block policy", func(t *testing.T) {
+		h := &gateHandler{entered: make(chan struct{}, 1), release: make(chan struct{})}
+		a := stats.NewAsyncHandler(h, 1, stats.Block)
+		defer a.Close()
+		e := stats.NewEngine("", a)
+
+		e.Set("value", 0)
+		<-h.entered
+		e.Set("value", 1)
+
+		done := make(chan struct{})
+		go func() {
+			e.Set("value", 2)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("the caller was not blocked by the full queue")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		close(h.release)
+		<-done
+		a.Flush()
+
+		assert.Equal(t, []int{0, 1, 2}, h.values())
+		assert.Equal(t, uint64(0), h.dropped())
+	})
+
+	t.Run("batches larger than the queue don't block forever with the block policy", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := stats.NewAsyncHandler(h, 2, stats.Block)
+		defer a.Close()
+
+		measures := make([]stats.Measure, 5)
+		for i := range measures {
+			measures[i] = stats.Measure{Name: "value", Fields: []stats.Field{stats.MakeField("", i, stats.Gauge)}}
+		}
+
+		done := make(chan struct{})
+		go func() {
+			a.HandleMeasures(time.Now(), measures...)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the caller was blocked by a batch larger than the queue")
+		}
+
+		a.Flush()
+		assert.Len(t, measuresNamed(h.Measures(), "value"), 5)
+	})
+
+	t.Run("closing the handler drains the queue and drops later measures", func(t *testing.T) {
+		h := &statstest.Handler{}
+		a := stats.NewAsyncHandler(h, 0, stats.DropNewest)
+		e := stats.NewEngine("", a)
+
+		e.Incr("calls.count")
+		assert.NoError(t, a.Close())
+		assert.Len(t, h.Measures(), 2)
+
+		h.Clear()
+		e.Incr("calls.count")
+		a.Flush()
+		assert.Equal(t, []stats.Measure{{
+			Name: "stats.async",
+			Fields: []stats.Field{
+				stats.MakeField("queued", 0, stats.Gauge),
+				stats.MakeField("dropped", uint64(1), stats.Counter),
+			},
+		}}, h.Measures())
+	})
+}
+
+// gateHandler blocks the first call to HandleMeasures until release is closed.
+type gateHandler struct {
+	entered chan struct{}
+	release chan struct{}
+	mutex   sync.Mutex
+	handled []stats.Measure
+}
+
+func (h *gateHandler) HandleMeasures(_ time.Time, measures ...stats.Measure) {
+	select {
+	case h.entered <- struct{}{}:
+		<-h.release
+	default:
+	}
+
+	h.mutex.Lock()
+	for _, m := range measures {
+		h.handled = append(h.handled, m.Clone())
+	}
+	h.mutex.Unlock()
+}
+
+func (h *gateHandler) values() (values []int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, m := range h.handled {
+		if m.Name != "stats.async" {
+			values = append(values, int(m.Fields[0].Value.Int()))
+		}
+	}
+	return values
+}
+
+func (h *gateHandler) dropped() (n uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, m := range h.handled {
+		if m.Name == "stats.async" {
+			n += m.Fields[1].Value.Uint()
+		}
+	}
+	return n
+}
+
+func BenchmarkAsyncHandler(b *testing.B) {
+	a := &stats.AsyncHandler{Handler: stats.Discard}
+	defer a.Close()
+	e := stats.NewEngine("test", a, stats.T("service", "test-service"))
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.Incr("calls", stats.T("status", "ok"))
+		}
+	})
+}
@@ -13,13 +13,20 @@ type HistogramBuckets map[Key][]Value
 
 // Set sets a set of buckets to the given list of sorted values.
 func (b HistogramBuckets) Set(key string, buckets ...interface{}) {
+	b.SetKey(makeKey(key), buckets...)
+}
+
+// SetKey sets a set of buckets to the given list of sorted values, for the
+// metric identified by key. Unlike Set, it supports field names containing
+// dots.
+func (b HistogramBuckets) SetKey(key Key, buckets ...interface{}) {
 	v := make([]Value, len(buckets))
 
 	for i, b := range buckets {
 		v[i] = MustValueOf(ValueOf(b))
 	}
 
-	b[makeKey(key)] = v
+	b[key] = v
 }
 
 // Buckets is a registry where histogram buckets are placed. Some metric
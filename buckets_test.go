@@ -0,0 +1,21 @@
+package stats_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	buckets := stats.HistogramBuckets{}
+
+	buckets.Set("http.message:header.size", 1, 2)
+	buckets.SetKey(stats.Key{Measure: "http", Field: "rtt.seconds"}, 0.1, 1)
+
+	assert.Equal(t, stats.HistogramBuckets{
+		{Measure: "http.message:header", Field: "size"}: {stats.ValueOf(1), stats.ValueOf(2)},
+		{Measure: "http", Field: "rtt.seconds"}:         {stats.ValueOf(0.1), stats.ValueOf(1)},
+	}, buckets)
+}
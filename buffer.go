@@ -33,9 +33,20 @@ type Buffer struct {
 	// This field cannot be nil.
 	Serializer Serializer
 
+	// Interval at which the buffer is flushed in the background, so measures
+	// don't wait indefinitely for the buffer to fill up on programs producing
+	// few metrics. If zero, background flushing is disabled.
+	//
+	// When set, the program must call Close to stop the background flusher.
+	FlushInterval time.Duration
+
 	once    sync.Once
 	offset  uint64
 	buffers []buffer
+
+	closeOnce sync.Once
+	done      chan struct{}
+	join      chan struct{}
 }
 
 // HandleMeasures satisfies the Handler interface.
@@ -71,21 +82,61 @@ func (b *Buffer) Flush() {
 
 	for i := range b.buffers {
 		if buffer := &b.buffers[i]; buffer.acquire() {
-			buffer.flush(b.Serializer, buffer.len())
+			if n := buffer.len(); n != 0 {
+				buffer.flush(b.Serializer, n)
+			}
 			buffer.release()
 		}
 	}
 }
 
+// Close stops the background flusher and flushes the buffer, satisfies the
+// io.Closer interface.
+func (b *Buffer) Close() error {
+	b.prepare(b.bufferSize())
+	b.closeOnce.Do(func() {
+		if b.done != nil {
+			close(b.done)
+			<-b.join
+		}
+	})
+	b.Flush()
+	return nil
+}
+
 func (b *Buffer) prepare(bufferSize int) {
 	b.once.Do(func() {
 		b.buffers = make([]buffer, b.bufferPoolSize())
 		for i := range b.buffers {
 			b.buffers[i].init(bufferSize)
 		}
+		if b.FlushInterval > 0 {
+			b.done = make(chan struct{})
+			b.join = make(chan struct{})
+			go b.run(b.FlushInterval)
+		}
 	})
 }
 
+func (b *Buffer) run(interval time.Duration) {
+	defer close(b.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Flush only writes the buffers that it manages to acquire, the
+			// ones that are in use are skipped and will be flushed on the
+			// next tick, which keeps the buffer pool free of locks.
+			b.Flush()
+		case <-b.done:
+			return
+		}
+	}
+}
+
 func (b *Buffer) bufferSize() int {
 	if b.BufferSize != 0 {
 		return b.BufferSize
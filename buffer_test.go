@@ -0,0 +1,71 @@
+package stats_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestBufferFlushInterval(t *testing.T) {
+	s := &recordingSerializer{writes: make(chan string, 10)}
+	b := &stats.Buffer{
+		BufferSize:    1024,
+		FlushInterval: 10 * time.Millisecond,
+		Serializer:    s,
+	}
+
+	b.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+
+	select {
+	case w := <-s.writes:
+		if w != "request.count\n" {
+			t.Error("bad write:", w)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the buffer was not flushed in the background")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Error(err)
+	}
+
+	b.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+
+	select {
+	case w := <-s.writes:
+		t.Error("unexpected write after closing the buffer:", w)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type recordingSerializer struct {
+	mutex  sync.Mutex
+	writes chan string
+}
+
+func (s *recordingSerializer) Write(b []byte) (int, error) {
+	s.mutex.Lock()
+	s.writes <- string(b)
+	s.mutex.Unlock()
+	return len(b), nil
+}
+
+func (s *recordingSerializer) AppendMeasures(b []byte, _ time.Time, measures ...stats.Measure) []byte {
+	for _, m := range measures {
+		for _, f := range m.Fields {
+			b = append(b, m.Name...)
+			b = append(b, '.')
+			b = append(b, f.Name...)
+			b = append(b, '\n')
+		}
+	}
+	return b
+}
@@ -0,0 +1,396 @@
+package stats
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+const (
+	// DefaultCardinalityLimit is the default maximum number of unique tag sets
+	// that a CardinalityLimit handler accepts for each metric name.
+	DefaultCardinalityLimit = 1000
+
+	// DefaultCardinalityWindow is the default length of the sliding window over
+	// which a CardinalityLimit handler counts unique tag sets.
+	DefaultCardinalityWindow = 10 * time.Minute
+
+	// DefaultOverflowBuckets is the default number of buckets that tag values
+	// are hashed into by the HashOverflow policy.
+	DefaultOverflowBuckets = 16
+
+	// OverflowTagValue is the value that the RewriteOverflow policy sets on
+	// tags exceeding the cardinality limit.
+	OverflowTagValue = "__overflow__"
+)
+
+// CardinalityPolicy is an enumeration of the actions that a CardinalityLimit
+// handler can take on measures exceeding the cardinality limit.
+type CardinalityPolicy int
+
+const (
+	// DropOverflow drops measures exceeding the cardinality limit.
+	DropOverflow CardinalityPolicy = iota
+
+	// RewriteOverflow replaces the values of the offending tags of measures
+	// exceeding the cardinality limit with OverflowTagValue.
+	RewriteOverflow
+
+	// HashOverflow replaces the values of the offending tags of measures
+	// exceeding the cardinality limit with one of a fixed number of buckets
+	// chosen by hashing the original values.
+	HashOverflow
+)
+
+func (p CardinalityPolicy) String() string {
+	switch p {
+	case DropOverflow:
+		return "drop"
+	case RewriteOverflow:
+		return "rewrite"
+	case HashOverflow:
+		return "hash"
+	default:
+		return "unknown"
+	}
+}
+
+// CardinalityLimit is a measure handler which protects another handler from
+// metrics with an unbounded number of tag values (like user or request ids).
+//
+// The handler tracks the unique tag sets seen for each metric name within a
+// sliding window. Once a metric has reached the limit, measures with tag sets
+// which are not already tracked are handled according to the configured
+// policy. The offending tags are the ones carrying a value that was not seen
+// on any of the tracked tag sets of the metric.
+//
+// The handler reports the measures that it limited on a counter named
+// "stats.cardinality.limited", tagged with the metric name, the offending tag,
+// and the policy applied. The counter is forwarded to the handler when it is
+// flushed, and at most every few seconds while measures are being handled.
+type CardinalityLimit struct {
+	// The handler that measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler Handler
+
+	// Maximum number of unique tag sets per metric name. If zero,
+	// DefaultCardinalityLimit is used.
+	Limit int
+
+	// Length of the sliding window over which unique tag sets are counted,
+	// tag sets that were not seen for longer than this duration don't count
+	// toward the limit anymore. If zero, DefaultCardinalityWindow is used.
+	Window time.Duration
+
+	// Action taken on measures exceeding the limit, DropOverflow by default.
+	Policy CardinalityPolicy
+
+	// Number of buckets that tag values are hashed into when Policy is
+	// HashOverflow. If zero, DefaultOverflowBuckets is used.
+	Buckets int
+
+	mutex   sync.RWMutex
+	metrics map[string]*cardinalityState
+
+	reportMutex sync.Mutex
+	reportTime  time.Time
+	limited     map[limitedKey]uint64
+}
+
+// NewCardinalityLimit returns a new CardinalityLimit handler which forwards
+// measures to handler, applying policy to metrics with more than limit unique
+// tag sets.
+func NewCardinalityLimit(handler Handler, limit int, policy CardinalityPolicy) *CardinalityLimit {
+	return &CardinalityLimit{
+		Handler: handler,
+		Limit:   limit,
+		Policy:  policy,
+	}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *CardinalityLimit) HandleMeasures(t time.Time, measures ...Measure) {
+	now := time.Now()
+	kb := aggregateKeyPool.Get().(*aggregateKey)
+
+	var limited []Measure
+	for i := range measures {
+		m := &measures[i]
+		kb.b = appendTagsKey(kb.b[:0], m.Tags)
+
+		state := h.lookup(m.Name)
+		offending, ok := state.observe(kb.b, m.Tags, now, h.limit(), h.window())
+
+		if ok {
+			if limited != nil {
+				limited = append(limited, *m)
+			}
+			continue
+		}
+
+		if limited == nil {
+			limited = make([]Measure, i, len(measures))
+			copy(limited, measures[:i])
+		}
+
+		h.record(m.Name, offending)
+
+		if h.Policy != DropOverflow {
+			limited = append(limited, h.rewrite(*m, offending))
+		}
+	}
+
+	aggregateKeyPool.Put(kb)
+
+	if limited != nil {
+		measures = limited
+	}
+
+	if len(measures) != 0 {
+		h.Handler.HandleMeasures(t, measures...)
+	}
+
+	if h.shouldReport(now) {
+		h.report(now)
+	}
+}
+
+// Flush forwards the state of the handler to the handler it wraps, then
+// flushes it. Flush satisfies the Flusher interface.
+func (h *CardinalityLimit) Flush() {
+	h.report(time.Now())
+	flush(h.Handler)
+}
+
+// Close forwards the state of the handler to the handler it wraps, then closes
+// it. Close satisfies the Closer interface.
+func (h *CardinalityLimit) Close() error {
+	h.report(time.Now())
+	return closeHandler(h.Handler)
+}
+
+func (h *CardinalityLimit) lookup(name string) *cardinalityState {
+	h.mutex.RLock()
+	state := h.metrics[name]
+	h.mutex.RUnlock()
+
+	if state == nil {
+		h.mutex.Lock()
+
+		if h.metrics == nil {
+			h.metrics = make(map[string]*cardinalityState)
+		}
+
+		if state = h.metrics[name]; state == nil {
+			state = &cardinalityState{
+				series: make(map[string]*cardinalitySeries),
+				values: make(map[string]map[string]int),
+			}
+			h.metrics[name] = state
+		}
+
+		h.mutex.Unlock()
+	}
+
+	return state
+}
+
+func (h *CardinalityLimit) rewrite(m Measure, offending []string) Measure {
+	tags := copyTags(m.Tags)
+
+	for i := range tags {
+		t := &tags[i]
+
+		if !slices.Contains(offending, t.Name) {
+			continue
+		}
+
+		switch h.Policy {
+		case HashOverflow:
+			t.Value = overflowBucket(t.Value, h.buckets())
+		default:
+			t.Value = OverflowTagValue
+		}
+	}
+
+	m.Tags = tags
+	return m
+}
+
+func (h *CardinalityLimit) record(name string, offending []string) {
+	h.reportMutex.Lock()
+
+	if h.limited == nil {
+		h.limited = make(map[limitedKey]uint64)
+	}
+
+	for _, tag := range offending {
+		h.limited[limitedKey{metric: name, tag: tag}]++
+	}
+
+	h.reportMutex.Unlock()
+}
+
+func (h *CardinalityLimit) shouldReport(now time.Time) bool {
+	h.reportMutex.Lock()
+	defer h.reportMutex.Unlock()
+	return len(h.limited) != 0 && now.Sub(h.reportTime) >= cardinalityReportInterval
+}
+
+func (h *CardinalityLimit) report(now time.Time) {
+	h.reportMutex.Lock()
+	limited := h.limited
+	h.limited = nil
+	h.reportTime = now
+	h.reportMutex.Unlock()
+
+	if len(limited) == 0 {
+		return
+	}
+
+	policy := h.Policy.String()
+	measures := make([]Measure, 0, len(limited))
+
+	for k, n := range limited {
+		measures = append(measures, Measure{
+			Name:   "stats.cardinality",
+			Fields: []Field{MakeField("limited", n, Counter)},
+			Tags: []Tag{
+				{Name: "metric", Value: k.metric},
+				{Name: "policy", Value: policy},
+				{Name: "tag", Value: k.tag},
+			},
+		})
+	}
+
+	h.Handler.HandleMeasures(now, measures...)
+}
+
+func (h *CardinalityLimit) limit() int {
+	if h.Limit != 0 {
+		return h.Limit
+	}
+	return DefaultCardinalityLimit
+}
+
+func (h *CardinalityLimit) window() time.Duration {
+	if h.Window != 0 {
+		return h.Window
+	}
+	return DefaultCardinalityWindow
+}
+
+func (h *CardinalityLimit) buckets() int {
+	if h.Buckets > 0 {
+		return h.Buckets
+	}
+	return DefaultOverflowBuckets
+}
+
+const cardinalityReportInterval = 10 * time.Second
+
+type limitedKey struct {
+	metric string
+	tag    string
+}
+
+type cardinalityState struct {
+	mutex  sync.Mutex
+	series map[string]*cardinalitySeries
+	// values counts the tracked tag sets referencing each tag value, it is
+	// used to determine which tags are responsible for exceeding the limit.
+	values map[string]map[string]int
+	expire time.Time
+}
+
+type cardinalitySeries struct {
+	tags     []Tag
+	lastSeen time.Time
+}
+
+// observe records that the tag set identified by key was seen at now. It
+// returns true if the measure may be forwarded, or false and the list of
+// offending tag names if the metric exceeded its limit.
+func (s *cardinalityState) observe(key []byte, tags []Tag, now time.Time, limit int, window time.Duration) ([]string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if series := s.series[string(key)]; series != nil {
+		series.lastSeen = now
+		return nil, true
+	}
+
+	if len(s.series) >= limit && !now.Before(s.expire) {
+		s.cleanup(now.Add(-window))
+		// Sweeping the series is linear in the limit, it is only retried
+		// after a fraction of the window to amortize its cost.
+		s.expire = now.Add(window / 10)
+	}
+
+	if len(s.series) < limit {
+		series := &cardinalitySeries{tags: copyTags(tags), lastSeen: now}
+		s.series[string(key)] = series
+		s.add(series.tags, +1)
+		return nil, true
+	}
+
+	var offending []string
+	for _, t := range tags {
+		if s.values[t.Name][t.Value] == 0 {
+			offending = append(offending, t.Name)
+		}
+	}
+
+	if len(offending) == 0 {
+		// Every tag value was seen before, only their combination is new. In
+		// this case all the tags share the responsibility.
+		for _, t := range tags {
+			offending = append(offending, t.Name)
+		}
+	}
+
+	return offending, false
+}
+
+func (s *cardinalityState) cleanup(exp time.Time) {
+	for key, series := range s.series {
+		if series.lastSeen.Before(exp) {
+			delete(s.series, key)
+			s.add(series.tags, -1)
+		}
+	}
+}
+
+func (s *cardinalityState) add(tags []Tag, n int) {
+	for _, t := range tags {
+		values := s.values[t.Name]
+
+		if values == nil {
+			values = make(map[string]int)
+			s.values[t.Name] = values
+		}
+
+		if values[t.Value] += n; values[t.Value] <= 0 {
+			delete(values, t.Value)
+		}
+	}
+}
+
+func overflowBucket(value string, buckets int) string {
+	h := jody.HashString64(value)
+	return "__overflow_" + strconv.FormatUint(h%uint64(buckets), 10) + "__"
+}
+
+func appendTagsKey(b []byte, tags []Tag) []byte {
+	for _, t := range tags {
+		b = append(b, t.Name...)
+		b = append(b, 0)
+		b = append(b, t.Value...)
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,102 @@
+package stats_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestCardinalityLimit(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	produce := func(e *stats.Engine) {
+		for i := 0; i != 5; i++ {
+			e.Incr("requests.count", stats.T("status", "ok"), stats.T("user_id", strconv.Itoa(i)))
+		}
+		// Known tag sets are always accepted.
+		e.Incr("requests.count", stats.T("status", "ok"), stats.T("user_id", "0"))
+		// Other metrics have their own limit.
+		e.Incr("other.count", stats.T("user_id", "42"))
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCardinalityLimit(h, 2, stats.DropOverflow)
+		produce(stats.NewEngine("", c))
+
+		assert.Equal(t, []string{"0", "1", "0", "42"}, tagValues(h.Measures(), "user_id"))
+
+		// The first limited measure is reported right away, the others when
+		// the handler is flushed.
+		c.Flush()
+		assert.Equal(t, uint64(3), limitedCount(h.Measures(), "requests", "user_id"))
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCardinalityLimit(h, 2, stats.RewriteOverflow)
+		produce(stats.NewEngine("", c))
+
+		assert.Equal(t, []string{"0", "1", "__overflow__", "__overflow__", "__overflow__", "0", "42"}, tagValues(h.Measures(), "user_id"))
+		assert.Equal(t, []string{"ok", "ok", "ok", "ok", "ok", "ok"}, tagValues(h.Measures(), "status"))
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := &stats.CardinalityLimit{Handler: h, Limit: 2, Policy: stats.HashOverflow, Buckets: 1}
+		produce(stats.NewEngine("", c))
+
+		assert.Equal(t, []string{"0", "1", "__overflow_0__", "__overflow_0__", "__overflow_0__", "0", "42"}, tagValues(h.Measures(), "user_id"))
+	})
+
+	t.Run("tag sets expire after the window", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := &stats.CardinalityLimit{Handler: h, Limit: 1, Window: time.Nanosecond}
+		e := stats.NewEngine("", c)
+
+		e.Incr("requests.count", stats.T("user_id", "1"))
+		time.Sleep(time.Millisecond)
+		e.Incr("requests.count", stats.T("user_id", "2"))
+
+		assert.Equal(t, []string{"1", "2"}, tagValues(h.Measures(), "user_id"))
+	})
+}
+
+func tagValues(measures []stats.Measure, name string) []string {
+	var values []string
+	for _, m := range measures {
+		if strings.HasPrefix(m.Name, "stats.") {
+			continue
+		}
+		for _, t := range m.Tags {
+			if t.Name == name {
+				values = append(values, t.Value)
+			}
+		}
+	}
+	return values
+}
+
+func limitedCount(measures []stats.Measure, metric, tag string) (n uint64) {
+	for _, m := range measures {
+		if m.Name != "stats.cardinality" {
+			continue
+		}
+		if assert.ObjectsAreEqual(m.Tags, []stats.Tag{
+			stats.T("metric", metric),
+			stats.T("policy", "drop"),
+			stats.T("tag", tag),
+		}) {
+			n += m.Fields[0].Value.Uint()
+		}
+	}
+	return n
+}
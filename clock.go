@@ -17,11 +17,12 @@ type Clock struct {
 }
 
 // Stamp reports the time difference between now and the last time the method
-// was called (or since the clock was created).
+// was called (or since the clock was created). The current time is given by
+// the engine that created the clock.
 //
 // The metric produced by this method call will have a "stamp" tag set to name.
 func (c *Clock) Stamp(name string) {
-	c.StampAt(name, time.Now())
+	c.StampAt(name, c.eng.CurrentTime())
 }
 
 // StampAt reports the time difference between now and the last time the method
@@ -34,11 +35,12 @@ func (c *Clock) StampAt(name string, now time.Time) {
 }
 
 // Stop reports the time difference between now and the time the clock was created at.
+// The current time is given by the engine that created the clock.
 //
 // The metric produced by this method call will have a "stamp" tag set to
 // "total".
 func (c *Clock) Stop() {
-	c.StopAt(time.Now())
+	c.StopAt(c.eng.CurrentTime())
 }
 
 // StopAt reports the time difference between now and the time the clock was created at.
@@ -0,0 +1,562 @@
+// Command statsgen generates implementations of the stats.MeasureAppender
+// interface for struct types exposing metrics with the metric, tag and type
+// struct tags described in stats.MakeMeasures.
+//
+// The generated AppendMeasures methods produce the same measures as the
+// reflection-based code of the stats package, without reflection and without
+// the per-engine cache of measure layouts. The descriptions declared with the
+// help and unit struct tags are registered the first time measures are
+// appended with a given prefix.
+//
+// The program is intended to be run by go generate, for example:
+//
+//	//go:generate go run github.com/segmentio/stats/v5/cmd/statsgen -type=metrics
+//
+// By default, the methods of all types are written to <type>_stats.go, in the
+// directory of the package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	var typeNames string
+	var output string
+
+	log.SetFlags(0)
+	log.SetPrefix("statsgen: ")
+
+	flag.StringVar(&typeNames, "type", "", "Comma-separated list of struct type names to generate AppendMeasures methods for (required)")
+	flag.StringVar(&output, "output", "", "Name of the output file, defaults to <type>_stats.go")
+	flag.Usage = usage
+	flag.Parse()
+
+	if len(typeNames) == 0 {
+		usage()
+	}
+
+	dir := "."
+	switch args := flag.Args(); len(args) {
+	case 0:
+	case 1:
+		dir = args[0]
+	default:
+		usage()
+	}
+
+	types := strings.Split(typeNames, ",")
+	src, err := generate(dir, types, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(output) == 0 {
+		output = strings.ToLower(types[0]) + "_stats.go"
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, output), src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: statsgen -type T[,T...] [-output file] [directory]
+
+`)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// generate returns the formatted source of the AppendMeasures methods of the
+// given types, declared by the package in dir. The args are recorded in the
+// header of the generated file.
+func generate(dir string, types []string, args []string) ([]byte, error) {
+	pkg, err := parsePackage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{pkg: pkg}
+	g.printf("// Code generated by \"statsgen %s\"; DO NOT EDIT.\n\n", strings.Join(args, " "))
+	g.printf("package %s\n\n", pkg.name)
+	g.printf("import stats %q\n", statsImportPath)
+
+	for _, name := range types {
+		if err := g.generate(name); err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+const statsImportPath = "github.com/segmentio/stats/v5"
+
+type pkg struct {
+	name  string
+	types map[string]*ast.TypeSpec
+	// Names of the receivers of the methods declared on each type.
+	receivers map[string]string
+	// Names that the time package is imported as, by file.
+	timeImports map[*ast.File]string
+	// The file that each type is declared in.
+	files map[string]*ast.File
+}
+
+func parsePackage(dir string) (*pkg, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pkg{
+		name:        bp.Name,
+		types:       make(map[string]*ast.TypeSpec),
+		receivers:   make(map[string]string),
+		timeImports: make(map[*ast.File]string),
+		files:       make(map[string]*ast.File),
+	}
+
+	fset := token.NewFileSet()
+
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, imp := range f.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == "time" {
+				p.timeImports[f] = "time"
+				if imp.Name != nil {
+					p.timeImports[f] = imp.Name.Name
+				}
+			}
+		}
+
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						p.types[ts.Name.Name] = ts
+						p.files[ts.Name.Name] = f
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv != nil && len(d.Recv.List) == 1 && len(d.Recv.List[0].Names) == 1 {
+					recv := d.Recv.List[0]
+					if typ := receiverType(recv.Type); len(typ) != 0 {
+						p.receivers[typ] = recv.Names[0].Name
+					}
+				}
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func receiverType(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+type generator struct {
+	pkg  *pkg
+	buf  bytes.Buffer
+	file *ast.File
+	// Depth of the loops over arrays, used to name the loop variables.
+	depth int
+	// Descriptions of the fields of the type being generated.
+	descs []fieldDesc
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(typeName string) error {
+	ts := g.pkg.types[typeName]
+	if ts == nil {
+		return fmt.Errorf("type %s not found in package %s", typeName, g.pkg.name)
+	}
+
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct type", typeName)
+	}
+
+	recv := g.pkg.receivers[typeName]
+	if len(recv) == 0 || recv == "_" {
+		recv = strings.ToLower(typeName[:1])
+	}
+
+	g.file = g.pkg.files[typeName]
+	g.depth = 0
+	g.descs = g.descs[:0]
+
+	// The measures are generated first, to know whether the type has fields
+	// with descriptions to register before producing the measures.
+	header := g.buf.Len()
+
+	if err := g.generateStruct(st, recv, "", nil); err != nil {
+		return fmt.Errorf("%s: %w", typeName, err)
+	}
+
+	body := append([]byte{}, g.buf.Bytes()[header:]...)
+	g.buf.Truncate(header)
+
+	descs := "_" + typeName + "_descriptions"
+
+	if len(g.descs) != 0 {
+		g.printf("\nvar %s stats.DescribeOnce\n", descs)
+	}
+
+	g.printf("\n// AppendMeasures satisfies the stats.MeasureAppender interface.\n")
+	g.printf("func (%s *%s) AppendMeasures(measures []stats.Measure, prefix string, tags ...stats.Tag) []stats.Measure {\n", recv, typeName)
+
+	if len(g.descs) != 0 {
+		g.printf("%s.Do(prefix,\n", descs)
+		for _, desc := range g.descs {
+			g.printf("stats.FieldDescription{Measure: %q, Field: %q, Description: stats.Description{", desc.measure, desc.field)
+			if len(desc.help) != 0 {
+				g.printf("Help: %q, ", desc.help)
+			}
+			if len(desc.unit) != 0 {
+				g.printf("Unit: %q, ", desc.unit)
+			}
+			g.printf("Type: %s, HasType: true}},\n", desc.ftype)
+		}
+		g.printf(")\n")
+	}
+
+	g.buf.Write(body)
+	g.printf("return measures\n}\n")
+	return nil
+}
+
+// fieldDesc is the description of a measure field declared with the help and
+// unit struct tags.
+type fieldDesc struct {
+	measure string
+	field   string
+	help    string
+	unit    string
+	ftype   string
+}
+
+func (g *generator) describe(desc fieldDesc) {
+	for _, d := range g.descs {
+		// Arrays of structs produce multiple measures with the same names.
+		if d.measure == desc.measure && d.field == desc.field {
+			return
+		}
+	}
+	g.descs = append(g.descs, desc)
+}
+
+// tagExpr is a tag of the generated measures, read from the expression expr.
+type tagExpr struct {
+	name string
+	expr string
+}
+
+// generateStruct generates the code appending the measures of the struct value
+// at expr. The code mirrors the reflection-based implementation of the stats
+// package: measures of nested structs are appended before the measure made of
+// the metric fields of the struct itself, and tags declared by a struct are
+// inherited by the nested structs, overriding tags with the same name.
+func (g *generator) generateStruct(st *ast.StructType, expr, name string, tags []tagExpr) error {
+	tags = append([]tagExpr{}, tags...)
+
+	for _, f := range st.Fields.List {
+		tag := structTag(f).Get("tag")
+		if len(tag) == 0 {
+			continue
+		}
+		if !isIdent(f.Type, "string") {
+			return fmt.Errorf("unsupported value type found for metric tags of %s: %s", concat(name, tag), exprString(f.Type))
+		}
+		for _, fieldName := range fieldNames(f) {
+			if fieldName == "_" {
+				return fmt.Errorf("blank field cannot be used as metric tag %s", concat(name, tag))
+			}
+			tags = setTag(tags, tagExpr{name: tag, expr: expr + "." + fieldName})
+		}
+	}
+
+	var fields []string
+
+	for _, f := range st.Fields.List {
+		metric := structTag(f).Get("metric")
+
+		for _, fieldName := range fieldNames(f) {
+			fieldExpr := expr + "." + fieldName
+
+			if nested, elems := g.structType(f.Type); nested != nil || elems != 0 {
+				if fieldName == "_" {
+					continue
+				}
+				if err := g.generateNested(f.Type, fieldExpr, concat(name, metric), tags); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if len(metric) == 0 {
+				continue
+			}
+
+			if fieldName == "_" {
+				return fmt.Errorf("blank field cannot be used as metric %s", concat(name, metric))
+			}
+
+			ftype, err := fieldType(structTag(f).Get("type"))
+			if err != nil {
+				return fmt.Errorf("%s: %w", concat(name, metric), err)
+			}
+
+			field, ok := g.fieldExpr(f.Type, metric, fieldExpr, ftype)
+			if !ok {
+				return fmt.Errorf("unsupported value type found for metric %s: %s", concat(name, metric), exprString(f.Type))
+			}
+			fields = append(fields, field)
+
+			if help, unit := structTag(f).Get("help"), structTag(f).Get("unit"); help != "" || unit != "" {
+				g.describe(fieldDesc{measure: name, field: metric, help: help, unit: unit, ftype: ftype})
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	g.printf("measures = stats.AppendMeasure(measures, prefix, %q, []stats.Field{\n", name)
+	for _, field := range fields {
+		g.printf("%s,\n", field)
+	}
+	g.printf("}, ")
+
+	if len(tags) == 0 {
+		g.printf("nil")
+	} else {
+		g.printf("[]stats.Tag{\n")
+		for _, t := range tags {
+			g.printf("{Name: %q, Value: %s},\n", t.name, t.expr)
+		}
+		g.printf("}")
+	}
+
+	g.printf(", tags)\n")
+	return nil
+}
+
+// generateNested generates the code appending the measures of a nested struct
+// or array of structs.
+func (g *generator) generateNested(typ ast.Expr, expr, name string, tags []tagExpr) error {
+	if ident, ok := typ.(*ast.Ident); ok {
+		if ts := g.pkg.types[ident.Name]; ts != nil {
+			typ = ts.Type
+		}
+	}
+
+	switch t := typ.(type) {
+	case *ast.StructType:
+		return g.generateStruct(t, expr, name, tags)
+
+	case *ast.ArrayType:
+		index := "i"
+		if g.depth != 0 {
+			index += strconv.Itoa(g.depth)
+		}
+
+		g.depth++
+		g.printf("for %s := range %s {\n", index, expr)
+		err := g.generateNested(t.Elt, expr+"["+index+"]", name, tags)
+		g.printf("}\n")
+		g.depth--
+		return err
+	}
+
+	return nil
+}
+
+// structType returns the struct type of typ, or the number of nested arrays
+// of structs if typ is an array type.
+func (g *generator) structType(typ ast.Expr) (*ast.StructType, int) {
+	switch t := typ.(type) {
+	case *ast.StructType:
+		return t, 0
+
+	case *ast.Ident:
+		if ts := g.pkg.types[t.Name]; ts != nil && ts.Assign == 0 {
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				return st, 0
+			}
+			if at, ok := ts.Type.(*ast.ArrayType); ok && at.Len != nil {
+				return g.structType(at)
+			}
+		}
+
+	case *ast.ArrayType:
+		if t.Len != nil {
+			if st, n := g.structType(t.Elt); st != nil || n != 0 {
+				return nil, n + 1
+			}
+		}
+	}
+	return nil, 0
+}
+
+// fieldExpr returns the expression constructing a stats.Field for the value of
+// type typ at expr, or false if the type is not supported.
+func (g *generator) fieldExpr(typ ast.Expr, name, expr, ftype string) (string, bool) {
+	var constructor, conv string
+
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "bool":
+			constructor = "BoolField"
+		case "int", "int8", "int16", "int32", "rune":
+			constructor, conv = "IntField", "int64"
+		case "int64":
+			constructor = "IntField"
+		case "uint", "uint8", "uint16", "uint32", "uintptr", "byte":
+			constructor, conv = "UintField", "uint64"
+		case "uint64":
+			constructor = "UintField"
+		case "float32":
+			constructor, conv = "FloatField", "float64"
+		case "float64":
+			constructor = "FloatField"
+		default:
+			return "", false
+		}
+
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok || t.Sel.Name != "Duration" || pkg.Name != g.pkg.timeImports[g.file] {
+			return "", false
+		}
+		constructor = "DurationField"
+
+	default:
+		return "", false
+	}
+
+	if len(conv) != 0 {
+		expr = conv + "(" + expr + ")"
+	}
+
+	return fmt.Sprintf("stats.%s(%q, %s, %s)", constructor, name, expr, ftype), true
+}
+
+func fieldType(mtype string) (string, error) {
+	switch mtype {
+	case "counter":
+		return "stats.Counter", nil
+	case "gauge":
+		return "stats.Gauge", nil
+	case "set":
+		return "stats.Distinct", nil
+	case "histogram", "":
+		return "stats.Histogram", nil
+	default:
+		// The stats package treats unknown types as histograms, but the tag is
+		// most likely a typo that is better reported at generation time.
+		return "", fmt.Errorf("unsupported metric type %q", mtype)
+	}
+}
+
+func setTag(tags []tagExpr, tag tagExpr) []tagExpr {
+	i := sort.Search(len(tags), func(i int) bool { return tags[i].name >= tag.name })
+
+	if i < len(tags) && tags[i].name == tag.name {
+		tags[i] = tag
+		return tags
+	}
+
+	tags = append(tags, tagExpr{})
+	copy(tags[i+1:], tags[i:])
+	tags[i] = tag
+	return tags
+}
+
+func structTag(f *ast.Field) reflect.StructTag {
+	if f.Tag == nil {
+		return ""
+	}
+	s, _ := strconv.Unquote(f.Tag.Value)
+	return reflect.StructTag(s)
+}
+
+func fieldNames(f *ast.Field) []string {
+	if len(f.Names) == 0 {
+		// Embedded fields are named after their type.
+		typ := f.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		switch t := typ.(type) {
+		case *ast.Ident:
+			return []string{t.Name}
+		case *ast.SelectorExpr:
+			return []string{t.Sel.Name}
+		}
+		return nil
+	}
+
+	names := make([]string, len(f.Names))
+	for i, name := range f.Names {
+		names[i] = name.Name
+	}
+	return names
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func exprString(expr ast.Expr) string {
+	var b bytes.Buffer
+	_ = format.Node(&b, token.NewFileSet(), expr)
+	return b.String()
+}
+
+func concat(prefix, suffix string) string {
+	if len(prefix) == 0 {
+		return suffix
+	}
+	if len(suffix) == 0 {
+		return prefix
+	}
+	return prefix + "." + suffix
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "metrics")
+	golden := filepath.Join(dir, "funcmetrics_stats.go.golden")
+
+	src, err := generate(dir, []string{"funcMetrics", "queueMetrics"}, []string{"-type=funcMetrics,queueMetrics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.WriteFile(golden, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(src) != string(expected) {
+		t.Error("generated code does not match", golden)
+		t.Log(string(src))
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "not a struct",
+			src:  "type T int",
+		},
+		{
+			name: "unsupported metric type",
+			src:  "type T struct { v string `metric:\"v\"` }",
+		},
+		{
+			name: "unsupported tag type",
+			src:  "type T struct { v int `tag:\"v\"` }",
+		},
+		{
+			name: "unknown field type",
+			src:  "type T struct { v int `metric:\"v\" type:\"gouge\"` }",
+		},
+		{
+			name: "missing type",
+			src:  "type U struct{}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package p\n\n" + test.src + "\n"
+
+			if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := generate(dir, []string{"T"}, nil); err == nil {
+				t.Error("expected an error")
+			} else {
+				t.Log(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import stdtime "time"
+
+type funcMetrics struct {
+	calls struct {
+		count int              `metric:"count" type:"counter"`
+		time  stdtime.Duration `metric:"time"  type:"histogram" help:"Time spent in \"f\"." unit:"seconds"`
+		errs  uint32           `metric:"errors"`
+	} `metric:"func.calls"`
+
+	queues [2]queueMetrics `metric:"queue"`
+
+	host string `tag:"host"`
+	zone string `tag:"zone"`
+}
+
+type queueMetrics struct {
+	size     int64   `metric:"size"     type:"gauge" help:"Number of items in the queue."`
+	ratio    float32 `metric:"ratio"    type:"gauge"`
+	blocked  bool    `metric:"blocked"  type:"gauge"`
+	ignored  int
+	zone     string `tag:"zone"`
+	priority string `tag:"priority"`
+}
+
+func (q *queueMetrics) reset() { *q = queueMetrics{} }
@@ -5,25 +5,73 @@ import (
 	"sync"
 )
 
-// ContextWithTags returns a new child context with the given tags.  If the
-// parent context already has tags set on it, they are _not_ propagated into
-// the context children.
+// ContextWithTags returns a new child context with a mutable request scope
+// holding the given tags. If the parent context already has tags set on it,
+// they are _not_ propagated into the context children, see
+// ContextWithInheritedTags to create a request scope which inherits them.
+//
+// Tags can be added to the scope later on by calling ContextAddTags with the
+// returned context or any of its children (unless they were created by
+// ContextExtendTags).
 func ContextWithTags(ctx context.Context, tags ...Tag) context.Context {
-	// initialize the context reference and return a new context
-	return context.WithValue(ctx, contextKeyReqTags, &tagSlice{
-		tags: tags,
+	return context.WithValue(ctx, contextKeyReqTags, &contextTags{
+		scope: &tagSlice{tags: tags},
 	})
 }
 
-// ContextAddTags adds the given tags to the given context, if the tags have
-// been set on any of the ancestor contexts.  ContextAddTags returns true
-// if tags were successfully appended to the context, and false otherwise.
+// ContextWithInheritedTags is like ContextWithTags, but the child context
+// inherits the tags of the parent context, and the tags of the scope override
+// the inherited tags with the same name.
+//
+// A request scope is shared by all the contexts derived from it, it is
+// intended to be created by middlewares for the lifetime of a request, see
+// ContextExtendTags to set tags that are only visible to a child context.
+func ContextWithInheritedTags(ctx context.Context, tags ...Tag) context.Context {
+	return context.WithValue(ctx, contextKeyReqTags, &contextTags{
+		parent: getContextTags(ctx),
+		scope:  &tagSlice{tags: tags},
+	})
+}
+
+// ContextExtendTags returns a new child context carrying the tags of the parent
+// context extended with the given tags. When the parent context has tags with
+// the same names, the given tags override them.
+//
+// Tag sets created by ContextExtendTags are immutable, the tags are only
+// visible to the child context and the contexts derived from it, which makes
+// it safe to use when fanning out work to concurrent goroutines. Calling
+// ContextAddTags on the child context returns false.
+func ContextExtendTags(ctx context.Context, tags ...Tag) context.Context {
+	c := &contextTags{}
+
+	switch parent := getContextTags(ctx); {
+	case parent == nil:
+		c.tags = SortTags(copyTags(tags))
+	case parent.scope == nil:
+		// Flatten consecutive immutable tag sets so lookups don't need to walk
+		// the whole chain of contexts.
+		c.parent = parent.parent
+		c.tags = mergeTags(parent.tags, tags)
+	default:
+		c.parent = parent
+		c.tags = SortTags(copyTags(tags))
+	}
+
+	return context.WithValue(ctx, contextKeyReqTags, c)
+}
+
+// ContextAddTags adds the given tags to the request scope of the given context,
+// if one was created by ContextWithTags or ContextWithInheritedTags on any of
+// the ancestor contexts.
+// ContextAddTags returns true if tags were successfully appended to the
+// context, and false otherwise.
 //
 // The proper way to set tags on a context if you don't know whether or not
 // tags already exist on the context is to first call ContextAddTags, and if
 // that returns false, then call ContextWithTags instead.
 func ContextAddTags(ctx context.Context, tags ...Tag) bool {
-	if x := getTagSlice(ctx); x != nil {
+	if c := getContextTags(ctx); c != nil && c.scope != nil {
+		x := c.scope
 		x.lock.Lock()
 		x.tags = append(x.tags, tags...)
 		x.lock.Unlock()
@@ -32,31 +80,65 @@ func ContextAddTags(ctx context.Context, tags ...Tag) bool {
 	return false
 }
 
-// ContextTags returns a copy of the tags on the context if they exist and nil
-// if they don't exist.
+// ContextTags returns a sorted copy of the tags on the context if they exist
+// and nil if they don't exist.
 func ContextTags(ctx context.Context) []Tag {
-	if x := getTagSlice(ctx); x != nil {
-		x.lock.Lock()
-		ret := make([]Tag, len(x.tags))
-		copy(ret, x.tags)
-		x.lock.Unlock()
-		return ret
+	return SortTags(appendContextTags(nil, ctx))
+}
+
+// appendContextTags appends the tags on the context to tags, without making an
+// intermediate copy like ContextTags does.
+func appendContextTags(tags []Tag, ctx context.Context) []Tag {
+	if c := getContextTags(ctx); c != nil {
+		tags = c.appendTo(tags)
 	}
-	return nil
+	return tags
 }
 
-func getTagSlice(ctx context.Context) *tagSlice {
-	if tags, ok := ctx.Value(contextKeyReqTags).(*tagSlice); ok {
+func getContextTags(ctx context.Context) *contextTags {
+	if tags, ok := ctx.Value(contextKeyReqTags).(*contextTags); ok {
 		return tags
 	}
 	return nil
 }
 
+// contextTags is a node of the tree of tag sets carried by contexts. Nodes are
+// either immutable tag sets, or mutable request scopes.
+type contextTags struct {
+	// For immutable tag sets, the nearest request scope that the tag set was
+	// derived from. For request scopes, the tag set of the parent context.
+	parent *contextTags
+	// The sorted tags of immutable tag sets, including the tags inherited from
+	// parent immutable tag sets.
+	tags []Tag
+	// Non-nil for request scopes.
+	scope *tagSlice
+}
+
+// appendTo appends the tags of c to tags, from the root of the tree to c, so
+// that sorting the result with SortTags lets child tags override their parents.
+func (c *contextTags) appendTo(tags []Tag) []Tag {
+	if c.parent != nil {
+		tags = c.parent.appendTo(tags)
+	}
+	if c.scope != nil {
+		return c.scope.appendTo(tags)
+	}
+	return append(tags, c.tags...)
+}
+
 type tagSlice struct {
 	tags []Tag
 	lock sync.Mutex
 }
 
+func (x *tagSlice) appendTo(tags []Tag) []Tag {
+	x.lock.Lock()
+	tags = append(tags, x.tags...)
+	x.lock.Unlock()
+	return tags
+}
+
 // tagsKey is a value for use with context.WithValue. It's used as
 // a pointer so it fits in an interface{} without allocation. This technique
 // for defining context keys was copied from Go 1.7's new use of context in net/http.
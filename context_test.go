@@ -2,6 +2,8 @@ package stats
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,3 +34,50 @@ func TestContextTags(t *testing.T) {
 	assert.Equal(t, 8, len(ContextTags(y)), "Updating tags should update parent reference")
 	assert.Equal(t, 0, len(ContextTags(x)), "Updating tags should not appear on original context")
 }
+
+func TestContextExtendTags(t *testing.T) {
+	root := ContextExtendTags(context.Background(), T("service", "api"), T("zone", "a"))
+	child := ContextExtendTags(root, T("zone", "b"), T("route", "/"))
+	sibling := ContextExtendTags(root, T("route", "/health"))
+
+	assert.Equal(t, []Tag{T("service", "api"), T("zone", "a")}, ContextTags(root), "Parent tags must not be modified by children")
+	assert.Equal(t, []Tag{T("route", "/"), T("service", "api"), T("zone", "b")}, ContextTags(child), "Children inherit and override parent tags")
+	assert.Equal(t, []Tag{T("route", "/health"), T("service", "api"), T("zone", "a")}, ContextTags(sibling), "Siblings must not see each other's tags")
+	assert.False(t, ContextAddTags(child, T("user", "1")), "Immutable tag sets cannot be modified")
+
+	// A request scope inherits the immutable tags, and children of the scope
+	// see the tags added to it later on.
+	scope := ContextWithInheritedTags(child, T("zone", "c"))
+	extended := ContextExtendTags(scope, T("shard", "1"))
+	assert.True(t, ContextAddTags(scope, T("status", "ok")))
+	assert.Equal(t, []Tag{
+		T("route", "/"),
+		T("service", "api"),
+		T("shard", "1"),
+		T("status", "ok"),
+		T("zone", "c"),
+	}, ContextTags(extended))
+	assert.Equal(t, []Tag{T("route", "/"), T("service", "api"), T("zone", "b")}, ContextTags(child))
+
+	// ContextWithTags starts a new scope without the tags of the parent.
+	fresh := ContextWithTags(scope, T("zone", "d"))
+	assert.Equal(t, []Tag{T("zone", "d")}, ContextTags(fresh))
+}
+
+func TestContextTagsConcurrentFanOut(t *testing.T) {
+	scope := ContextWithTags(context.Background())
+	wg := sync.WaitGroup{}
+
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := ContextExtendTags(scope, T("worker", strconv.Itoa(i)))
+			ContextAddTags(scope, T("step", strconv.Itoa(i)))
+			assert.Contains(t, ContextTags(ctx), T("worker", strconv.Itoa(i)))
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Len(t, ContextTags(scope), 1, "Scope tags with the same name override each other")
+}
@@ -1,6 +1,8 @@
 package datadog
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/url"
@@ -59,10 +61,23 @@ type ClientConfig struct {
 	// UseDistributions True indicates to send histograms with `d` type instead of `h` type
 	// https://docs.datadoghq.com/developers/dogstatsd/datagram_shell?tab=metrics#the-dogstatsd-protocol
 	UseDistributions bool
+
+	// Interval at which buffered metrics are sent to datadog even if the
+	// buffer isn't full. If zero, metrics are only sent when the buffer is
+	// full or when the client is flushed.
+	FlushInterval time.Duration
+
+	// ErrorHandler receives the errors encountered by the client, such as
+	// failures to resolve the address or to write to the agent. If nil, the
+	// errors are passed to stats.HandleError.
+	ErrorHandler stats.ErrorHandler
 }
 
 // Client represents an datadog client that implements the stats.Handler
 // interface.
+//
+// The client counts the bytes and packets it sent to the agent, and the
+// metrics it discarded, which the program can monitor with the Stats method.
 type Client struct {
 	serializer
 	err    error
@@ -107,32 +122,44 @@ func NewClientWith(config ClientConfig) *Client {
 			filters:          filterMap,
 			distPrefixes:     config.DistributionPrefixes,
 			useDistributions: config.UseDistributions,
+			errorHandler:     config.ErrorHandler,
 		},
 	}
 
 	w, err := newWriter(config.Address)
 	if err != nil {
-		log.Printf("stats/datadog: %s", err)
+		c.handleError(err)
 		c.err = err
 		w = &noopWriter{}
 	}
 
 	newBufSize, err := w.CalcBufferSize(config.BufferSize)
 	if err != nil {
-		log.Printf("stats/datadog: unable to calc writer's buffer size. Defaulting to a buffer of size %d - %v\n", DefaultBufferSize, err)
+		c.handleError(fmt.Errorf("unable to calc writer's buffer size, defaulting to a buffer of size %d: %w", DefaultBufferSize, err))
 		newBufSize = DefaultBufferSize
 	}
 
 	c.bufferSize = newBufSize
 	c.buffer.Serializer = &c.serializer
 	c.buffer.BufferSize = newBufSize
+	c.buffer.FlushInterval = config.FlushInterval
 	c.conn = w
 	log.Printf("stats/datadog: sending metrics with a buffer of size %d B", newBufSize)
 	return c
 }
 
 // HandleMeasures satisfies the stats.Handler interface.
+//
+// When the client failed to create the connection to the agent, the measures
+// are discarded and counted as dropped.
 func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	if c.err != nil {
+		// Each field of a measure is sent as a separate metric.
+		for _, m := range measures {
+			c.counters.Dropped(len(m.Fields))
+		}
+		return
+	}
 	c.buffer.HandleMeasures(time, measures...)
 }
 
@@ -141,16 +168,24 @@ func (c *Client) Flush() {
 	c.buffer.Flush()
 }
 
+// Stats returns a snapshot of the counters of the client.
+func (c *Client) Stats() stats.HandlerStats {
+	return c.counters.Stats()
+}
+
 // Write satisfies the io.Writer interface.
 func (c *Client) Write(b []byte) (int, error) {
 	return c.serializer.Write(b)
 }
 
-// Close flushes and closes the client, satisfies the io.Closer interface.
+// Close flushes and closes the client, satisfies the io.Closer and
+// stats.Closer interfaces.
+//
+// The returned error reports the failure to create the connection to the
+// agent, or to close it.
 func (c *Client) Close() error {
-	c.Flush()
-	c.close()
-	return c.err
+	_ = c.buffer.Close()
+	return errors.Join(c.err, c.close())
 }
 
 func bufSizeFromFD(f *os.File, sizehint int) (bufsize int, err error) {
@@ -16,6 +16,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var _ stats.Closer = (*Client)(nil)
+
 func TestClient(t *testing.T) {
 	client := NewClient(DefaultAddress)
 
@@ -39,6 +41,30 @@ func TestClient(t *testing.T) {
 	}
 }
 
+func TestClientFlushInterval(t *testing.T) {
+	packets := make(chan []byte)
+	addr, closer := startUDPListener(t, packets)
+	defer closer.Close()
+
+	client := NewClientWith(ClientConfig{
+		Address:       addr,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	defer client.Close()
+
+	client.HandleMeasures(time.Time{}, stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+
+	select {
+	case packet := <-packets:
+		assert.Equal(t, "request.count:1|c\n", string(packet))
+	case <-time.After(time.Second):
+		t.Fatal("metrics were not flushed in the background")
+	}
+}
+
 func TestClientSanitizesMetricNames(t *testing.T) {
 	// Start a goroutine listening for packets and giving them back on packets chan
 	packets := make(chan []byte)
@@ -316,3 +342,20 @@ func startUDPListener(t *testing.T, packets chan []byte) (addr string, closer io
 
 	return conn.LocalAddr().String(), conn
 }
+
+func TestClientDropsMeasuresWithoutConnection(t *testing.T) {
+	var errs []error
+	client := NewClientWith(ClientConfig{
+		Address:      "localhost:invalid-port",
+		ErrorHandler: stats.ErrorHandlerFunc(func(err error) { errs = append(errs, err) }),
+	})
+
+	client.HandleMeasures(time.Time{},
+		stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}},
+		stats.Measure{Name: "b", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}},
+	)
+
+	assert.Equal(t, stats.HandlerStats{DroppedMetrics: 2}, client.Stats())
+	assert.Len(t, errs, 1)
+	assert.Error(t, client.Close())
+}
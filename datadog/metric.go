@@ -17,6 +17,7 @@ const (
 	Gauge        MetricType = "g"
 	Histogram    MetricType = "h"
 	Distribution MetricType = "d"
+	Set          MetricType = "s"
 	Unknown      MetricType = "?"
 )
 
@@ -25,7 +26,7 @@ type Metric struct {
 	Type      MetricType  // the metric type
 	Namespace string      // the metric namespace (never populated by parsing operations)
 	Name      string      // the metric name
-	Value     float64     // the metric value
+	Value     float64     // the metric value, or the member of sets
 	Rate      float64     // sample rate, a value between 0 and 1
 	Tags      []stats.Tag // the list of tags set on the metric
 }
@@ -123,6 +123,17 @@ var testMetrics = []struct {
 		},
 	},
 
+	{
+		s: "users.uniques:1234|s\n",
+		m: Metric{
+			Type:  Set,
+			Name:  "users.uniques",
+			Value: 1234,
+			Rate:  1,
+			Tags:  nil,
+		},
+	},
+
 	{
 		s: "users.online:1|c|#country:china\n",
 		m: Metric{
@@ -163,7 +163,12 @@ func parseMetric(s string) (m Metric, err error) {
 	var value float64
 	var sampleRate float64
 
-	if value, err = strconv.ParseFloat(val, 64); err != nil {
+	if MetricType(typ) == Set {
+		// The members of sets may be any string, including numbers, they are
+		// all identified by their hash like the values passed to
+		// stats.Engine.Unique.
+		value = float64(stats.HashValue(val).Uint())
+	} else if value, err = strconv.ParseFloat(val, 64); err != nil {
 		err = fmt.Errorf("datadog: %#v has a malformed value", s)
 		return m, err
 	}
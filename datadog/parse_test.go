@@ -2,21 +2,47 @@ package datadog
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	stats "github.com/segmentio/stats/v5"
 )
 
 func TestParseMetricSuccess(t *testing.T) {
 	for _, test := range testMetrics {
 		t.Run(test.s, func(t *testing.T) {
+			expect := test.m
+			if expect.Type == Set {
+				// Set members are parsed as the hash of their representation.
+				_, member, _ := strings.Cut(test.s, ":")
+				member, _, _ = strings.Cut(member, "|")
+				expect.Value = float64(stats.HashValue(member).Uint())
+			}
+
 			if m, err := parseMetric(test.s); err != nil {
 				t.Error(err)
-			} else if !reflect.DeepEqual(m, test.m) {
-				t.Errorf("%#v:\n- %#v\n- %#v", test.s, test.m, m)
+			} else if !reflect.DeepEqual(m, expect) {
+				t.Errorf("%#v:\n- %#v\n- %#v", test.s, expect, m)
 			}
 		})
 	}
 }
 
+func TestParseMetricSetMember(t *testing.T) {
+	for _, member := range []string{"alice", "1234"} {
+		m, err := parseMetric("users.uniques:" + member + "|s|#country:china")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != Set {
+			t.Error("bad metric type:", m.Type)
+		}
+		if h := float64(stats.HashValue(member).Uint()); m.Value != h {
+			t.Errorf("bad set member %q: expected %g, got %g", member, h, m.Value)
+		}
+	}
+}
+
 func TestParseMetricFailure(t *testing.T) {
 	tests := []string{
 		"",
@@ -2,11 +2,12 @@ package datadog
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"log"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -21,6 +22,9 @@ type serializer struct {
 	filters          map[string]struct{}
 	distPrefixes     []string
 	useDistributions bool
+	closeOnce        sync.Once
+	errorHandler     stats.ErrorHandler
+	counters         stats.HandlerCounters
 }
 
 func (s *serializer) Write(b []byte) (int, error) {
@@ -33,7 +37,7 @@ func (s *serializer) Write(b []byte) (int, error) {
 		b = bytes.ToValidUTF8(b, []byte("\uFFFD"))
 	}
 	if len(b) <= s.bufferSize {
-		return s.conn.Write(b)
+		return s.write(b)
 	}
 
 	// When the serialized metrics are larger than the configured socket buffer
@@ -50,7 +54,8 @@ func (s *serializer) Write(b []byte) (int, error) {
 			}
 			if (i + splitIndex) >= s.bufferSize {
 				if splitIndex == 0 {
-					log.Printf("stats/datadog: metric of length %d B doesn't fit in the socket buffer of size %d B: %s", i+1, s.bufferSize, string(b))
+					s.counters.Oversize()
+					s.handleError(fmt.Errorf("metric of length %d B doesn't fit in the socket buffer of size %d B: %s", i+1, s.bufferSize, b[:i]))
 					b = b[i+1:]
 					continue
 				}
@@ -59,8 +64,10 @@ func (s *serializer) Write(b []byte) (int, error) {
 			splitIndex += i + 1
 		}
 
-		c, err := s.conn.Write(b[:splitIndex])
+		c, err := s.write(b[:splitIndex])
 		if err != nil {
+			// The metrics after the packet that failed are not sent.
+			s.counters.Dropped(bytes.Count(b[splitIndex:], []byte{'\n'}))
 			return n + c, err
 		}
 
@@ -71,10 +78,31 @@ func (s *serializer) Write(b []byte) (int, error) {
 	return n, nil
 }
 
-func (s *serializer) close() {
-	if s.conn != nil {
-		s.conn.Close()
+// write sends a packet to the agent, and counts it. The metrics of packets
+// that could not be sent are counted as dropped.
+func (s *serializer) write(b []byte) (int, error) {
+	n, err := s.conn.Write(b)
+	if err != nil {
+		s.counters.WriteError()
+		s.counters.Dropped(bytes.Count(b, []byte{'\n'}))
+		s.handleError(err)
+		return n, err
 	}
+	s.counters.Sent(n)
+	return n, nil
+}
+
+func (s *serializer) handleError(err error) {
+	stats.HandleErrorWith(s.errorHandler, fmt.Errorf("stats/datadog: %w", err))
+}
+
+func (s *serializer) close() (err error) {
+	s.closeOnce.Do(func() {
+		if s.conn != nil {
+			err = s.conn.Close()
+		}
+	})
+	return err
 }
 
 func (s *serializer) AppendMeasures(b []byte, _ time.Time, measures ...stats.Measure) []byte {
@@ -365,6 +393,8 @@ func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
 			b = append(b, '|', 'c')
 		case stats.Gauge:
 			b = append(b, '|', 'g')
+		case stats.Distinct:
+			b = append(b, '|', 's')
 		default:
 			if s.sendDist(field.Name) {
 				b = append(b, '|', 'd')
@@ -372,6 +402,10 @@ func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
 				b = append(b, '|', 'h')
 			}
 		}
+		if m.Sampled() {
+			b = append(b, '|', '@')
+			b = strconv.AppendFloat(b, m.SampleRate, 'g', -1, 64)
+		}
 		if len(m.Tags) > 0 {
 			b = append(b, '|', '#')
 			for i, t := range m.Tags {
@@ -3,6 +3,7 @@ package datadog
 import (
 	"bytes"
 	"errors"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -24,6 +25,34 @@ var testMeasures = []struct {
 			},
 		},
 		s: `request.count:5|c
+`,
+		dp: []string{},
+	},
+	{
+		m: stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("count", 5, stats.Counter),
+				stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+			},
+			Tags: []stats.Tag{
+				stats.T("answer", "42"),
+			},
+			SampleRate: 0.1,
+		},
+		s: `request.count:5|c|@0.1|#answer:42
+request.rtt:0.1|h|@0.1|#answer:42
+`,
+		dp: []string{},
+	},
+	{
+		m: stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("users", stats.HashValue("alice"), stats.Distinct),
+			},
+		},
+		s: `request.users:5803779529149266183|s
 `,
 		dp: []string{},
 	},
@@ -740,3 +769,49 @@ func BenchmarkTrimComparison(b *testing.B) {
 		})
 	}
 }
+
+type failingWriteCloser struct{ err error }
+
+func (w *failingWriteCloser) Write([]byte) (int, error) { return 0, w.err }
+func (w *failingWriteCloser) Close() error              { return nil }
+
+func TestSerializerCounters(t *testing.T) {
+	var errs []error
+	s := &serializer{
+		conn:         &MockWriteCloser{Buffer: &bytes.Buffer{}},
+		bufferSize:   16,
+		errorHandler: stats.ErrorHandlerFunc(func(err error) { errs = append(errs, err) }),
+	}
+
+	if _, err := s.Write([]byte("a:1|c\nb:2|c\n" + strings.Repeat("c", 20) + ":3|c\nd:4|c\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The payload is split in two packets, the metrics of the packet that
+	// failed and of the one that was not sent are dropped.
+	s.conn = &failingWriteCloser{err: io.ErrClosedPipe}
+	if _, err := s.Write([]byte("e:5|c\nf:6|c\ng:7|c\n")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatal("bad error:", err)
+	}
+
+	expect := stats.HandlerStats{
+		BytesSent:      18,
+		PacketsSent:    2,
+		WriteErrors:    1,
+		OversizeDrops:  1,
+		DroppedMetrics: 3,
+	}
+	if found := s.counters.Stats(); found != expect {
+		t.Errorf("bad counters:\nexpect: %+v\nfound:  %+v", expect, found)
+	}
+
+	if len(errs) != 2 {
+		t.Fatal("bad number of errors:", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "stats/datadog: metric of length 25 B doesn't fit") {
+		t.Error("bad oversize error:", errs[0])
+	}
+	if !errors.Is(errs[1], io.ErrClosedPipe) {
+		t.Error("bad write error:", errs[1])
+	}
+}
@@ -0,0 +1,130 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Description carries the metadata of a metric, which handlers forward to the
+// backends supporting it.
+type Description struct {
+	// A human-readable description of the metric.
+	Help string
+
+	// The unit of the metric values, for example "seconds" or "bytes".
+	Unit string
+
+	// The type of the metric, only meaningful when HasType is true since the
+	// zero FieldType is Counter.
+	Type FieldType
+
+	// HasType is true if the type of the metric is set.
+	HasType bool
+}
+
+// MetricDescriptions is a registry of metric descriptions. Unlike
+// HistogramBuckets, descriptions may be registered while measures are being
+// produced, so the registry is safe to use concurrently from multiple
+// goroutines.
+//
+// The zero value is an empty registry.
+type MetricDescriptions struct {
+	mutex sync.Mutex
+	// The map is copied on write so lookups don't need to acquire the mutex.
+	descs atomic.Pointer[map[Key]Description]
+}
+
+// Set registers the description of the metric identified by key, which is the
+// full name of the metric. The field name is what follows the last dot, use
+// SetField for field names containing dots.
+func (d *MetricDescriptions) Set(key string, desc Description) {
+	d.SetField(makeKey(key), desc)
+}
+
+// SetField registers the description of the metric identified by key.
+func (d *MetricDescriptions) SetField(key Key, desc Description) {
+	if old, ok := d.Lookup(key); ok && old == desc {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	descs := make(map[Key]Description)
+	if p := d.descs.Load(); p != nil {
+		for k, v := range *p {
+			descs[k] = v
+		}
+	}
+
+	descs[key] = desc
+	d.descs.Store(&descs)
+}
+
+// Lookup returns the description of the metric identified by key, and a
+// boolean indicating whether one was registered.
+func (d *MetricDescriptions) Lookup(key Key) (Description, bool) {
+	if p := d.descs.Load(); p != nil {
+		desc, ok := (*p)[key]
+		return desc, ok
+	}
+	return Description{}, false
+}
+
+// Descriptions is the registry where metric descriptions are placed. Like
+// Buckets, a common pattern is to describe the metrics that a package produces
+// in its init function. The descriptions of fields of structs reported to an
+// engine (see MakeMeasures) are also registered here.
+var Descriptions = &MetricDescriptions{}
+
+// Describe registers the description of the metric identified by name in the
+// Descriptions registry, see MetricDescriptions.Set for the format of the name.
+func Describe(name string, desc Description) {
+	Descriptions.Set(name, desc)
+}
+
+// FieldDescription is the description of a field of a measure.
+type FieldDescription struct {
+	Measure string
+	Field   string
+	Description
+}
+
+// DescribeOnce registers descriptions of measure fields once per prefix of the
+// measure names. It is intended to be used by implementations of the
+// MeasureAppender interface, which only know the prefix of the measure names
+// when measures are reported.
+//
+// The zero value is ready to use.
+type DescribeOnce struct {
+	mutex    sync.RWMutex
+	prefixes map[string]struct{}
+}
+
+// Do registers the descriptions in the Descriptions registry, with the measure
+// names prefixed by prefix, unless it was already called with this prefix.
+func (d *DescribeOnce) Do(prefix string, descs ...FieldDescription) {
+	d.mutex.RLock()
+	_, done := d.prefixes[prefix]
+	d.mutex.RUnlock()
+
+	if done {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, done := d.prefixes[prefix]; done {
+		return
+	}
+
+	for _, desc := range descs {
+		Descriptions.SetField(Key{Measure: concat(prefix, desc.Measure), Field: desc.Field}, desc.Description)
+	}
+
+	if d.prefixes == nil {
+		d.prefixes = make(map[string]struct{})
+	}
+	d.prefixes[prefix] = struct{}{}
+}
@@ -0,0 +1,97 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestMetricDescriptions(t *testing.T) {
+	descs := &stats.MetricDescriptions{}
+
+	_, ok := descs.Lookup(stats.Key{Measure: "http", Field: "rtt.seconds"})
+	assert.False(t, ok)
+
+	rtt := stats.Description{Help: "Round trip time.", Unit: "seconds", Type: stats.Histogram, HasType: true}
+	descs.SetField(stats.Key{Measure: "http", Field: "rtt.seconds"}, rtt)
+
+	count := stats.Description{Help: "Number of requests.", Type: stats.Counter, HasType: true}
+	descs.Set("http.requests.count", count)
+
+	desc, ok := descs.Lookup(stats.Key{Measure: "http", Field: "rtt.seconds"})
+	assert.True(t, ok)
+	assert.Equal(t, rtt, desc)
+
+	desc, ok = descs.Lookup(stats.Key{Measure: "http.requests", Field: "count"})
+	assert.True(t, ok)
+	assert.Equal(t, count, desc)
+}
+
+func TestMakeMeasuresDescriptions(t *testing.T) {
+	var m struct {
+		calls struct {
+			count int           `metric:"count" type:"counter" help:"Number of calls."`
+			time  time.Duration `metric:"time"  type:"histogram" help:"Time spent in calls." unit:"seconds"`
+			errs  int           `metric:"errors" type:"counter"`
+		} `metric:"describe.calls"`
+	}
+
+	stats.MakeMeasures("test", &m)
+
+	desc, _ := stats.Descriptions.Lookup(stats.Key{Measure: "test.describe.calls", Field: "count"})
+	assert.Equal(t, stats.Description{Help: "Number of calls.", Type: stats.Counter, HasType: true}, desc)
+
+	desc, _ = stats.Descriptions.Lookup(stats.Key{Measure: "test.describe.calls", Field: "time"})
+	assert.Equal(t, stats.Description{Help: "Time spent in calls.", Unit: "seconds", Type: stats.Histogram, HasType: true}, desc)
+
+	_, ok := stats.Descriptions.Lookup(stats.Key{Measure: "test.describe.calls", Field: "errors"})
+	assert.False(t, ok)
+}
+
+func TestDescribeOnce(t *testing.T) {
+	var once stats.DescribeOnce
+
+	desc := stats.FieldDescription{
+		Measure:     "describe.once",
+		Field:       "count",
+		Description: stats.Description{Help: "Number of calls.", Type: stats.Counter, HasType: true},
+	}
+
+	once.Do("a", desc)
+	once.Do("b", desc)
+
+	for _, measure := range []string{"a.describe.once", "b.describe.once"} {
+		found, ok := stats.Descriptions.Lookup(stats.Key{Measure: measure, Field: "count"})
+		assert.True(t, ok, measure)
+		assert.Equal(t, desc.Description, found, measure)
+	}
+
+	// Registering again with the same prefix is a no-op, even if the registry
+	// was modified in between.
+	stats.Describe("a.describe.once.count", stats.Description{Help: "Changed."})
+	once.Do("a", desc)
+
+	found, _ := stats.Descriptions.Lookup(stats.Key{Measure: "a.describe.once", Field: "count"})
+	assert.Equal(t, "Changed.", found.Help)
+}
+
+func TestEngineReportDescriptions(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	var m struct {
+		count int `metric:"engine.describe.count" type:"counter" help:"Number of reports."`
+	}
+
+	e := stats.NewEngine("prefix", &statstest.Handler{})
+	e.Report(&m)
+
+	desc, ok := stats.Descriptions.Lookup(stats.Key{Measure: "prefix", Field: "engine.describe.count"})
+	assert.True(t, ok)
+	assert.Equal(t, "Number of reports.", desc.Help)
+}
@@ -1,6 +1,9 @@
 package stats
 
 import (
+	"context"
+	"io"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -37,6 +40,31 @@ type Engine struct {
 	// which is a special use case.
 	AllowDuplicateTags bool
 
+	// The rate at which counters and histograms produced by the engine are
+	// sampled, a value between 0 and 1. Measures which are not dropped by the
+	// sampling carry the rate in their SampleRate field so backends can scale
+	// them back up.
+	//
+	// Zero, the default, disables sampling. The sample rate does not apply to
+	// gauges or to measures produced by calls to Report.
+	SampleRate float64
+
+	// The function returning the current time, which the engine uses to
+	// timestamp the measures produced by the methods without a time argument
+	// (including the ones of clocks and bound handles), and which the
+	// collectors of the procstats and httpstats packages use to measure
+	// durations. If nil, time.Now is used. Engines created by WithPrefix and
+	// WithTags inherit it.
+	//
+	// Tests can set this field to control time, see statstest.Clock.
+	Now func() time.Time
+
+	// The registry that callbacks registered by ObserveFunc,
+	// ObserveCounterFunc, and ObserveBatch are placed in. If nil, the
+	// Observers registry is used. Engines created by WithPrefix and WithTags
+	// inherit it.
+	Observers *MetricObservers
+
 	// This cache keeps track of the generated measure structures to avoid
 	// rebuilding them every time a same measure type is seen by the engine.
 	//
@@ -72,17 +100,50 @@ func (e *Engine) Flush() {
 	flush(e.Handler)
 }
 
+// Close flushes and closes eng's handler, or each of the handlers it dispatches
+// measures to if it was created by MultiHandler. Handlers that implement the
+// Closer interface are closed, the others are flushed.
+//
+// The handlers are closed concurrently, and the errors they return are
+// aggregated in the returned error. If ctx is canceled or its deadline expires
+// before all handlers complete, Close returns the error of ctx without waiting
+// for the remaining handlers.
+//
+// Engines created by WithPrefix and WithTags share the handler of their parent
+// engine, so the program only needs to close the base engine. The engine must
+// not be used after it was closed.
+func (e *Engine) Close(ctx context.Context) error {
+	if m, ok := e.Handler.(*multiHandler); ok {
+		return closeHandlers(ctx, m.handlers...)
+	}
+	return closeHandlers(ctx, e.Handler)
+}
+
 // WithPrefix returns a copy of the engine with prefix appended to eng's current
 // prefix and tags set to the merge of eng's current tags and those passed as
 // argument. Both eng and the returned engine share the same handler.
 func (e *Engine) WithPrefix(prefix string, tags ...Tag) *Engine {
 	return &Engine{
-		Handler: e.Handler,
-		Prefix:  e.makeName(prefix),
-		Tags:    mergeTags(e.Tags, tags),
+		Handler:    e.Handler,
+		Prefix:     e.makeName(prefix),
+		Tags:       mergeTags(e.Tags, tags),
+		SampleRate: e.SampleRate,
+		Now:        e.Now,
+		Observers:  e.Observers,
 	}
 }
 
+// WithSampleRate returns a copy of the engine with the sample rate set to rate.
+// Both eng and the returned engine share the same handler.
+//
+// Only a fraction of the counters and histograms produced by the returned
+// engine are passed to the handler, see the SampleRate field for details.
+func (e *Engine) WithSampleRate(rate float64) *Engine {
+	c := e.WithPrefix("")
+	c.SampleRate = rate
+	return c
+}
+
 // WithTags returns a copy of the engine with tags set to the merge of eng's
 // current tags and those passed as arguments. Both eng and the returned engine
 // share the same handler.
@@ -102,7 +163,7 @@ func (e *Engine) IncrAt(time time.Time, name string, tags ...Tag) {
 
 // Add increments by value the counter identified by name and tags.
 func (e *Engine) Add(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Counter, tags...)
+	e.measure(e.CurrentTime(), name, value, Counter, tags...)
 }
 
 // AddAt increments by value the counter identified by name and tags.
@@ -112,7 +173,7 @@ func (e *Engine) AddAt(t time.Time, name string, value interface{}, tags ...Tag)
 
 // Set sets to value the gauge identified by name and tags.
 func (e *Engine) Set(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Gauge, tags...)
+	e.measure(e.CurrentTime(), name, value, Gauge, tags...)
 }
 
 // SetAt sets to value the gauge identified by name and tags.
@@ -122,7 +183,7 @@ func (e *Engine) SetAt(t time.Time, name string, value interface{}, tags ...Tag)
 
 // Observe reports value for the histogram identified by name and tags.
 func (e *Engine) Observe(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Histogram, tags...)
+	e.measure(e.CurrentTime(), name, value, Histogram, tags...)
 }
 
 // ObserveAt reports value for the histogram identified by name and tags.
@@ -130,9 +191,66 @@ func (e *Engine) ObserveAt(t time.Time, name string, value interface{}, tags ...
 	e.measure(t, name, value, Histogram, tags...)
 }
 
+// Unique adds value to the set identified by name and tags, which counts the
+// number of distinct values it received.
+func (e *Engine) Unique(name, value string, tags ...Tag) {
+	e.measure(e.CurrentTime(), name, HashValue(value), Distinct, tags...)
+}
+
+// UniqueAt adds value to the set identified by name and tags, which counts the
+// number of distinct values it received.
+func (e *Engine) UniqueAt(t time.Time, name, value string, tags ...Tag) {
+	e.measure(t, name, HashValue(value), Distinct, tags...)
+}
+
+// IncrContext increments by one the counter identified by name, with the tags
+// on ctx merged with tags.
+func (e *Engine) IncrContext(ctx context.Context, name string, tags ...Tag) {
+	e.AddContext(ctx, name, 1, tags...)
+}
+
+// AddContext increments by value the counter identified by name, with the tags
+// on ctx merged with tags.
+func (e *Engine) AddContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	e.measureContext(ctx, e.CurrentTime(), name, value, Counter, tags...)
+}
+
+// SetContext sets to value the gauge identified by name, with the tags on ctx
+// merged with tags.
+func (e *Engine) SetContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	e.measureContext(ctx, e.CurrentTime(), name, value, Gauge, tags...)
+}
+
+// ObserveContext reports value for the histogram identified by name, with the
+// tags on ctx merged with tags.
+func (e *Engine) ObserveContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	e.measureContext(ctx, e.CurrentTime(), name, value, Histogram, tags...)
+}
+
+// UniqueContext adds value to the set identified by name, with the tags on ctx
+// merged with tags.
+func (e *Engine) UniqueContext(ctx context.Context, name, value string, tags ...Tag) {
+	e.measureContext(ctx, e.CurrentTime(), name, HashValue(value), Distinct, tags...)
+}
+
+// ClockContext returns a new clock identified by name, with the tags on ctx
+// merged with tags.
+func (e *Engine) ClockContext(ctx context.Context, name string, tags ...Tag) *Clock {
+	start := e.CurrentTime()
+	cpy := appendContextTags(make([]Tag, 0, len(tags)+4), ctx)
+	cpy = append(cpy, tags...)
+	return &Clock{
+		name:  name,
+		first: start,
+		last:  start,
+		tags:  cpy,
+		eng:   e,
+	}
+}
+
 // Clock returns a new clock identified by name and tags.
 func (e *Engine) Clock(name string, tags ...Tag) *Clock {
-	return e.ClockAt(name, time.Now(), tags...)
+	return e.ClockAt(name, e.CurrentTime(), tags...)
 }
 
 // ClockAt returns a new clock identified by name and tags with a specified
@@ -200,20 +318,50 @@ func (e *Engine) reportVersionOnce() {
 
 func (e *Engine) measure(t time.Time, name string, value interface{}, ftype FieldType, tags ...Tag) {
 	e.reportVersionOnce()
-	e.measureOne(t, name, value, ftype, tags...)
+
+	if rate, ok := e.sample(ftype); ok {
+		e.measureOne(t, name, value, ftype, rate, nil, tags...)
+	}
+}
+
+func (e *Engine) measureContext(ctx context.Context, t time.Time, name string, value interface{}, ftype FieldType, tags ...Tag) {
+	e.reportVersionOnce()
+
+	if rate, ok := e.sample(ftype); ok {
+		e.measureOne(t, name, value, ftype, rate, getContextTags(ctx), tags...)
+	}
+}
+
+// sample returns whether a measure of type ftype should be produced according
+// to the engine's sample rate, and the rate to set on the measure. Gauges and
+// sets are never sampled since their values cannot be scaled back up.
+func (e *Engine) sample(ftype FieldType) (float64, bool) {
+	rate := e.SampleRate
+	if ftype == Gauge || ftype == Distinct || rate <= 0 || rate >= 1 {
+		return 0, true
+	}
+	return rate, rand.Float64() < rate
 }
 
-func (e *Engine) measureOne(t time.Time, name string, value interface{}, ftype FieldType, tags ...Tag) {
+func (e *Engine) measureOne(t time.Time, name string, value interface{}, ftype FieldType, rate float64, ctx *contextTags, tags ...Tag) {
 	name, field := splitMeasureField(name)
 	mp := measureArrayPool.Get().(*[1]Measure)
 
 	m := &(*mp)[0]
 	m.Name = e.makeName(name) // TODO: figure out how to optimize this
 	m.Fields = append(m.Fields[:0], MakeField(field, value, ftype))
+	m.SampleRate = rate
 	m.Tags = append(m.Tags[:0], e.Tags...)
+	if ctx != nil {
+		m.Tags = ctx.appendTo(m.Tags)
+	}
 	m.Tags = append(m.Tags, tags...)
 
-	if len(tags) != 0 && !e.AllowDuplicateTags && !TagsAreSorted(m.Tags) {
+	if ctx != nil && !e.AllowDuplicateTags {
+		// Context tags may override the engine tags or each other, they must
+		// be deduplicated even when they are already sorted.
+		m.Tags = SortTags(m.Tags)
+	} else if len(tags) != 0 && !e.AllowDuplicateTags && !TagsAreSorted(m.Tags) {
 		SortTags(m.Tags)
 	}
 
@@ -228,9 +376,19 @@ func (e *Engine) measureOne(t time.Time, name string, value interface{}, ftype F
 	}
 
 	m.Name = ""
+	m.SampleRate = 0
 	measureArrayPool.Put(mp)
 }
 
+// CurrentTime returns the current time of the engine, given by its Now field.
+// Collectors reporting measures on the engine use it to compute rates.
+func (e *Engine) CurrentTime() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
 func (e *Engine) makeName(name string) string {
 	return concat(e.Prefix, name)
 }
@@ -239,33 +397,60 @@ var measureArrayPool = sync.Pool{
 	New: func() interface{} { return new([1]Measure) },
 }
 
-// Report calls ReportAt with time.Now() as first argument.
+// Report calls ReportAt with the current time of the engine as first argument.
 func (e *Engine) Report(metrics interface{}, tags ...Tag) {
-	e.ReportAt(time.Now(), metrics, tags...)
+	e.ReportAt(e.CurrentTime(), metrics, tags...)
 }
 
 // ReportAt reports a set of metrics for a given time. The metrics must be of
 // type struct, pointer to struct, or a slice or array to one of those. See
 // MakeMeasures for details about how to make struct types exposing metrics.
+//
+// When metrics implements the MeasureAppender interface, its AppendMeasures
+// method is used to produce the measures instead of reflection.
+//
+// Unless AllowDuplicateTags is set, the tags of the engine take precedence over
+// the tags passed to ReportAt when they have the same name.
 func (e *Engine) ReportAt(t time.Time, metrics interface{}, tags ...Tag) {
+	e.reportAt(t, metrics, nil, tags...)
+}
+
+// ReportContext reports a set of metrics like Report, with the tags on ctx
+// merged with tags. Unless AllowDuplicateTags is set, tags take precedence over
+// the tags on ctx when they have the same name, and the tags of the engine take
+// precedence over both.
+func (e *Engine) ReportContext(ctx context.Context, metrics interface{}, tags ...Tag) {
+	e.reportAt(e.CurrentTime(), metrics, getContextTags(ctx), tags...)
+}
+
+func (e *Engine) reportAt(t time.Time, metrics interface{}, ctx *contextTags, tags ...Tag) {
 	e.reportVersionOnce()
 	var tb *tagsBuffer
 
-	if len(tags) == 0 {
+	if len(tags) == 0 && ctx == nil {
 		// fast path for the common case where there are no dynamic tags
 		tags = e.Tags
 	} else {
 		tb = tagsPool.Get().(*tagsBuffer)
+		if ctx != nil {
+			tb.tags = ctx.appendTo(tb.tags)
+		}
 		tb.append(tags...)
+		// The tags of the engine are appended last so they take precedence
+		// over the tags passed to the Report methods.
 		tb.append(e.Tags...)
+		tags = tb.tags
 		if !e.AllowDuplicateTags {
-			tb.sort()
+			tags = SortTags(tags)
 		}
-		tags = tb.tags
 	}
 
 	mb := measurePool.Get().(*measuresBuffer)
-	mb.measures = appendMeasures(mb.measures[:0], &e.cache, e.Prefix, reflect.ValueOf(metrics), tags...)
+	if a, ok := metrics.(MeasureAppender); ok {
+		mb.measures = a.AppendMeasures(mb.measures[:0], e.Prefix, tags...)
+	} else {
+		mb.measures = appendMeasures(mb.measures[:0], &e.cache, e.Prefix, reflect.ValueOf(metrics), tags...)
+	}
 
 	ms := mb.measures
 	e.Handler.HandleMeasures(t, ms...)
@@ -295,6 +480,12 @@ func Flush() {
 	DefaultEngine.Flush()
 }
 
+// Close flushes and closes the handlers of the default engine, see Engine.Close
+// for details.
+func Close(ctx context.Context) error {
+	return DefaultEngine.Close(ctx)
+}
+
 // WithPrefix returns a copy of the engine with prefix appended to default
 // engine's current prefix and tags set to the merge of engine's current tags
 // and those passed as argument. Both the default engine and the returned engine
@@ -350,6 +541,54 @@ func ObserveAt(time time.Time, name string, value interface{}, tags ...Tag) {
 	DefaultEngine.ObserveAt(time, name, value, tags...)
 }
 
+// Unique adds value to the set identified by name and tags, which counts the
+// number of distinct values it received.
+func Unique(name, value string, tags ...Tag) {
+	DefaultEngine.Unique(name, value, tags...)
+}
+
+// UniqueAt adds value to the set identified by name and tags, which counts the
+// number of distinct values it received.
+func UniqueAt(time time.Time, name, value string, tags ...Tag) {
+	DefaultEngine.UniqueAt(time, name, value, tags...)
+}
+
+// IncrContext increments by one the counter identified by name, with the tags
+// on ctx merged with tags.
+func IncrContext(ctx context.Context, name string, tags ...Tag) {
+	DefaultEngine.IncrContext(ctx, name, tags...)
+}
+
+// AddContext increments by value the counter identified by name, with the tags
+// on ctx merged with tags.
+func AddContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.AddContext(ctx, name, value, tags...)
+}
+
+// SetContext sets to value the gauge identified by name, with the tags on ctx
+// merged with tags.
+func SetContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.SetContext(ctx, name, value, tags...)
+}
+
+// ObserveContext reports value for the histogram identified by name, with the
+// tags on ctx merged with tags.
+func ObserveContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.ObserveContext(ctx, name, value, tags...)
+}
+
+// UniqueContext adds value to the set identified by name, with the tags on ctx
+// merged with tags.
+func UniqueContext(ctx context.Context, name, value string, tags ...Tag) {
+	DefaultEngine.UniqueContext(ctx, name, value, tags...)
+}
+
+// ClockContext returns a new clock identified by name, with the tags on ctx
+// merged with tags, using the default engine.
+func ClockContext(ctx context.Context, name string, tags ...Tag) *Clock {
+	return DefaultEngine.ClockContext(ctx, name, tags...)
+}
+
 // Report is a helper function that delegates to DefaultEngine.
 func Report(metrics interface{}, tags ...Tag) {
 	DefaultEngine.Report(metrics, tags...)
@@ -360,6 +599,26 @@ func ReportAt(time time.Time, metrics interface{}, tags ...Tag) {
 	DefaultEngine.ReportAt(time, metrics, tags...)
 }
 
+// ReportContext is a helper function that delegates to DefaultEngine.
+func ReportContext(ctx context.Context, metrics interface{}, tags ...Tag) {
+	DefaultEngine.ReportContext(ctx, metrics, tags...)
+}
+
+// ObserveFunc is a helper function that delegates to DefaultEngine.
+func ObserveFunc(name string, fn func() float64, tags ...Tag) io.Closer {
+	return DefaultEngine.ObserveFunc(name, fn, tags...)
+}
+
+// ObserveCounterFunc is a helper function that delegates to DefaultEngine.
+func ObserveCounterFunc(name string, fn func() float64, tags ...Tag) io.Closer {
+	return DefaultEngine.ObserveCounterFunc(name, fn, tags...)
+}
+
+// ObserveBatch is a helper function that delegates to DefaultEngine.
+func ObserveBatch(fn func(*Engine)) io.Closer {
+	return DefaultEngine.ObserveBatch(fn)
+}
+
 func progname() (name string) {
 	if args := os.Args; len(args) != 0 {
 		name = filepath.Base(args[0])
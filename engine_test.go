@@ -1,9 +1,11 @@
 package stats_test
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -48,6 +50,10 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Observe produces the expected histogram value",
 			function: testEngineObserve,
 		},
+		{
+			scenario: "calling Engine.Unique produces the expected set value",
+			function: testEngineUnique,
+		},
 		{
 			scenario: "calling Engine.Report produces the expected measures",
 			function: testEngineReport,
@@ -60,6 +66,10 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Report with a slice of metrics produces the expected measures",
 			function: testEngineReportSlice,
 		},
+		{
+			scenario: "calling Engine.Report with a tag of the engine keeps the tag of the engine",
+			function: testEngineReportTagPrecedence,
+		},
 		{
 			scenario: "calling Engine.Clock produces expected metrics",
 			function: testEngineClock,
@@ -72,6 +82,14 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Incr produces expected tags when AllowDuplicateTags is set",
 			function: testEngineAllowDuplicateTags,
 		},
+		{
+			scenario: "calling the Engine methods with a context merges the context tags",
+			function: testEngineContext,
+		},
+		{
+			scenario: "calling Engine.WithSampleRate returns a copy of the engine which samples counters and histograms",
+			function: testEngineWithSampleRate,
+		},
 	}
 
 	initValue := stats.GoVersionReportingEnabled
@@ -160,6 +178,55 @@ func testEngineAllowDuplicateTags(t *testing.T, eng *stats.Engine) {
 	)
 }
 
+func testEngineWithSampleRate(t *testing.T, eng *stats.Engine) {
+	e2 := eng.WithSampleRate(0.5)
+
+	if e2.Prefix != "test" {
+		t.Error("bad prefix:", e2.Prefix)
+	}
+
+	if e3 := e2.WithTags(stats.T("a", "b")); e3.SampleRate != 0.5 {
+		t.Error("bad sample rate inherited by sub-engine:", e3.SampleRate)
+	}
+
+	const n = 1000
+	for i := 0; i != n; i++ {
+		e2.Incr("measure.count")
+		e2.Set("measure.level", i)
+		e2.Unique("measure.users", strconv.Itoa(i))
+	}
+
+	var counters, gauges, sets int
+	for _, m := range eng.Handler.(*statstest.Handler).Measures() {
+		switch m.Fields[0].Type() {
+		case stats.Counter:
+			counters++
+			if m.SampleRate != 0.5 {
+				t.Error("bad sample rate on counter:", m.SampleRate)
+			}
+		case stats.Gauge:
+			gauges++
+			if m.SampleRate != 0 {
+				t.Error("bad sample rate on gauge:", m.SampleRate)
+			}
+		case stats.Distinct:
+			sets++
+		}
+	}
+
+	if gauges != n {
+		t.Error("gauges must not be sampled:", gauges)
+	}
+
+	if sets != n {
+		t.Error("sets must not be sampled:", sets)
+	}
+
+	if counters < n/4 || counters > 3*n/4 {
+		t.Error("bad number of sampled counters:", counters)
+	}
+}
+
 func testEngineIncr(t *testing.T, eng *stats.Engine) {
 	eng.Incr("measure.count")
 	eng.Incr("measure.count", stats.T("type", "testing"))
@@ -232,6 +299,24 @@ func testEngineObserve(t *testing.T, eng *stats.Engine) {
 	)
 }
 
+func testEngineUnique(t *testing.T, eng *stats.Engine) {
+	eng.Unique("measure.users", "alice")
+	eng.Unique("measure.users", "bob", stats.T("type", "testing"))
+
+	checkMeasuresEqual(t, eng,
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("users", stats.HashValue("alice"), stats.Distinct)},
+			Tags:   []stats.Tag{stats.T("service", "test-service")},
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("users", stats.HashValue("bob"), stats.Distinct)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("type", "testing")},
+		},
+	)
+}
+
 func testEngineReport(t *testing.T, eng *stats.Engine) {
 	m := struct {
 		Count int `metric:"count" type:"counter"`
@@ -254,6 +339,29 @@ func testEngineReport(t *testing.T, eng *stats.Engine) {
 	)
 }
 
+func testEngineReportTagPrecedence(t *testing.T, eng *stats.Engine) {
+	m := struct {
+		Count int `metric:"count" type:"counter"`
+	}{42}
+
+	eng.Report(m, stats.T("service", "other-service"), stats.T("type", "testing"))
+	ctx := stats.ContextWithTags(context.Background(), stats.T("service", "context-service"), stats.T("type", "context"))
+	eng.ReportContext(ctx, m, stats.T("type", "testing"))
+
+	checkMeasuresEqual(t, eng,
+		stats.Measure{
+			Name:   "test",
+			Fields: []stats.Field{stats.MakeField("count", 42, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("type", "testing")},
+		},
+		stats.Measure{
+			Name:   "test",
+			Fields: []stats.Field{stats.MakeField("count", 42, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("type", "testing")},
+		},
+	)
+}
+
 func testEngineReportArray(t *testing.T, eng *stats.Engine) {
 	m := [2]struct {
 		Count int `metric:"count" type:"counter"`
@@ -300,6 +408,40 @@ func testEngineReportSlice(t *testing.T, eng *stats.Engine) {
 	)
 }
 
+func testEngineContext(t *testing.T, eng *stats.Engine) {
+	ctx := stats.ContextWithTags(context.Background(), stats.T("route", "/"))
+	m := struct {
+		Count int `metric:"count" type:"counter"`
+	}{42}
+
+	eng.IncrContext(ctx, "measure.count")
+	eng.AddContext(ctx, "measure.count", 2, stats.T("type", "testing"))
+	eng.SetContext(context.Background(), "measure.level", 1)
+	eng.ObserveContext(ctx, "measure.size", 3)
+	eng.ReportContext(ctx, m, stats.T("type", "testing"))
+	eng.ClockContext(ctx, "measure.rtt").StopAt(time.Now())
+
+	found := measures(t, eng)
+	tags := [][]stats.Tag{
+		{stats.T("route", "/"), stats.T("service", "test-service")},
+		{stats.T("route", "/"), stats.T("service", "test-service"), stats.T("type", "testing")},
+		{stats.T("service", "test-service")},
+		{stats.T("route", "/"), stats.T("service", "test-service")},
+		{stats.T("route", "/"), stats.T("service", "test-service"), stats.T("type", "testing")},
+		{stats.T("route", "/"), stats.T("service", "test-service"), stats.T("stamp", "total")},
+	}
+
+	if len(found) != len(tags) {
+		t.Fatalf("expected %d measures got %d", len(tags), len(found))
+	}
+
+	for i, m := range found {
+		if !reflect.DeepEqual(m.Tags, tags[i]) {
+			t.Errorf("tag mismatch on %s, expected %v, got %v", m.Name, tags[i], m.Tags)
+		}
+	}
+}
+
 func testEngineClock(t *testing.T, eng *stats.Engine) {
 	c := eng.Clock("upload", stats.T("f", "img.jpg"))
 	c.Stamp("compress")
@@ -698,3 +840,126 @@ func TestVersionMetricsPrometheusNoTimestamp(t *testing.T) {
 		}
 	}
 }
+
+func TestEngineContextDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not deterministic with the race detector")
+	}
+
+	e := stats.NewEngine("test", stats.Discard, stats.T("service", "test-service"))
+	ctx := stats.ContextWithTags(context.Background(), stats.T("route", "/"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		e.IncrContext(ctx, "calls", stats.T("type", "testing"))
+	})
+
+	if allocs != 0 {
+		t.Error("unexpected allocations:", allocs)
+	}
+}
+
+type appenderMetrics struct {
+	calls struct {
+		count int           `metric:"count" type:"counter"`
+		time  time.Duration `metric:"time"  type:"histogram"`
+	} `metric:"calls"`
+
+	host string `tag:"host"`
+}
+
+func (m *appenderMetrics) AppendMeasures(measures []stats.Measure, prefix string, tags ...stats.Tag) []stats.Measure {
+	return stats.AppendMeasure(measures, prefix, "calls", []stats.Field{
+		stats.IntField("count", int64(m.calls.count), stats.Counter),
+		stats.DurationField("time", m.calls.time, stats.Histogram),
+	}, []stats.Tag{
+		{Name: "host", Value: m.host},
+	}, tags)
+}
+
+func TestEngineReportMeasureAppender(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h, stats.T("service", "test-service"))
+
+	m := &appenderMetrics{host: "localhost"}
+	m.calls.count = 1
+	m.calls.time = time.Second
+
+	e.Report(m, stats.T("type", "testing"))
+	e.Report([1]appenderMetrics{*m}, stats.T("type", "testing"))
+
+	found := measures(t, e)
+	if len(found) != 2 {
+		t.Fatal("bad number of measures:", len(found))
+	}
+
+	// The first measure was produced by AppendMeasures, the second one with
+	// reflection.
+	if !reflect.DeepEqual(found[0], found[1]) {
+		t.Error("bad measures:")
+		t.Logf("expected: %#v", found[1])
+		t.Logf("found:    %#v", found[0])
+	}
+
+	if found[0].Name != "test.calls" {
+		t.Error("bad measure name:", found[0].Name)
+	}
+}
+
+func TestEngineReportMeasureAppenderDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not deterministic with the race detector")
+	}
+
+	e := stats.NewEngine("", stats.Discard, stats.T("service", "test-service"))
+	m := &appenderMetrics{host: "localhost"}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		e.Report(m)
+	})
+
+	if allocs != 0 {
+		t.Error("unexpected allocations:", allocs)
+	}
+}
+
+func TestEngineNow(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	var times []time.Time
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := statstest.NewClock(now)
+
+	e := stats.NewEngine("", stats.HandlerFunc(func(t time.Time, _ ...stats.Measure) {
+		times = append(times, t)
+	}))
+	e.Now = clock.Now
+
+	e.Incr("a")
+	e.Set("b", 1)
+	e.Observe("c", 1)
+	e.WithPrefix("sub").Incr("d")
+	e.WithTags(stats.T("x", "y")).WithSampleRate(1).Incr("e")
+	e.Counter("f").Incr()
+	e.Gauge("g").Set(1)
+	e.Report(struct {
+		count int `metric:"count" type:"counter"`
+	}{1})
+
+	if len(times) != 8 {
+		t.Fatalf("expected 8 calls to the handler, got %d", len(times))
+	}
+	for i, tm := range times {
+		if !tm.Equal(now) {
+			t.Errorf("measure %d: time mismatch: %v != %v", i, tm, now)
+		}
+	}
+	if tm := e.CurrentTime(); !tm.Equal(now) {
+		t.Errorf("current time mismatch: %v != %v", tm, now)
+	}
+}
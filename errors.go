@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// ErrorHandler is an interface implemented by types that handle the errors
+// that measure handlers encounter when sending measures to their backend.
+//
+// Handlers don't return errors from HandleMeasures or Flush, so failures to
+// write to a backend are passed to an ErrorHandler instead, which may log
+// them, count them, or alert on them.
+type ErrorHandler interface {
+	// HandleError is called with the errors encountered by a measure handler.
+	// It may be called concurrently from multiple goroutines.
+	HandleError(err error)
+}
+
+// ErrorHandlerFunc is a type alias making it possible to use simple functions
+// as error handlers.
+type ErrorHandlerFunc func(error)
+
+// HandleError calls f, satisfies the ErrorHandler interface.
+func (f ErrorHandlerFunc) HandleError(err error) {
+	f(err)
+}
+
+var errorHandler atomic.Pointer[ErrorHandler]
+
+// SetErrorHandler sets the error handler of the program, which receives the
+// errors of measure handlers that weren't configured with their own. Passing
+// nil restores the default, which logs errors with the standard logger.
+func SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		errorHandler.Store(nil)
+	} else {
+		errorHandler.Store(&handler)
+	}
+}
+
+// HandleError passes err to the error handler set by SetErrorHandler.
+func HandleError(err error) {
+	if h := errorHandler.Load(); h != nil {
+		(*h).HandleError(err)
+	} else {
+		log.Print(err)
+	}
+}
+
+// HandleErrorWith passes err to handler, or to the error handler of the program
+// if handler is nil. It is intended to be used by measure handlers which have
+// an optional ErrorHandler in their configuration.
+func HandleErrorWith(handler ErrorHandler, err error) {
+	if handler != nil {
+		handler.HandleError(err)
+	} else {
+		HandleError(err)
+	}
+}
+
+// HandlerStats is a snapshot of the counters of a measure handler which sends
+// measures to a backend, see HandlerCounters. The values are totals since the
+// handler was created, a program polls them to alert on a broken pipeline.
+type HandlerStats struct {
+	// Number of bytes written to the backend.
+	BytesSent uint64
+
+	// Number of packets or requests successfully written to the backend.
+	PacketsSent uint64
+
+	// Number of writes to the backend that failed.
+	WriteErrors uint64
+
+	// Number of serialized metrics that were discarded because they were
+	// larger than the maximum packet size of the backend.
+	OversizeDrops uint64
+
+	// Number of metrics that were discarded because they could not be sent.
+	// A metric is what the backend receives for a measure: one line per field
+	// for datadog, one line per measure for influxdb, and one metric per
+	// series for otlp.
+	DroppedMetrics uint64
+}
+
+// HandlerCounters is a set of counters tracking the activity of a measure
+// handler sending measures to a backend. The methods are safe to call
+// concurrently from multiple goroutines.
+//
+// The zero value is ready to use.
+type HandlerCounters struct {
+	bytesSent      atomic.Uint64
+	packetsSent    atomic.Uint64
+	writeErrors    atomic.Uint64
+	oversizeDrops  atomic.Uint64
+	droppedMetrics atomic.Uint64
+}
+
+// Sent records that a packet or request of size bytes was sent.
+func (c *HandlerCounters) Sent(size int) {
+	c.packetsSent.Add(1)
+	c.bytesSent.Add(uint64(size))
+}
+
+// WriteError records a failed write.
+func (c *HandlerCounters) WriteError() {
+	c.writeErrors.Add(1)
+}
+
+// Oversize records that a metric too large to be sent was discarded.
+func (c *HandlerCounters) Oversize() {
+	c.oversizeDrops.Add(1)
+}
+
+// Dropped records that n metrics were discarded.
+func (c *HandlerCounters) Dropped(n int) {
+	c.droppedMetrics.Add(uint64(n))
+}
+
+// Stats returns a snapshot of the counters.
+func (c *HandlerCounters) Stats() HandlerStats {
+	return HandlerStats{
+		BytesSent:      c.bytesSent.Load(),
+		PacketsSent:    c.packetsSent.Load(),
+		WriteErrors:    c.writeErrors.Load(),
+		OversizeDrops:  c.oversizeDrops.Load(),
+		DroppedMetrics: c.droppedMetrics.Load(),
+	}
+}
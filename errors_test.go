@@ -0,0 +1,46 @@
+package stats_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestErrorHandler(t *testing.T) {
+	defer stats.SetErrorHandler(nil)
+
+	var global, local []error
+	stats.SetErrorHandler(stats.ErrorHandlerFunc(func(err error) { global = append(global, err) }))
+
+	errA := errors.New("A")
+	errB := errors.New("B")
+
+	stats.HandleError(errA)
+	stats.HandleErrorWith(nil, errB)
+	stats.HandleErrorWith(stats.ErrorHandlerFunc(func(err error) { local = append(local, err) }), errA)
+
+	assert.Equal(t, []error{errA, errB}, global)
+	assert.Equal(t, []error{errA}, local)
+}
+
+func TestHandlerCounters(t *testing.T) {
+	var c stats.HandlerCounters
+
+	c.Sent(10)
+	c.Sent(32)
+	c.WriteError()
+	c.Oversize()
+	c.Dropped(3)
+	c.Dropped(2)
+
+	assert.Equal(t, stats.HandlerStats{
+		BytesSent:      42,
+		PacketsSent:    2,
+		WriteErrors:    1,
+		OversizeDrops:  1,
+		DroppedMetrics: 5,
+	}, c.Stats())
+}
@@ -1,6 +1,9 @@
 package stats
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
 
 // A Field is a key/value type that represents a single metric in a Measure.
 type Field struct {
@@ -15,6 +18,61 @@ func MakeField(name string, value interface{}, ftype FieldType) Field {
 	return f
 }
 
+// BoolField constructs and returns a new Field of name and ftype, holding the
+// boolean value v. Unlike MakeField, it does not convert v to an interface.
+func BoolField(name string, v bool, ftype FieldType) Field {
+	return makeField(name, boolValue(v), ftype)
+}
+
+// IntField constructs and returns a new Field of name and ftype, holding the
+// signed integer value v. Unlike MakeField, it does not convert v to an
+// interface.
+func IntField(name string, v int64, ftype FieldType) Field {
+	return makeField(name, int64Value(v), ftype)
+}
+
+// UintField constructs and returns a new Field of name and ftype, holding the
+// unsigned integer value v. Unlike MakeField, it does not convert v to an
+// interface.
+func UintField(name string, v uint64, ftype FieldType) Field {
+	return makeField(name, uint64Value(v), ftype)
+}
+
+// FloatField constructs and returns a new Field of name and ftype, holding the
+// floating point value v. Unlike MakeField, it does not convert v to an
+// interface.
+func FloatField(name string, v float64, ftype FieldType) Field {
+	return makeField(name, float64Value(v), ftype)
+}
+
+// DurationField constructs and returns a new Field of name and ftype, holding
+// the duration v. Unlike MakeField, it does not convert v to an interface.
+func DurationField(name string, v time.Duration, ftype FieldType) Field {
+	return makeField(name, durationValue(v), ftype)
+}
+
+// HashValue returns a Value identifying s, to use strings as the values of
+// Distinct fields. The value is a 64 bits FNV-1a hash of s, so the same string
+// is identified by the same value across programs.
+func HashValue(s string) Value {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return uint64Value(h)
+}
+
+func makeField(name string, value Value, ftype FieldType) Field {
+	f := Field{Name: name, Value: value}
+	f.setType(ftype)
+	return f
+}
+
 // Type returns the type of f.
 func (f Field) Type() FieldType {
 	return FieldType(f.Value.pad)
@@ -53,6 +111,11 @@ const (
 
 	// Histogram represents metrics to observe the distribution of values.
 	Histogram
+
+	// Distinct represents metrics counting the number of distinct values they
+	// were set to, called sets in the statsd protocol. The values identify the
+	// members of the set, see HashValue to use strings as members.
+	Distinct
 )
 
 func (t FieldType) String() string {
@@ -63,6 +126,8 @@ func (t FieldType) String() string {
 		return "gauge"
 	case Histogram:
 		return "histogram"
+	case Distinct:
+		return "set"
 	}
 	return ""
 }
@@ -76,6 +141,8 @@ func (t FieldType) GoString() string {
 		return "stats.Gauge"
 	case Histogram:
 		return "stats.Histogram"
+	case Distinct:
+		return "stats.Distinct"
 	default:
 		return "stats.FieldType(" + strconv.Itoa(int(t)) + ")"
 	}
@@ -10,6 +10,21 @@ func TestFieldSize(t *testing.T) {
 	t.Log("field size:", size)
 }
 
+func TestHashValue(t *testing.T) {
+	// Test vectors of the FNV-1a 64 bits hash function.
+	tests := map[string]uint64{
+		"":       0xcbf29ce484222325,
+		"a":      0xaf63dc4c8601ec8c,
+		"foobar": 0x85944171f73967e8,
+	}
+
+	for s, h := range tests {
+		if v := HashValue(s); v.Type() != Uint || v.Uint() != h {
+			t.Errorf("HashValue(%q): expected %#x, got %#v", s, h, v)
+		}
+	}
+}
+
 func BenchmarkAssign40BytesStruct(b *testing.B) {
 	type S struct {
 		a string
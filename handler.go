@@ -1,6 +1,11 @@
 package stats
 
-import "time"
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
 
 // The Handler interface is implemented by types that produce measures to
 // various metric collection backends.
@@ -27,6 +32,64 @@ func flush(h Handler) {
 	}
 }
 
+// Closer is an interface implemented by measure handlers which buffer measures
+// or hold resources that must be released when the program shuts down. It has
+// the same method set as io.Closer, the interface documents the contract that
+// the handlers of this package and its sub-packages follow.
+//
+// Close must send the measures buffered by the handler before releasing its
+// resources, and return the errors that prevented it from doing so. Measures
+// handled after Close was called may be dropped. Close may be called multiple
+// times, the calls after the first one may do nothing.
+type Closer interface {
+	Close() error
+}
+
+// closeHandlers flushes and closes the given handlers concurrently, returning
+// early with the error of ctx if it is canceled before all handlers complete.
+// Handlers which do not implement Closer are flushed.
+func closeHandlers(ctx context.Context, handlers ...Handler) error {
+	return eachHandler(ctx, handlers, closeHandler)
+}
+
+// eachHandler calls fn with each of the given handlers concurrently, returning
+// early with the error of ctx if it is canceled before all calls complete.
+func eachHandler(ctx context.Context, handlers []Handler, fn func(Handler) error) error {
+	errs := make([]error, len(handlers))
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i, h := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(h)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return errors.Join(errs...)
+	case <-ctx.Done():
+		// The handlers that haven't completed keep running in the background,
+		// their errors cannot be safely read.
+		return ctx.Err()
+	}
+}
+
+func closeHandler(h Handler) error {
+	if c, ok := h.(Closer); ok {
+		return c.Close()
+	}
+	flush(h)
+	return nil
+}
+
 // HandlerFunc is a type alias making it possible to use simple functions as
 // measure handlers.
 type HandlerFunc func(time.Time, ...Measure)
@@ -74,6 +137,12 @@ func (m *multiHandler) Flush() {
 	}
 }
 
+// Close closes all handlers (or flushes them if they don't implement Closer),
+// and returns the aggregated errors, satisfies the Closer interface.
+func (m *multiHandler) Close() error {
+	return closeHandlers(context.Background(), m.handlers...)
+}
+
 // FilteredHandler constructs a Handler that processes Measures with `filter` before forwarding to `h`.
 func FilteredHandler(h Handler, filter func([]Measure) []Measure) Handler {
 	return &filteredHandler{handler: h, filter: filter}
@@ -92,6 +161,10 @@ func (h *filteredHandler) Flush() {
 	flush(h.handler)
 }
 
+func (h *filteredHandler) Close() error {
+	return closeHandler(h.handler)
+}
+
 // Discard is a handler that doesn't do anything with the measures it receives.
 var Discard = &discard{}
 
@@ -1,10 +1,14 @@
 package stats_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/relabel"
+	"github.com/segmentio/stats/v5/sketch"
 	"github.com/segmentio/stats/v5/statstest"
 
 	"github.com/stretchr/testify/assert"
@@ -44,6 +48,94 @@ func TestMultiHandler(t *testing.T) {
 	})
 }
 
+type closingHandler struct {
+	statstest.Handler
+	err    error
+	wait   chan struct{}
+	closed int
+}
+
+func (h *closingHandler) Close() error {
+	if h.wait != nil {
+		<-h.wait
+	}
+	h.closed++
+	return h.err
+}
+
+func TestEngineClose(t *testing.T) {
+	t.Run("closing an engine closes or flushes each handler of a multi-handler", func(t *testing.T) {
+		errClose := errors.New("close")
+		h1 := &closingHandler{}
+		h2 := &closingHandler{err: errClose}
+		h3 := &statstest.Handler{}
+
+		e := stats.NewEngine("test", stats.MultiHandler(h1, h2, h3))
+		err := e.Close(context.Background())
+
+		assert.ErrorIs(t, err, errClose)
+		assert.Equal(t, 1, h1.closed)
+		assert.Equal(t, 1, h2.closed)
+		assert.Equal(t, 1, h3.FlushCalls())
+	})
+
+	t.Run("closing an engine returns when the context is canceled", func(t *testing.T) {
+		h := &closingHandler{wait: make(chan struct{})}
+		defer close(h.wait)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		e := stats.NewEngine("test", stats.MultiHandler(h, &statstest.Handler{}))
+		err := e.Close(ctx)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("closing a filtered handler closes the underlying handler", func(t *testing.T) {
+		h := &closingHandler{}
+		f := stats.FilteredHandler(h, func(ms []stats.Measure) []stats.Measure { return ms })
+
+		assert.NoError(t, f.(stats.Closer).Close())
+		assert.Equal(t, 1, h.closed)
+	})
+
+	t.Run("closing an engine closes the handler underneath each wrapper", func(t *testing.T) {
+		wrappers := map[string]func(stats.Handler) stats.Handler{
+			"async": func(h stats.Handler) stats.Handler {
+				return &stats.AsyncHandler{Handler: h}
+			},
+			"aggregating": func(h stats.Handler) stats.Handler {
+				return &stats.AggregatingHandler{Handler: h, Interval: -1}
+			},
+			"cardinality": func(h stats.Handler) stats.Handler {
+				return stats.NewCardinalityLimit(h, 10, stats.DropOverflow)
+			},
+			"sketch": func(h stats.Handler) stats.Handler {
+				return &sketch.Handler{Handler: h, Interval: -1}
+			},
+			"relabel": func(h stats.Handler) stats.Handler {
+				r, err := relabel.NewHandler(h)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return r
+			},
+		}
+
+		for name, wrap := range wrappers {
+			t.Run(name, func(t *testing.T) {
+				h := &closingHandler{}
+				e := stats.NewEngine("test", wrap(h))
+				e.Incr("count")
+
+				assert.NoError(t, e.Close(context.Background()))
+				assert.Equal(t, 1, h.closed)
+			})
+		}
+	})
+}
+
 func flush(h stats.Handler) {
 	if f, ok := h.(stats.Flusher); ok {
 		f.Flush()
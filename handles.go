@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// CounterHandle is a counter bound to a name and set of tags, created by calls
+// to Engine.Counter.
+//
+// The name and tags of the counter are resolved once when the handle is
+// created, so incrementing the counter doesn't allocate memory. Handles are
+// safe to use concurrently from multiple goroutines.
+type CounterHandle struct {
+	handle
+}
+
+// Counter returns a handle to the counter identified by name and tags.
+func (e *Engine) Counter(name string, tags ...Tag) *CounterHandle {
+	return &CounterHandle{e.bind(name, Counter, tags)}
+}
+
+// Incr increments the counter by one.
+func (c *CounterHandle) Incr() {
+	c.AddAt(c.eng.CurrentTime(), 1)
+}
+
+// Add increments the counter by value.
+func (c *CounterHandle) Add(value int64) {
+	c.AddAt(c.eng.CurrentTime(), value)
+}
+
+// AddAt increments the counter by value, with t as the time of the measure.
+func (c *CounterHandle) AddAt(t time.Time, value int64) {
+	c.measure(t, int64Value(value))
+}
+
+// GaugeHandle is a gauge bound to a name and set of tags, created by calls to
+// Engine.Gauge.
+//
+// The name and tags of the gauge are resolved once when the handle is created,
+// so setting the gauge doesn't allocate memory. Handles are safe to use
+// concurrently from multiple goroutines.
+type GaugeHandle struct {
+	handle
+}
+
+// Gauge returns a handle to the gauge identified by name and tags.
+func (e *Engine) Gauge(name string, tags ...Tag) *GaugeHandle {
+	return &GaugeHandle{e.bind(name, Gauge, tags)}
+}
+
+// Set sets the gauge to value.
+func (g *GaugeHandle) Set(value float64) {
+	g.SetAt(g.eng.CurrentTime(), value)
+}
+
+// SetAt sets the gauge to value, with t as the time of the measure.
+func (g *GaugeHandle) SetAt(t time.Time, value float64) {
+	g.measure(t, float64Value(value))
+}
+
+// HistogramHandle is a histogram bound to a name and set of tags, created by
+// calls to Engine.Histogram.
+//
+// The name and tags of the histogram are resolved once when the handle is
+// created, so observing values doesn't allocate memory. Handles are safe to use
+// concurrently from multiple goroutines.
+type HistogramHandle struct {
+	handle
+}
+
+// Histogram returns a handle to the histogram identified by name and tags.
+func (e *Engine) Histogram(name string, tags ...Tag) *HistogramHandle {
+	return &HistogramHandle{e.bind(name, Histogram, tags)}
+}
+
+// Observe reports the duration d to the histogram.
+func (h *HistogramHandle) Observe(d time.Duration) {
+	h.ObserveAt(h.eng.CurrentTime(), d)
+}
+
+// ObserveAt reports the duration d to the histogram, with t as the time of the
+// measure.
+func (h *HistogramHandle) ObserveAt(t time.Time, d time.Duration) {
+	h.measure(t, durationValue(d))
+}
+
+type handle struct {
+	eng    *Engine
+	name   string
+	field  string
+	ftype  FieldType
+	tags   []Tag
+	tagSet TagSet
+}
+
+func (e *Engine) bind(name string, ftype FieldType, tags []Tag) handle {
+	name, field := splitMeasureField(name)
+
+	h := handle{
+		eng:   e,
+		name:  e.makeName(name),
+		field: field,
+		ftype: ftype,
+	}
+
+	if !e.AllowDuplicateTags {
+		// The tags are sorted and hashed once, handlers identify the series
+		// of the measures produced by the handle with the hash of the set.
+		h.tagSet = NewTagSet(append(copyTags(e.Tags), tags...)...)
+		h.tags = h.tagSet.Tags()
+	} else if len(tags) == 0 {
+		h.tags = e.Tags
+	} else {
+		h.tags = make([]Tag, 0, len(e.Tags)+len(tags))
+		h.tags = append(h.tags, e.Tags...)
+		h.tags = append(h.tags, tags...)
+	}
+
+	return h
+}
+
+func (h *handle) measure(t time.Time, value Value) {
+	e := h.eng
+	e.reportVersionOnce()
+
+	rate, ok := e.sample(h.ftype)
+	if !ok {
+		return
+	}
+
+	mp := handleMeasurePool.Get().(*[1]Measure)
+
+	m := &(*mp)[0]
+	m.Name = h.name
+	m.Fields = append(m.Fields[:0], Field{Name: h.field, Value: value})
+	m.Fields[0].setType(h.ftype)
+	m.Tags = h.tags
+	m.TagSet = h.tagSet
+	m.SampleRate = rate
+
+	e.Handler.HandleMeasures(t, (*mp)[:]...)
+
+	// The tags are shared by all measures produced by the handle, they must
+	// not be reset like the other fields.
+	m.Fields[0] = Field{}
+	m.Tags = nil
+	m.TagSet = TagSet{}
+	m.Name = ""
+	m.SampleRate = 0
+	handleMeasurePool.Put(mp)
+}
+
+var handleMeasurePool = sync.Pool{
+	New: func() interface{} { return &[1]Measure{{Fields: make([]Field, 0, 1)}} },
+}
@@ -0,0 +1,128 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestEngineHandles(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h, stats.T("service", "test-service"))
+
+	c := e.Counter("measure.count", stats.T("type", "testing"), stats.T("a", "b"))
+	g := e.Gauge("measure.level")
+	o := e.Histogram("measure.rtt")
+
+	c.Incr()
+	c.Add(41)
+	g.Set(0.5)
+	o.Observe(time.Second)
+
+	// The measures produced by handles carry the interned set of their tags.
+	tags1 := stats.NewTagSet(stats.T("type", "testing"), stats.T("a", "b"), stats.T("service", "test-service"))
+	tags2 := stats.NewTagSet(stats.T("service", "test-service"))
+
+	checkMeasuresEqual(t, e,
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("count", int64(1), stats.Counter)},
+			Tags:   []stats.Tag{stats.T("a", "b"), stats.T("service", "test-service"), stats.T("type", "testing")},
+			TagSet: tags1,
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("count", int64(41), stats.Counter)},
+			Tags:   []stats.Tag{stats.T("a", "b"), stats.T("service", "test-service"), stats.T("type", "testing")},
+			TagSet: tags1,
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("level", 0.5, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("service", "test-service")},
+			TagSet: tags2,
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("rtt", time.Second, stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("service", "test-service")},
+			TagSet: tags2,
+		},
+	)
+}
+
+func TestEngineHandlesDoNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not deterministic with the race detector")
+	}
+
+	e := stats.NewEngine("test", stats.Discard, stats.T("service", "test-service"))
+	c := e.Counter("calls", stats.T("type", "testing"))
+	g := e.Gauge("level", stats.T("type", "testing"))
+	o := e.Histogram("rtt", stats.T("type", "testing"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Add(1)
+		g.Set(1)
+		o.Observe(time.Millisecond)
+	})
+
+	if allocs != 0 {
+		t.Error("unexpected allocations:", allocs)
+	}
+}
+
+func BenchmarkEngineHandles(b *testing.B) {
+	e := stats.NewEngine("test", stats.Discard, stats.T("service", "test-service"))
+
+	b.Run("Engine.Add", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			e.Add("calls", 1, stats.T("type", "testing"))
+		}
+	})
+
+	b.Run("CounterHandle.Add", func(b *testing.B) {
+		c := e.Counter("calls", stats.T("type", "testing"))
+		b.ReportAllocs()
+		for b.Loop() {
+			c.Add(1)
+		}
+	})
+
+	b.Run("Engine.Set", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			e.Set("level", 1.0, stats.T("type", "testing"))
+		}
+	})
+
+	b.Run("GaugeHandle.Set", func(b *testing.B) {
+		g := e.Gauge("level", stats.T("type", "testing"))
+		b.ReportAllocs()
+		for b.Loop() {
+			g.Set(1.0)
+		}
+	})
+
+	b.Run("Engine.Observe", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			e.Observe("rtt", time.Millisecond, stats.T("type", "testing"))
+		}
+	})
+
+	b.Run("HistogramHandle.Observe", func(b *testing.B) {
+		o := e.Histogram("rtt", stats.T("type", "testing"))
+		b.ReportAllocs()
+		for b.Loop() {
+			o.Observe(time.Millisecond)
+		}
+	})
+}
@@ -16,7 +16,7 @@ func RequestWithTags(req *http.Request, tags ...stats.Tag) *http.Request {
 	if stats.ContextAddTags(req.Context(), tags...) {
 		return req.WithContext(req.Context())
 	}
-	return req.WithContext(stats.ContextWithTags(req.Context(), tags...))
+	return req.WithContext(stats.ContextWithInheritedTags(req.Context(), tags...))
 }
 
 // RequestTags returns the tags associated with the request, if any.  It
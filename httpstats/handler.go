@@ -32,13 +32,16 @@ type handler struct {
 func (h *handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	m := &metrics{}
 
-	req = RequestWithTags(req)
+	// Each request gets its own tag scope, even if the server's base context
+	// already has one, so tags added by the handler don't leak to other
+	// requests.
+	req = req.WithContext(stats.ContextWithInheritedTags(req.Context()))
 	w := &responseWriter{
 		ResponseWriter: res,
 		eng:            h.eng,
 		req:            req,
 		metrics:        m,
-		start:          time.Now(),
+		start:          h.eng.CurrentTime(),
 	}
 	defer w.complete()
 
@@ -107,7 +110,7 @@ func (w *responseWriter) complete() {
 		w.status = http.StatusOK
 	}
 
-	now := time.Now()
+	now := w.eng.CurrentTime()
 	res := &http.Response{
 		ProtoMajor:    w.req.ProtoMajor,
 		ProtoMinor:    w.req.ProtoMinor,
@@ -1,11 +1,15 @@
 package httpstats
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	stats "github.com/segmentio/stats/v5"
 	"github.com/segmentio/stats/v5/statstest"
@@ -90,3 +94,58 @@ func TestHandlerHijack(t *testing.T) {
 		t.Log(m)
 	}
 }
+
+func TestHandlerRequestTagsDoNotLeak(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	// A tag scope on the base context is shared by all requests, the handler
+	// must create a new scope for each request.
+	base := stats.ContextWithTags(context.Background(), stats.T("server", "test"))
+	handler := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_ = RequestWithTags(req, stats.T("path", req.URL.Path))
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	for _, path := range []string{"/a", "/b"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(base)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []stats.Tag{stats.T("server", "test")}, stats.ContextTags(base))
+
+	for _, m := range h.Measures() {
+		if m.Name != "http" {
+			continue
+		}
+		var paths []string
+		for _, tag := range m.Tags {
+			if tag.Name == "path" {
+				paths = append(paths, tag.Value)
+			}
+		}
+		assert.Len(t, paths, 1, "measure %s has tags from other requests", m.Name)
+	}
+}
+
+func TestHandlerNow(t *testing.T) {
+	h := &statstest.Handler{}
+	clock := statstest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	e := stats.NewEngine("", h)
+	e.Now = clock.Now
+
+	server := httptest.NewServer(NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		clock.Add(150 * time.Millisecond)
+		res.WriteHeader(http.StatusOK)
+	})))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	server.Close()
+
+	assert.Equal(t, []time.Duration{150 * time.Millisecond}, h.Select("http.rtt.seconds").Durations())
+}
@@ -120,10 +120,12 @@ func (r *responseBody) close() {
 }
 
 func (r *responseBody) complete() {
-	r.metrics.observeResponse(r.res, r.op, r.bytes, time.Since(r.start))
+	r.metrics.observeResponse(r.res, r.op, r.bytes, r.eng.CurrentTime().Sub(r.start))
 	r.eng.ReportAt(r.start, r.metrics)
 }
 
+//go:generate go run github.com/segmentio/stats/v5/cmd/statsgen -type=metrics
+
 type metrics struct {
 	http struct {
 		err struct {
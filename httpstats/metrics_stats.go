@@ -0,0 +1,88 @@
+// Code generated by "statsgen -type=metrics"; DO NOT EDIT.
+
+package httpstats
+
+import stats "github.com/segmentio/stats/v5"
+
+// AppendMeasures satisfies the stats.MeasureAppender interface.
+func (m *metrics) AppendMeasures(measures []stats.Measure, prefix string, tags ...stats.Tag) []stats.Measure {
+	measures = stats.AppendMeasure(measures, prefix, "http.error", []stats.Field{
+		stats.IntField("count", int64(m.http.err.count), stats.Counter),
+	}, []stats.Tag{
+		{Name: "http_req_content_charset", Value: m.http.contentCharset},
+		{Name: "http_req_content_encoding", Value: m.http.contentEncoding},
+		{Name: "http_req_content_type", Value: m.http.contentType},
+		{Name: "http_req_host", Value: m.http.host},
+		{Name: "http_req_method", Value: m.http.method},
+		{Name: "http_req_path", Value: m.http.path},
+		{Name: "http_req_protocol", Value: m.http.protocol},
+		{Name: "http_req_transfer_encoding", Value: m.http.transferEncoding},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "http.message", []stats.Field{
+		stats.IntField("count", int64(m.http.req.msg.count), stats.Counter),
+		stats.IntField("header.size", int64(m.http.req.msg.headerSize), stats.Histogram),
+		stats.IntField("header.bytes", int64(m.http.req.msg.headerBytes), stats.Histogram),
+		stats.IntField("body.bytes", int64(m.http.req.msg.bodyBytes), stats.Histogram),
+	}, []stats.Tag{
+		{Name: "http_req_content_charset", Value: m.http.contentCharset},
+		{Name: "http_req_content_encoding", Value: m.http.contentEncoding},
+		{Name: "http_req_content_type", Value: m.http.contentType},
+		{Name: "http_req_host", Value: m.http.host},
+		{Name: "http_req_method", Value: m.http.method},
+		{Name: "http_req_path", Value: m.http.path},
+		{Name: "http_req_protocol", Value: m.http.protocol},
+		{Name: "http_req_transfer_encoding", Value: m.http.transferEncoding},
+		{Name: "operation", Value: m.http.req.operation},
+		{Name: "type", Value: m.http.req.msgtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "http.message", []stats.Field{
+		stats.IntField("count", int64(m.http.res.msg.count), stats.Counter),
+		stats.IntField("header.size", int64(m.http.res.msg.headerSize), stats.Histogram),
+		stats.IntField("header.bytes", int64(m.http.res.msg.headerBytes), stats.Histogram),
+		stats.IntField("body.bytes", int64(m.http.res.msg.bodyBytes), stats.Histogram),
+	}, []stats.Tag{
+		{Name: "http_req_content_charset", Value: m.http.contentCharset},
+		{Name: "http_req_content_encoding", Value: m.http.contentEncoding},
+		{Name: "http_req_content_type", Value: m.http.contentType},
+		{Name: "http_req_host", Value: m.http.host},
+		{Name: "http_req_method", Value: m.http.method},
+		{Name: "http_req_path", Value: m.http.path},
+		{Name: "http_req_protocol", Value: m.http.protocol},
+		{Name: "http_req_transfer_encoding", Value: m.http.transferEncoding},
+		{Name: "http_res_content_charset", Value: m.http.res.contentCharset},
+		{Name: "http_res_content_encoding", Value: m.http.res.contentEncoding},
+		{Name: "http_res_content_type", Value: m.http.res.contentType},
+		{Name: "http_res_protocol", Value: m.http.res.protocol},
+		{Name: "http_res_server", Value: m.http.res.server},
+		{Name: "http_res_status", Value: m.http.res.status},
+		{Name: "http_res_status_bucket", Value: m.http.res.statusBucket},
+		{Name: "http_res_transfer_encoding", Value: m.http.res.transferEncoding},
+		{Name: "http_res_upgrade", Value: m.http.res.upgrade},
+		{Name: "operation", Value: m.http.res.operation},
+		{Name: "type", Value: m.http.res.msgtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "http", []stats.Field{
+		stats.DurationField("rtt.seconds", m.http.res.rtt, stats.Histogram),
+	}, []stats.Tag{
+		{Name: "http_req_content_charset", Value: m.http.contentCharset},
+		{Name: "http_req_content_encoding", Value: m.http.contentEncoding},
+		{Name: "http_req_content_type", Value: m.http.contentType},
+		{Name: "http_req_host", Value: m.http.host},
+		{Name: "http_req_method", Value: m.http.method},
+		{Name: "http_req_path", Value: m.http.path},
+		{Name: "http_req_protocol", Value: m.http.protocol},
+		{Name: "http_req_transfer_encoding", Value: m.http.transferEncoding},
+		{Name: "http_res_content_charset", Value: m.http.res.contentCharset},
+		{Name: "http_res_content_encoding", Value: m.http.res.contentEncoding},
+		{Name: "http_res_content_type", Value: m.http.res.contentType},
+		{Name: "http_res_protocol", Value: m.http.res.protocol},
+		{Name: "http_res_server", Value: m.http.res.server},
+		{Name: "http_res_status", Value: m.http.res.status},
+		{Name: "http_res_status_bucket", Value: m.http.res.statusBucket},
+		{Name: "http_res_transfer_encoding", Value: m.http.res.transferEncoding},
+		{Name: "http_res_upgrade", Value: m.http.res.upgrade},
+		{Name: "operation", Value: m.http.res.operation},
+		{Name: "type", Value: m.http.res.msgtype},
+	}, tags)
+	return measures
+}
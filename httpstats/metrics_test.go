@@ -3,14 +3,42 @@ package httpstats
 import (
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
 	"github.com/segmentio/stats/v5/iostats"
 )
 
+func TestMetricsAppendMeasures(t *testing.T) {
+	req := httptest.NewRequest("GET", "/hello?answer=42", strings.NewReader("Hello World!"))
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+	}
+
+	m := &metrics{}
+	m.observeRequest(req, "read", 12)
+	m.observeResponse(res, "write", 42, time.Second)
+
+	tags := []stats.Tag{stats.T("a", "1"), stats.T("operation", "2")}
+
+	// Arrays elements are reported with reflection, which gives the expected
+	// measures of the generated AppendMeasures method.
+	expected := stats.MakeMeasures("prefix", [1]metrics{*m}, tags...)
+	found := m.AppendMeasures(nil, "prefix", tags...)
+
+	assert.NotEmpty(t, found)
+	assert.Equal(t, expected, found)
+}
+
 func TestResponseStatusBucket(t *testing.T) {
 	tests := []struct {
 		status int
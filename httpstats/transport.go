@@ -2,7 +2,6 @@ package httpstats
 
 import (
 	"net/http"
-	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
@@ -29,9 +28,9 @@ type transport struct {
 
 // RoundTrip implements http.RoundTripper.
 func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error) {
-	start := time.Now()
-	rtrip := t.transport
 	eng := t.eng
+	start := eng.CurrentTime()
+	rtrip := t.transport
 
 	if rtrip == nil {
 		rtrip = http.DefaultTransport
@@ -60,7 +59,7 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 	req.Body.Close() // nolint
 
 	if err != nil {
-		m.observeError(time.Since(start))
+		m.observeError(eng.CurrentTime().Sub(start))
 		eng.ReportAt(start, m)
 		return res, err
 	}
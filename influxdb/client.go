@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -51,10 +50,30 @@ type ClientConfig struct {
 	// Transport configures the HTTP transport used by the client to send
 	// requests to InfluxDB. By default http.DefaultTransport is used.
 	Transport http.RoundTripper
+
+	// Interval at which buffered metrics are sent to InfluxDB even if the
+	// buffer isn't full. If zero, metrics are only sent when the buffer is
+	// full or when the client is flushed.
+	FlushInterval time.Duration
+
+	// ErrorHandler receives the errors encountered by the client when sending
+	// requests to InfluxDB, once per batch which could not be sent after all
+	// the retries. If nil, the errors are passed to stats.HandleError.
+	ErrorHandler stats.ErrorHandler
 }
 
 // Client represents an InfluxDB client that implements the stats.Handler
 // interface.
+//
+// The first time that the client sends a metric described in the
+// stats.Descriptions registry, it also writes the description to the
+// MetadataMeasurement measurement (see AppendDescription). Descriptions are
+// only considered written once the request carrying them succeeded, they are
+// sent again with the next measures of the metric otherwise.
+//
+// The client counts the bytes and requests it sent to InfluxDB, and the
+// measures it discarded after failing to send them, which the program can
+// monitor with the Stats method.
 type Client struct {
 	serializer
 	buffer stats.Buffer
@@ -89,8 +108,9 @@ func NewClientWith(config ClientConfig) *Client {
 
 	c := &Client{
 		serializer: serializer{
-			url:  makeURL(config.Address, config.Database),
-			done: make(chan struct{}),
+			url:          makeURL(config.Address, config.Database),
+			done:         make(chan struct{}),
+			errorHandler: config.ErrorHandler,
 			http: http.Client{
 				Timeout:   config.Timeout,
 				Transport: config.Transport,
@@ -99,6 +119,7 @@ func NewClientWith(config ClientConfig) *Client {
 	}
 
 	c.buffer.BufferSize = config.BufferSize
+	c.buffer.FlushInterval = config.FlushInterval
 	c.buffer.Serializer = &c.serializer
 	return c
 }
@@ -131,11 +152,20 @@ func (c *Client) Flush() {
 	c.buffer.Flush()
 }
 
-// Close flushes and closes the client, satisfies the io.Closer interface.
+// Stats returns a snapshot of the counters of the client.
+func (c *Client) Stats() stats.HandlerStats {
+	return c.counters.Stats()
+}
+
+// Close flushes and closes the client, satisfies the io.Closer and
+// stats.Closer interfaces.
+//
+// The buffered measures are sent before the pending retries of requests to
+// InfluxDB are canceled.
 func (c *Client) Close() error {
+	err := c.buffer.Close()
 	c.once.Do(func() { close(c.done) })
-	c.Flush()
-	return nil
+	return err
 }
 
 type serializer struct {
@@ -143,16 +173,79 @@ type serializer struct {
 	http http.Client
 	once sync.Once
 	done chan struct{}
+
+	errorHandler stats.ErrorHandler
+	counters     stats.HandlerCounters
+
+	// Sets of metrics that the descriptions were written for, and that the
+	// descriptions are buffered for but not written yet.
+	mutex     sync.Mutex
+	described map[stats.Key]struct{}
+	pending   map[stats.Key]struct{}
 }
 
-func (*serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
+func (s *serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
 	for _, m := range measures {
+		b = s.appendDescriptions(b, time, m)
 		b = AppendMeasure(b, time, m)
 	}
 	return b
 }
 
+// appendDescriptions appends the descriptions of the fields of m that were not
+// written or buffered yet.
+func (s *serializer) appendDescriptions(b []byte, time time.Time, m stats.Measure) []byte {
+	for _, f := range m.Fields {
+		key := stats.Key{Measure: m.Name, Field: f.Name}
+
+		desc, ok := stats.Descriptions.Lookup(key)
+		if !ok {
+			continue
+		}
+
+		s.mutex.Lock()
+		_, done := s.described[key]
+		_, pending := s.pending[key]
+		if !done && !pending {
+			if s.pending == nil {
+				s.pending = make(map[stats.Key]struct{})
+			}
+			s.pending[key] = struct{}{}
+		}
+		s.mutex.Unlock()
+
+		if !done && !pending {
+			b = AppendDescription(b, time, key, desc)
+		}
+	}
+	return b
+}
+
+// settleDescriptions marks the descriptions buffered in b as written if ok is
+// true, or makes them buffered again with the next measures otherwise.
+func (s *serializer) settleDescriptions(b []byte, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	eachLine(b, func(line []byte) {
+		key, isDesc := descriptionKey(line)
+		if !isDesc {
+			return
+		}
+		delete(s.pending, key)
+		if ok {
+			if s.described == nil {
+				s.described = make(map[stats.Key]struct{})
+			}
+			s.described[key] = struct{}{}
+		}
+	})
+}
+
 func (s *serializer) Write(b []byte) (n int, err error) {
+	canceled := false
+
+retry:
 	for attempt := 0; attempt != 10; attempt++ {
 		var res *http.Response
 
@@ -160,30 +253,111 @@ func (s *serializer) Write(b []byte) (n int, err error) {
 			select {
 			case <-time.After(s.http.Timeout):
 			case <-s.done:
-				err = context.Canceled
-				return n, err
+				canceled = true
+				break retry
 			}
 		}
 
 		req, _ := http.NewRequest("POST", s.url.String(), bytes.NewReader(b))
 		res, err = s.http.Do(req)
 		if err != nil {
-			log.Print("stats/influxdb:", err)
 			continue
 		}
 
 		if err = readResponse(res); err != nil {
-			log.Printf("stats/influxdb: POST %s: %d %s: %s", s.url, res.StatusCode, res.Status, err)
+			err = fmt.Errorf("POST %s: %s: %w", s.url, res.Status, err)
 			continue
 		}
 
+		s.counters.Sent(len(b))
 		break
 	}
 
+	if err != nil {
+		// The error is reported once per batch, whatever the number of
+		// attempts to send it.
+		s.counters.WriteError()
+		s.handleError(err)
+		s.counters.Dropped(countMeasures(b))
+	}
+
+	s.settleDescriptions(b, err == nil && !canceled)
+
+	if canceled {
+		return n, context.Canceled
+	}
+
 	n = len(b)
 	return n, err
 }
 
+// countMeasures returns the number of lines of b which are measures, and not
+// descriptions of metrics written to the MetadataMeasurement measurement.
+func countMeasures(b []byte) int {
+	n := 0
+	eachLine(b, func(line []byte) {
+		if _, isDesc := descriptionKey(line); !isDesc {
+			n++
+		}
+	})
+	return n
+}
+
+// descriptionKey returns the key of the description written by
+// AppendDescription on line, or false if line is not a description.
+func descriptionKey(line []byte) (stats.Key, bool) {
+	const prefix, measure = MetadataMeasurement + ",field=", ",measure="
+
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return stats.Key{}, false
+	}
+
+	field, rest := readEscapedTag(line[len(prefix):])
+	if !bytes.HasPrefix(rest, []byte(measure)) {
+		return stats.Key{}, false
+	}
+
+	name, _ := readEscapedTag(rest[len(measure):])
+	return stats.Key{Measure: name, Field: field}, true
+}
+
+// readEscapedTag reads a tag value escaped by appendEscapedTag from the start
+// of b, and returns it with the rest of b.
+func readEscapedTag(b []byte) (string, []byte) {
+	var s []byte
+
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case '\\':
+			if i++; i < len(b) {
+				s = append(s, b[i])
+			}
+		case ',', ' ':
+			return string(s), b[i:]
+		default:
+			s = append(s, c)
+		}
+	}
+
+	return string(s), nil
+}
+
+func eachLine(b []byte, fn func([]byte)) {
+	for len(b) != 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+		fn(line)
+	}
+}
+
+func (s *serializer) handleError(err error) {
+	stats.HandleErrorWith(s.errorHandler, fmt.Errorf("stats/influxdb: %w", err))
+}
+
 func makeURL(address, database string) *url.URL {
 	if !strings.Contains(address, "://") {
 		address = "http://" + address
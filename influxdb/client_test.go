@@ -4,13 +4,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
 
+var _ stats.Closer = (*Client)(nil)
+
 func DisabledTestClient(t *testing.T) {
 	transport := &errorCaptureTransport{
 		RoundTripper: http.DefaultTransport,
@@ -47,6 +51,106 @@ func DisabledTestClient(t *testing.T) {
 	}
 }
 
+func TestClientCounters(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		if fail.Load() {
+			res.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(res, `{"error":"oops"}`)
+		} else {
+			res.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	var errs []error
+	client := NewClientWith(ClientConfig{
+		Address:      server.URL,
+		Timeout:      50 * time.Millisecond,
+		ErrorHandler: stats.ErrorHandlerFunc(func(err error) { errs = append(errs, err) }),
+	})
+
+	measures := []stats.Measure{
+		{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}},
+		{Name: "b", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}},
+	}
+
+	client.HandleMeasures(time.Now(), measures...)
+	client.Flush()
+
+	if s := client.Stats(); s.WriteErrors != 1 || s.DroppedMetrics != 2 || s.PacketsSent != 0 {
+		t.Errorf("bad stats after failing requests: %+v", s)
+	}
+	// The batch was attempted 10 times, but the error is reported once.
+	if len(errs) != 1 {
+		t.Fatal("bad number of errors:", len(errs))
+	}
+	if s := errs[0].Error(); !strings.HasPrefix(s, "stats/influxdb: POST ") || !strings.HasSuffix(s, ": 500 Internal Server Error: oops") {
+		t.Error("bad error:", s)
+	}
+
+	fail.Store(false)
+	client.HandleMeasures(time.Now(), measures...)
+	client.Flush()
+
+	if s := client.Stats(); s.PacketsSent != 1 || s.BytesSent == 0 || s.DroppedMetrics != 2 {
+		t.Errorf("bad stats after a successful request: %+v", s)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientDescriptionsAfterFailure(t *testing.T) {
+	stats.Describe("influxdb.retry.count", stats.Description{Help: "Number of retries."})
+
+	var fail atomic.Bool
+	fail.Store(true)
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if fail.Load() {
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(b))
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClientWith(ClientConfig{
+		Address:      server.URL,
+		Timeout:      10 * time.Millisecond,
+		ErrorHandler: stats.ErrorHandlerFunc(func(error) {}),
+	})
+	defer client.Close()
+
+	m := stats.Measure{Name: "influxdb.retry", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+
+	client.HandleMeasures(time.Now(), m)
+	client.Flush()
+
+	fail.Store(false)
+	client.HandleMeasures(time.Now(), m)
+	client.Flush()
+	client.HandleMeasures(time.Now(), m)
+	client.Flush()
+
+	if len(bodies) != 2 {
+		t.Fatal("bad number of requests:", len(bodies))
+	}
+	if !strings.HasPrefix(bodies[0], MetadataMeasurement+",") {
+		t.Error("the description was not sent again after the failed request:", bodies[0])
+	}
+	if strings.Contains(bodies[1], MetadataMeasurement) {
+		t.Error("the description was sent again after the successful request:", bodies[1])
+	}
+}
+
 func BenchmarkClient(b *testing.B) {
 	for _, N := range []int{1, 10, 100} {
 		b.Run(fmt.Sprintf("write a batch of %d measures to a client", N), func(b *testing.B) {
@@ -2,6 +2,7 @@ package influxdb
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
@@ -57,3 +58,65 @@ func AppendMeasure(b []byte, t time.Time, m stats.Measure) []byte {
 
 	return append(b, '\n')
 }
+
+// MetadataMeasurement is the name of the InfluxDB measurement where the client
+// writes the descriptions of the metrics registered in stats.Descriptions.
+const MetadataMeasurement = "stats.metadata"
+
+// AppendDescription is a formatting routine to append the InfluxDB line
+// protocol representation of the description of a measure field to a memory
+// buffer.
+//
+// Descriptions are written as points of the MetadataMeasurement measurement,
+// tagged with the names of the measure and field and the metric type if it is
+// set, and carrying the help and unit as string fields.
+func AppendDescription(b []byte, t time.Time, key stats.Key, desc stats.Description) []byte {
+	b = append(b, MetadataMeasurement...)
+	b = append(b, ",field="...)
+	b = appendEscapedTag(b, key.Field)
+	b = append(b, ",measure="...)
+	b = appendEscapedTag(b, key.Measure)
+	if desc.HasType {
+		b = append(b, ",type="...)
+		b = append(b, desc.Type.String()...)
+	}
+
+	b = append(b, " help="...)
+	b = appendQuotedField(b, desc.Help)
+	b = append(b, ",unit="...)
+	b = appendQuotedField(b, desc.Unit)
+
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, t.UnixNano(), 10)
+
+	return append(b, '\n')
+}
+
+func appendEscapedTag(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ',', '=', ' ':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func appendQuotedField(b []byte, s string) []byte {
+	b = append(b, '"')
+
+	for len(s) != 0 {
+		i := strings.IndexAny(s, `"\`)
+		if i < 0 {
+			b = append(b, s...)
+			break
+		}
+		b = append(b, s[:i]...)
+		b = append(b, '\\', s[i])
+		s = s[i+1:]
+	}
+
+	return append(b, '"')
+}
@@ -51,3 +51,71 @@ func TestAppendMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestAppendDescription(t *testing.T) {
+	key := stats.Key{Measure: "http", Field: "rtt.seconds"}
+	desc := stats.Description{
+		Help:    `Time to receive the "response", in seconds.`,
+		Unit:    "seconds",
+		Type:    stats.Histogram,
+		HasType: true,
+	}
+
+	const expected = `stats.metadata,field=rtt.seconds,measure=http,type=histogram help="Time to receive the \"response\", in seconds.",unit="seconds" 1500780960123456789` + "\n"
+
+	if s := string(AppendDescription(nil, timestamp, key, desc)); s != expected {
+		t.Error("bad description representation:")
+		t.Log("expected:", expected)
+		t.Log("found:   ", s)
+	}
+
+	desc = stats.Description{Help: "Round trip time."}
+
+	const untyped = `stats.metadata,field=rtt.seconds,measure=http help="Round trip time.",unit="" 1500780960123456789` + "\n"
+
+	if s := string(AppendDescription(nil, timestamp, key, desc)); s != untyped {
+		t.Error("bad description representation without type:")
+		t.Log("expected:", untyped)
+		t.Log("found:   ", s)
+	}
+}
+
+func TestSerializerDescriptions(t *testing.T) {
+	stats.Describe("influxdb.test.count", stats.Description{Help: "Number of tests.", Type: stats.Counter, HasType: true})
+
+	m := stats.Measure{
+		Name:   "influxdb.test",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	}
+
+	s := &serializer{}
+	b := s.AppendMeasures(nil, timestamp, m, m)
+
+	const expected = `stats.metadata,field=count,measure=influxdb.test,type=counter help="Number of tests.",unit="" 1500780960123456789
+influxdb.test count=1 1500780960123456789
+influxdb.test count=1 1500780960123456789
+`
+
+	if string(b) != expected {
+		t.Error("bad serialization:")
+		t.Log("expected:", expected)
+		t.Log("found:   ", string(b))
+	}
+
+	// The descriptions are not counted as measures when a write fails.
+	if n := countMeasures(b); n != 2 {
+		t.Error("bad number of measures:", n)
+	}
+}
+
+func TestDescriptionKey(t *testing.T) {
+	key := stats.Key{Measure: "a b,c", Field: "x=y"}
+	b := AppendDescription(nil, timestamp, key, stats.Description{Help: "help"})
+
+	if k, ok := descriptionKey(b[:len(b)-1]); !ok || k != key {
+		t.Errorf("bad description key: %+v %t", k, ok)
+	}
+	if _, ok := descriptionKey([]byte("influxdb.test count=1 1500780960123456789")); ok {
+		t.Error("measures must not be parsed as descriptions")
+	}
+}
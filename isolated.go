@@ -0,0 +1,385 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultIsolatedSlowThreshold is the default duration after which calls
+	// to the handlers of an IsolatedMultiHandler are considered failed.
+	DefaultIsolatedSlowThreshold = 1 * time.Second
+
+	// DefaultIsolatedFailureThreshold is the default number of consecutive
+	// failures after which an IsolatedMultiHandler disables a handler.
+	DefaultIsolatedFailureThreshold = 5
+
+	// DefaultIsolatedBreakerTimeout is the default amount of time that an
+	// IsolatedMultiHandler disables a failing handler for.
+	DefaultIsolatedBreakerTimeout = 30 * time.Second
+
+	// DefaultIsolatedFlushTimeout is the default maximum amount of time that
+	// flushing an IsolatedMultiHandler waits for its handlers.
+	DefaultIsolatedFlushTimeout = 5 * time.Second
+)
+
+// IsolatedMultiHandler is a handler which dispatches measures to multiple
+// handlers, like MultiHandler, but isolates the handlers from each other so a
+// slow or failing backend cannot stall the others.
+//
+// Each handler gets its own copy of the measures, queued in an AsyncHandler
+// with a single worker, so the program never waits on the handlers (unless
+// Policy is Block) and measures that don't fit in the queue of a handler are
+// dropped for this handler only.
+//
+// Each handler is also guarded by a circuit breaker. A call to the handler
+// fails if it panics, takes longer than SlowThreshold, or increases the write
+// errors that the handler reports through a Stats method, like the clients of
+// the datadog and influxdb packages. After FailureThreshold consecutive
+// failures, the breaker opens: the handler is disabled and its measures are
+// dropped for BreakerTimeout, after which one call is let through to probe the
+// handler. The breaker closes if the call succeeds, or opens again otherwise.
+//
+// The health of the handlers is reported on a measure named "stats.isolated"
+// tagged with the index and type of each handler, which is sent to all the
+// handlers when the IsolatedMultiHandler is flushed, and at most every few
+// seconds while measures are handled. The queues of each handler are also
+// reported to it on a measure named "stats.async" (see AsyncHandler).
+//
+// The program must call Close to drain the queues and stop the goroutines.
+type IsolatedMultiHandler struct {
+	// The handlers that measures are dispatched to.
+	Handlers []Handler
+
+	// Maximum number of measures held in the queue of each handler. If zero,
+	// DefaultAsyncQueueSize is used.
+	QueueSize int
+
+	// Action taken when the queue of a handler is full, DropNewest by default.
+	// With the Block policy, a handler which is slower than the program
+	// stalls it, so the handlers are not isolated anymore.
+	Policy QueuePolicy
+
+	// Duration after which a call to a handler is considered failed. If zero,
+	// DefaultIsolatedSlowThreshold is used.
+	SlowThreshold time.Duration
+
+	// Number of consecutive failed calls after which a handler is disabled.
+	// If zero, DefaultIsolatedFailureThreshold is used.
+	FailureThreshold int
+
+	// Amount of time that failing handlers are disabled for. If zero,
+	// DefaultIsolatedBreakerTimeout is used.
+	BreakerTimeout time.Duration
+
+	// Maximum amount of time that Flush waits for the handlers to drain their
+	// queues and be flushed. If zero, DefaultIsolatedFlushTimeout is used.
+	FlushTimeout time.Duration
+
+	once     sync.Once
+	children []*isolatedChild
+
+	mutex      sync.Mutex
+	reportTime time.Time
+}
+
+// NewIsolatedMultiHandler returns a new IsolatedMultiHandler dispatching
+// measures to handlers. Nil handlers are ignored.
+func NewIsolatedMultiHandler(handlers ...Handler) *IsolatedMultiHandler {
+	h := &IsolatedMultiHandler{}
+
+	for _, handler := range handlers {
+		if handler != nil {
+			h.Handlers = append(h.Handlers, handler)
+		}
+	}
+
+	return h
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *IsolatedMultiHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	if len(measures) == 0 {
+		return
+	}
+
+	h.init()
+
+	for _, c := range h.children {
+		c.queue.HandleMeasures(t, measures...)
+	}
+
+	if h.shouldReport(time.Now()) {
+		h.report(time.Now())
+	}
+}
+
+// Flush waits for the measures queued before the call to be forwarded to the
+// handlers, and flushes them, satisfies the Flusher interface. Flush returns
+// after FlushTimeout, in which case the handlers which were not flushed yet
+// keep being flushed in the background, and are skipped by the next calls to
+// Flush until they complete.
+func (h *IsolatedMultiHandler) Flush() {
+	h.init()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.flushTimeout())
+	defer cancel()
+
+	// The health of the handlers is reported once their queues are drained,
+	// so it accounts for all measures handled before the call.
+	eachHandler(ctx, h.handlers(), func(c Handler) error {
+		c.(*isolatedChild).flushQueue((*AsyncHandler).drain)
+		return nil
+	})
+
+	h.report(time.Now())
+
+	eachHandler(ctx, h.handlers(), func(c Handler) error {
+		c.(*isolatedChild).flushQueue((*AsyncHandler).Flush)
+		return nil
+	})
+}
+
+// Close drains the queues of the handlers and stops their goroutines, then
+// closes the handlers (or flushes them if they don't implement Closer), and
+// returns the aggregated errors, satisfies the Closer interface.
+func (h *IsolatedMultiHandler) Close() error {
+	h.init()
+	h.report(time.Now())
+
+	for _, c := range h.children {
+		c.queue.Close()
+	}
+
+	return closeHandlers(context.Background(), h.Handlers...)
+}
+
+func (h *IsolatedMultiHandler) init() {
+	h.once.Do(func() {
+		h.children = make([]*isolatedChild, len(h.Handlers))
+		h.reportTime = time.Now()
+
+		for i, handler := range h.Handlers {
+			c := &isolatedChild{
+				handler:       handler,
+				tags:          []Tag{T("handler", handlerName(handler)), T("index", strconv.Itoa(i))},
+				slowThreshold: h.slowThreshold(),
+				failures:      h.failureThreshold(),
+				timeout:       h.breakerTimeout(),
+			}
+			c.queue = AsyncHandler{
+				Handler:   c,
+				QueueSize: h.QueueSize,
+				Policy:    h.Policy,
+			}
+			h.children[i] = c
+		}
+	})
+}
+
+func (h *IsolatedMultiHandler) handlers() []Handler {
+	handlers := make([]Handler, len(h.children))
+	for i, c := range h.children {
+		handlers[i] = c
+	}
+	return handlers
+}
+
+func (h *IsolatedMultiHandler) shouldReport(now time.Time) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return now.Sub(h.reportTime) >= asyncReportInterval
+}
+
+// report sends the health of all handlers to each of them.
+func (h *IsolatedMultiHandler) report(now time.Time) {
+	h.mutex.Lock()
+	h.reportTime = now
+	h.mutex.Unlock()
+
+	measures := make([]Measure, len(h.children))
+	for i, c := range h.children {
+		measures[i] = c.health()
+	}
+
+	for _, c := range h.children {
+		c.queue.HandleMeasures(now, measures...)
+	}
+}
+
+func (h *IsolatedMultiHandler) slowThreshold() time.Duration {
+	if h.SlowThreshold > 0 {
+		return h.SlowThreshold
+	}
+	return DefaultIsolatedSlowThreshold
+}
+
+func (h *IsolatedMultiHandler) failureThreshold() int {
+	if h.FailureThreshold > 0 {
+		return h.FailureThreshold
+	}
+	return DefaultIsolatedFailureThreshold
+}
+
+func (h *IsolatedMultiHandler) breakerTimeout() time.Duration {
+	if h.BreakerTimeout > 0 {
+		return h.BreakerTimeout
+	}
+	return DefaultIsolatedBreakerTimeout
+}
+
+func (h *IsolatedMultiHandler) flushTimeout() time.Duration {
+	if h.FlushTimeout > 0 {
+		return h.FlushTimeout
+	}
+	return DefaultIsolatedFlushTimeout
+}
+
+// handlerName returns the name of the type of h, without the pointer prefix.
+func handlerName(h Handler) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", h), "*")
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// isolatedChild guards a handler of an IsolatedMultiHandler with a circuit
+// breaker. Its HandleMeasures method is called by the worker of its queue.
+type isolatedChild struct {
+	handler Handler
+	queue   AsyncHandler
+	tags    []Tag
+
+	slowThreshold time.Duration
+	failures      int
+	timeout       time.Duration
+
+	// Set while the queue is flushed, so a queue stuck on a slow handler is
+	// flushed by one goroutine at a time.
+	flushing atomic.Bool
+
+	mutex       sync.Mutex
+	state       breakerState
+	consecutive int
+	openUntil   time.Time
+	failed      uint64
+	rejected    uint64
+}
+
+// statsHandler is implemented by handlers which count their write errors, like
+// the clients of the datadog and influxdb packages.
+type statsHandler interface {
+	Stats() HandlerStats
+}
+
+func (c *isolatedChild) HandleMeasures(t time.Time, measures ...Measure) {
+	if !c.allow(time.Now()) {
+		c.mutex.Lock()
+		c.rejected += uint64(len(measures))
+		c.mutex.Unlock()
+		return
+	}
+
+	writeErrors := c.writeErrors()
+	start := time.Now()
+	ok := c.call(t, measures)
+	failed := !ok || time.Since(start) > c.slowThreshold || c.writeErrors() > writeErrors
+
+	c.record(failed, time.Now())
+}
+
+func (c *isolatedChild) Flush() {
+	if c.allow(time.Now()) {
+		flush(c.handler)
+	}
+}
+
+// flushQueue calls fn with the queue of the handler, unless the queue is still
+// being flushed by a previous call.
+func (c *isolatedChild) flushQueue(fn func(*AsyncHandler)) {
+	if c.flushing.CompareAndSwap(false, true) {
+		defer c.flushing.Store(false)
+		fn(&c.queue)
+	}
+}
+
+// call passes measures to the handler, it returns false if the handler
+// panicked.
+func (c *isolatedChild) call(t time.Time, measures []Measure) (ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			HandleError(fmt.Errorf("stats: %s handler panicked: %v", handlerName(c.handler), err))
+		}
+	}()
+	c.handler.HandleMeasures(t, measures...)
+	return true
+}
+
+func (c *isolatedChild) writeErrors() uint64 {
+	if s, ok := c.handler.(statsHandler); ok {
+		return s.Stats().WriteErrors
+	}
+	return 0
+}
+
+func (c *isolatedChild) allow(now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.state {
+	case breakerOpen:
+		if now.Before(c.openUntil) {
+			return false
+		}
+		c.state = breakerHalfOpen
+		return true
+	default:
+		return true
+	}
+}
+
+func (c *isolatedChild) record(failed bool, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !failed {
+		c.state, c.consecutive = breakerClosed, 0
+		return
+	}
+
+	c.failed++
+	c.consecutive++
+
+	if c.state == breakerHalfOpen || c.consecutive >= c.failures {
+		c.state, c.consecutive = breakerOpen, 0
+		c.openUntil = now.Add(c.timeout)
+	}
+}
+
+func (c *isolatedChild) health() Measure {
+	c.mutex.Lock()
+	open := c.state == breakerOpen
+	failed, rejected := c.failed, c.rejected
+	c.failed, c.rejected = 0, 0
+	c.mutex.Unlock()
+
+	return Measure{
+		Name: "stats.isolated",
+		Fields: []Field{
+			MakeField("open", open, Gauge),
+			MakeField("failures", failed, Counter),
+			MakeField("rejected", rejected, Counter),
+		},
+		Tags: c.tags,
+	}
+}
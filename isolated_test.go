@@ -0,0 +1,221 @@
+package stats_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestIsolatedMultiHandler(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	t.Run("slow handlers don't stall the others", func(t *testing.T) {
+		slow := &gateHandler{entered: make(chan struct{}, 1), release: make(chan struct{})}
+		fast := &statstest.Handler{}
+		h := &stats.IsolatedMultiHandler{
+			Handlers:      []stats.Handler{slow, fast},
+			QueueSize:     4,
+			SlowThreshold: time.Hour,
+			FlushTimeout:  10 * time.Millisecond,
+		}
+		value := func(i int) stats.Measure {
+			return stats.Measure{Name: "value", Fields: []stats.Field{stats.MakeField("", i, stats.Gauge)}}
+		}
+
+		h.HandleMeasures(time.Now(), value(0))
+		<-slow.entered // the worker of the slow handler is stuck
+		for i := 1; i != 10; i++ {
+			h.HandleMeasures(time.Now(), value(i))
+
+			start := time.Now()
+			h.Flush()
+			assert.Less(t, time.Since(start), time.Second)
+		}
+
+		assert.Len(t, measuresNamed(fast.Measures(), "value"), 10)
+
+		close(slow.release)
+		assert.NoError(t, h.Close())
+
+		slow.mutex.Lock()
+		defer slow.mutex.Unlock()
+		// The queue held 2 values and the health reported by the first flush.
+		assert.Len(t, measuresNamed(slow.handled, "value"), 3, "the queue of the slow handler must be bounded")
+	})
+
+	t.Run("handlers get their own copy of the measures", func(t *testing.T) {
+		h1 := stats.HandlerFunc(func(_ time.Time, measures ...stats.Measure) {
+			for i := range measures {
+				if measures[i].Name == "a" {
+					measures[i].Tags[0].Value = "changed"
+				}
+			}
+		})
+		h2 := &statstest.Handler{}
+		h := stats.NewIsolatedMultiHandler(h1, h2)
+
+		h.HandleMeasures(time.Now(), stats.Measure{
+			Name:   "a",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("tag", "value")},
+		})
+		h.Close()
+
+		m := measuresNamed(h2.Measures(), "a")
+		assert.Len(t, m, 1)
+		assert.Equal(t, []stats.Tag{stats.T("tag", "value")}, m[0].Tags)
+	})
+
+	t.Run("batches larger than the queues don't block forever with the block policy", func(t *testing.T) {
+		h1 := &statstest.Handler{}
+		h2 := &statstest.Handler{}
+		h := &stats.IsolatedMultiHandler{
+			Handlers:  []stats.Handler{h1, h2},
+			QueueSize: 2,
+			Policy:    stats.Block,
+		}
+		defer h.Close()
+
+		measures := make([]stats.Measure, 5)
+		for i := range measures {
+			measures[i] = stats.Measure{Name: "value", Fields: []stats.Field{stats.MakeField("", i, stats.Gauge)}}
+		}
+
+		done := make(chan struct{})
+		go func() {
+			h.HandleMeasures(time.Now(), measures...)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the caller was blocked by a batch larger than the queues")
+		}
+
+		h.Flush()
+		assert.Len(t, measuresNamed(h1.Measures(), "value"), 5)
+		assert.Len(t, measuresNamed(h2.Measures(), "value"), 5)
+	})
+
+	t.Run("failing handlers are disabled by the circuit breaker", func(t *testing.T) {
+		failing := &failingHandler{}
+		healthy := &statstest.Handler{}
+		h := &stats.IsolatedMultiHandler{
+			Handlers:         []stats.Handler{failing, healthy},
+			FailureThreshold: 2,
+			BreakerTimeout:   50 * time.Millisecond,
+		}
+		defer h.Close()
+
+		m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+
+		for range 5 {
+			h.HandleMeasures(time.Now(), m)
+		}
+		h.Flush()
+		assert.Equal(t, 2, failing.count(), "the breaker must open after 2 failures")
+
+		health := measuresNamed(healthy.Measures(), "stats.isolated")
+		assert.Len(t, health, 2)
+		assert.Equal(t, []stats.Tag{stats.T("handler", "stats_test.failingHandler"), stats.T("index", "0")}, health[0].Tags)
+		assert.Equal(t, stats.MakeField("open", true, stats.Gauge), health[0].Fields[0])
+		assert.Equal(t, stats.MakeField("failures", uint64(2), stats.Counter), health[0].Fields[1])
+		assert.Equal(t, stats.MakeField("rejected", uint64(3), stats.Counter), health[0].Fields[2])
+		assert.Equal(t, stats.MakeField("open", false, stats.Gauge), health[1].Fields[0])
+
+		// After the timeout, one call probes the handler.
+		time.Sleep(60 * time.Millisecond)
+		failing.setFail(false)
+		h.HandleMeasures(time.Now(), m)
+		h.HandleMeasures(time.Now(), m)
+		h.Flush()
+		assert.Equal(t, 4, failing.count(), "the breaker must close after a successful call")
+		health = measuresNamed(healthy.Measures(), "stats.isolated")
+		assert.Equal(t, stats.MakeField("open", false, stats.Gauge), health[2].Fields[0])
+	})
+
+	t.Run("panics are handled as failures", func(t *testing.T) {
+		var errs []error
+		var mutex sync.Mutex
+		stats.SetErrorHandler(stats.ErrorHandlerFunc(func(err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		}))
+		defer stats.SetErrorHandler(nil)
+
+		panicking := stats.HandlerFunc(func(time.Time, ...stats.Measure) { panic("boom") })
+		healthy := &statstest.Handler{}
+		h := &stats.IsolatedMultiHandler{Handlers: []stats.Handler{panicking, healthy}, FailureThreshold: 1}
+		defer h.Close()
+
+		h.HandleMeasures(time.Now(), stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}})
+		h.Flush()
+
+		health := measuresNamed(healthy.Measures(), "stats.isolated")
+		assert.Len(t, health, 2)
+		assert.Equal(t, stats.MakeField("open", true, stats.Gauge), health[0].Fields[0])
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, []error{errors.New("stats: stats.HandlerFunc handler panicked: boom")}, errs)
+	})
+}
+
+func measuresNamed(measures []stats.Measure, name string) []stats.Measure {
+	var found []stats.Measure
+	for _, m := range measures {
+		if m.Name == name {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// failingHandler counts the calls it receives, and its write errors while it is
+// failing.
+type failingHandler struct {
+	mutex  sync.Mutex
+	calls  int
+	errors uint64
+	ok     bool
+}
+
+func (h *failingHandler) HandleMeasures(_ time.Time, measures ...stats.Measure) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(measures) != 0 && measures[0].Name == "a" {
+		h.calls++
+	}
+	if !h.ok {
+		h.errors++
+	}
+}
+
+func (h *failingHandler) Stats() stats.HandlerStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return stats.HandlerStats{WriteErrors: h.errors}
+}
+
+func (h *failingHandler) setFail(fail bool) {
+	h.mutex.Lock()
+	h.ok = !fail
+	h.mutex.Unlock()
+}
+
+func (h *failingHandler) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.calls
+}
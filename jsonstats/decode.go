@@ -0,0 +1,205 @@
+package jsonstats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Decoder reads the JSON objects written by handlers back into measures.
+//
+// Objects that don't have a name and a value are not metrics, they are skipped
+// so the decoder can read logs where metrics are mixed with other records. Keys
+// that are not part of the naming are ignored.
+type Decoder struct {
+	// Keys of the objects, DefaultNaming is used if the Name key is empty.
+	Naming Naming
+
+	decoder *json.Decoder
+}
+
+// NewDecoder returns a Decoder reading objects from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{decoder: json.NewDecoder(r)}
+}
+
+// Decode reads the next object and returns its time and the measure it holds,
+// which has a single field. The object name is split at its last dot into the
+// names of the measure and of the field. Timestamps may be written in either
+// of the time formats, and values are decoded as booleans, integers when they
+// have no fractional part and fit in 64 bits, or floats otherwise. Objects
+// without a type are decoded as gauges.
+//
+// At the end of the input, Decode returns io.EOF.
+func (d *Decoder) Decode() (time.Time, stats.Measure, error) {
+	naming := d.Naming.orDefault()
+
+	for {
+		var object map[string]json.RawMessage
+
+		if err := d.decoder.Decode(&object); err != nil {
+			return time.Time{}, stats.Measure{}, err
+		}
+
+		name, hasName := object[naming.Name]
+		value, hasValue := object[naming.Value]
+		if !hasName || !hasValue {
+			continue
+		}
+
+		t, m, err := decodeObject(object, naming, name, value)
+		if err != nil {
+			return time.Time{}, stats.Measure{}, fmt.Errorf("stats/jsonstats: decoding %s: %w", name, err)
+		}
+		return t, m, nil
+	}
+}
+
+// HandleAll decodes the objects until the end of the input and passes their
+// measures to h, then flushes h if it implements stats.Flusher. It returns nil
+// when the end of the input is reached, or the error that interrupted it.
+func (d *Decoder) HandleAll(h stats.Handler) error {
+	for {
+		t, m, err := d.Decode()
+		if err != nil {
+			if f, ok := h.(stats.Flusher); ok {
+				f.Flush()
+			}
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return err
+		}
+		h.HandleMeasures(t, m)
+	}
+}
+
+func decodeObject(object map[string]json.RawMessage, naming *Naming, rawName, rawValue json.RawMessage) (time.Time, stats.Measure, error) {
+	var name string
+	if err := json.Unmarshal(rawName, &name); err != nil {
+		return time.Time{}, stats.Measure{}, err
+	}
+
+	value, err := decodeValue(rawValue)
+	if err != nil {
+		return time.Time{}, stats.Measure{}, err
+	}
+
+	ftype, err := decodeType(object[naming.Type])
+	if err != nil {
+		return time.Time{}, stats.Measure{}, err
+	}
+
+	t, err := decodeTime(object[naming.Time])
+	if err != nil {
+		return time.Time{}, stats.Measure{}, err
+	}
+
+	m := stats.Measure{}
+
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		m.Name = name[:i]
+		m.Fields = []stats.Field{stats.MakeField(name[i+1:], value, ftype)}
+	} else {
+		m.Name = name
+		m.Fields = []stats.Field{stats.MakeField("", value, ftype)}
+	}
+
+	if raw := object[naming.Tags]; raw != nil {
+		var tags map[string]string
+		if err := json.Unmarshal(raw, &tags); err != nil {
+			return time.Time{}, stats.Measure{}, err
+		}
+		for k, v := range tags {
+			m.Tags = append(m.Tags, stats.T(k, v))
+		}
+		m.Tags = stats.SortTags(m.Tags)
+	}
+
+	if raw := object[naming.SampleRate]; raw != nil && naming.SampleRate != "" {
+		if err := json.Unmarshal(raw, &m.SampleRate); err != nil {
+			return time.Time{}, stats.Measure{}, err
+		}
+	}
+
+	return t, m, nil
+}
+
+func decodeValue(raw json.RawMessage) (stats.Value, error) {
+	switch s := string(raw); s {
+	case "true":
+		return stats.ValueOf(true), nil
+	case "false":
+		return stats.ValueOf(false), nil
+	case "null":
+		return stats.Value{}, nil
+	case `"NaN"`:
+		return stats.ValueOf(math.NaN()), nil
+	case `"+Inf"`:
+		return stats.ValueOf(math.Inf(+1)), nil
+	case `"-Inf"`:
+		return stats.ValueOf(math.Inf(-1)), nil
+	default:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return stats.ValueOf(i), nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return stats.ValueOf(u), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return stats.Value{}, fmt.Errorf("invalid value: %s", s)
+		}
+		return stats.ValueOf(f), nil
+	}
+}
+
+func decodeType(raw json.RawMessage) (stats.FieldType, error) {
+	var s string
+	if raw != nil {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, err
+		}
+	}
+
+	switch s {
+	case "counter":
+		return stats.Counter, nil
+	case "gauge", "":
+		return stats.Gauge, nil
+	case "histogram":
+		return stats.Histogram, nil
+	case "set":
+		return stats.Distinct, nil
+	default:
+		return 0, fmt.Errorf("invalid metric type: %q", s)
+	}
+}
+
+func decodeTime(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 {
+		return time.Time{}, nil
+	}
+
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	ns, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", raw)
+	}
+	return time.Unix(0, ns), nil
+}
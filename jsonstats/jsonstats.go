@@ -0,0 +1,342 @@
+// Package jsonstats implements a stats.Handler writing metrics as newline
+// delimited JSON objects, for environments where logs are the only way out of
+// the program.
+//
+// Every field of the measures is written as one object carrying its name, the
+// type of metric, its value, its tags and its time:
+//
+//	{"time":"2024-04-18T09:45:00Z","name":"http.rtt","type":"histogram","value":0.15,"tags":{"method":"GET"}}
+//
+// The keys of the objects can be configured with a Naming, to match the
+// conventions of the log pipeline (see ECSNaming and OTelNaming). The Decoder
+// reads the objects back into measures, so the logs can be fed to any other
+// stats.Handler.
+package jsonstats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultBufferSize is the default size of the batches of objects written to
+// the output of a handler.
+const DefaultBufferSize = 16 * 1024
+
+// Naming configures the keys of the JSON objects written by a handler.
+type Naming struct {
+	Time       string
+	Name       string
+	Type       string
+	Value      string
+	Tags       string
+	SampleRate string
+}
+
+var (
+	// DefaultNaming is the naming used by handlers when none is configured.
+	DefaultNaming = Naming{
+		Time:       "time",
+		Name:       "name",
+		Type:       "type",
+		Value:      "value",
+		Tags:       "tags",
+		SampleRate: "sample_rate",
+	}
+
+	// ECSNaming names the keys of objects after the Elastic Common Schema,
+	// tags are written as labels.
+	ECSNaming = Naming{
+		Time:       "@timestamp",
+		Name:       "metric.name",
+		Type:       "metric.type",
+		Value:      "metric.value",
+		Tags:       "labels",
+		SampleRate: "metric.sample_rate",
+	}
+
+	// OTelNaming names the keys of objects after the OpenTelemetry data
+	// model, tags are written as attributes. It is usually combined with
+	// UnixNano timestamps.
+	OTelNaming = Naming{
+		Time:       "timeUnixNano",
+		Name:       "name",
+		Type:       "type",
+		Value:      "value",
+		Tags:       "attributes",
+		SampleRate: "sampleRate",
+	}
+)
+
+func (n *Naming) orDefault() *Naming {
+	if n.Name == "" {
+		return &DefaultNaming
+	}
+	return n
+}
+
+// TimeFormat is an enumeration of the formats of timestamps written by
+// handlers.
+type TimeFormat int
+
+const (
+	// RFC3339 writes timestamps as strings in the RFC 3339 format, with
+	// nanosecond precision.
+	RFC3339 TimeFormat = iota
+
+	// UnixNano writes timestamps as the number of nanoseconds elapsed since
+	// the Unix epoch.
+	UnixNano
+)
+
+// HandlerConfig is used to configure handlers.
+type HandlerConfig struct {
+	// Output that the objects are written to, os.Stdout by default.
+	Output io.Writer
+
+	// Keys of the objects, DefaultNaming is used if the Name key is empty.
+	Naming Naming
+
+	// Format of the timestamps, RFC3339 by default.
+	TimeFormat TimeFormat
+
+	// Size of the batches of objects written to the output. If zero,
+	// DefaultBufferSize is used.
+	BufferSize int
+
+	// Interval at which buffered objects are written to the output even if
+	// the buffer isn't full. If zero, objects are only written when the buffer
+	// is full or when the handler is flushed.
+	FlushInterval time.Duration
+
+	// ErrorHandler receives the errors encountered when writing to the
+	// output. If nil, the errors are passed to stats.HandleError.
+	ErrorHandler stats.ErrorHandler
+}
+
+// Handler is a stats.Handler writing measures to an output as newline
+// delimited JSON objects, one per field.
+//
+// The objects are buffered, the program should flush or close the handler
+// before exiting.
+type Handler struct {
+	serializer
+	buffer stats.Buffer
+}
+
+// NewHandler returns a new Handler writing objects to w.
+func NewHandler(w io.Writer) *Handler {
+	return NewHandlerWith(HandlerConfig{Output: w})
+}
+
+// NewHandlerWith returns a new Handler configured with config.
+func NewHandlerWith(config HandlerConfig) *Handler {
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+
+	h := &Handler{
+		serializer: serializer{
+			output:       config.Output,
+			naming:       *config.Naming.orDefault(),
+			timeFormat:   config.TimeFormat,
+			errorHandler: config.ErrorHandler,
+		},
+	}
+
+	h.buffer.BufferSize = config.BufferSize
+	h.buffer.FlushInterval = config.FlushInterval
+	h.buffer.Serializer = &h.serializer
+	return h
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	h.buffer.HandleMeasures(time, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (h *Handler) Flush() {
+	h.buffer.Flush()
+}
+
+// Close flushes the handler, satisfies the io.Closer interface. It doesn't
+// close the output.
+func (h *Handler) Close() error {
+	return h.buffer.Close()
+}
+
+// Stats returns a snapshot of the counters of the handler.
+func (h *Handler) Stats() stats.HandlerStats {
+	return h.counters.Stats()
+}
+
+type serializer struct {
+	mutex      sync.Mutex
+	output     io.Writer
+	naming     Naming
+	timeFormat TimeFormat
+
+	errorHandler stats.ErrorHandler
+	counters     stats.HandlerCounters
+}
+
+func (s *serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
+	for _, m := range measures {
+		b = AppendMeasure(b, time, m, &s.naming, s.timeFormat)
+	}
+	return b
+}
+
+func (s *serializer) Write(b []byte) (int, error) {
+	// The buffers of the handler are flushed concurrently, writes to the
+	// output are serialized so the lines are not interleaved.
+	s.mutex.Lock()
+	n, err := s.output.Write(b)
+	s.mutex.Unlock()
+
+	if err != nil {
+		s.counters.WriteError()
+		stats.HandleErrorWith(s.errorHandler, fmt.Errorf("stats/jsonstats: %w", err))
+	} else {
+		s.counters.Sent(n)
+	}
+	return n, err
+}
+
+// AppendMeasure appends the JSON objects of the fields of m to b, each on its
+// own line. The name of the objects is the name of the measure and the name of
+// the field joined by a dot. Durations are written in seconds, and the values
+// that JSON cannot represent as numbers (NaN and infinities) are written as
+// strings. The time is omitted if it is the zero time, which UnixNano
+// timestamps cannot represent. The keys of the objects are named by naming, or
+// DefaultNaming if nil.
+func AppendMeasure(b []byte, t time.Time, m stats.Measure, naming *Naming, format TimeFormat) []byte {
+	if naming == nil {
+		naming = &DefaultNaming
+	}
+
+	for _, f := range m.Fields {
+		b = append(b, '{')
+
+		if !t.IsZero() {
+			b = appendKey(b, naming.Time)
+
+			switch format {
+			case UnixNano:
+				b = strconv.AppendInt(b, t.UnixNano(), 10)
+			default:
+				b = append(b, '"')
+				b = t.AppendFormat(b, time.RFC3339Nano)
+				b = append(b, '"')
+			}
+
+			b = append(b, ',')
+		}
+
+		b = appendKey(b, naming.Name)
+		b = appendName(b, m.Name, f.Name)
+
+		b = append(b, ',')
+		b = appendKey(b, naming.Type)
+		b = appendString(b, f.Type().String())
+
+		b = append(b, ',')
+		b = appendKey(b, naming.Value)
+		b = appendValue(b, f.Value)
+
+		if len(m.Tags) != 0 {
+			b = append(b, ',')
+			b = appendKey(b, naming.Tags)
+			b = append(b, '{')
+
+			for i, tag := range m.Tags {
+				if i != 0 {
+					b = append(b, ',')
+				}
+				b = appendKey(b, tag.Name)
+				b = appendString(b, tag.Value)
+			}
+
+			b = append(b, '}')
+		}
+
+		if m.Sampled() && naming.SampleRate != "" {
+			b = append(b, ',')
+			b = appendKey(b, naming.SampleRate)
+			b = strconv.AppendFloat(b, m.SampleRate, 'g', -1, 64)
+		}
+
+		b = append(b, '}', '\n')
+	}
+
+	return b
+}
+
+func appendKey(b []byte, key string) []byte {
+	b = appendString(b, key)
+	return append(b, ':')
+}
+
+func appendString(b []byte, s string) []byte {
+	return json.AppendEscape(b, s, 0)
+}
+
+func appendName(b []byte, measure, field string) []byte {
+	switch {
+	case field == "":
+		return appendString(b, measure)
+	case measure == "":
+		return appendString(b, field)
+	default:
+		// The names are escaped separately, the closing quote of the measure
+		// and the opening quote of the field are replaced by the dot.
+		b = appendString(b, measure)
+		b[len(b)-1] = '.'
+		n := len(b)
+		b = appendString(b, field)
+		return append(b[:n], b[n+1:]...)
+	}
+}
+
+func appendValue(b []byte, v stats.Value) []byte {
+	switch v.Type() {
+	case stats.Bool:
+		return strconv.AppendBool(b, v.Bool())
+	case stats.Int:
+		return strconv.AppendInt(b, v.Int(), 10)
+	case stats.Uint:
+		return strconv.AppendUint(b, v.Uint(), 10)
+	case stats.Float:
+		return appendFloat(b, v.Float())
+	case stats.Duration:
+		return appendFloat(b, v.Duration().Seconds())
+	default:
+		return append(b, "null"...)
+	}
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(b, `"NaN"`...)
+	case math.IsInf(f, +1):
+		return append(b, `"+Inf"`...)
+	case math.IsInf(f, -1):
+		return append(b, `"-Inf"`...)
+	default:
+		return strconv.AppendFloat(b, f, 'g', -1, 64)
+	}
+}
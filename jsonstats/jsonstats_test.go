@@ -0,0 +1,198 @@
+package jsonstats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+var testTime = time.Date(2024, 4, 18, 9, 45, 0, 500, time.UTC)
+
+var testMeasures = []stats.Measure{
+	{
+		Name: "http",
+		Fields: []stats.Field{
+			stats.MakeField("count", 1, stats.Counter),
+			stats.MakeField("rtt", 150*time.Millisecond, stats.Histogram),
+		},
+		Tags: []stats.Tag{stats.T("method", "GET"), stats.T("path", `/"quoted"`)},
+	},
+	{
+		Name:       "cache",
+		Fields:     []stats.Field{stats.MakeField("", math.Inf(+1), stats.Gauge)},
+		SampleRate: 0.5,
+	},
+	{
+		Name:   "users",
+		Fields: []stats.Field{stats.MakeField("ids", uint64(math.MaxUint64), stats.Distinct)},
+	},
+}
+
+func TestAppendMeasure(t *testing.T) {
+	tests := []struct {
+		naming *Naming
+		format TimeFormat
+		output string
+	}{
+		{
+			output: `{"time":"2024-04-18T09:45:00.0000005Z","name":"http.count","type":"counter","value":1,"tags":{"method":"GET","path":"/\"quoted\""}}
+{"time":"2024-04-18T09:45:00.0000005Z","name":"http.rtt","type":"histogram","value":0.15,"tags":{"method":"GET","path":"/\"quoted\""}}
+{"time":"2024-04-18T09:45:00.0000005Z","name":"cache","type":"gauge","value":"+Inf","sample_rate":0.5}
+{"time":"2024-04-18T09:45:00.0000005Z","name":"users.ids","type":"set","value":18446744073709551615}
+`,
+		},
+		{
+			naming: &ECSNaming,
+			output: `{"@timestamp":"2024-04-18T09:45:00.0000005Z","metric.name":"http.count","metric.type":"counter","metric.value":1,"labels":{"method":"GET","path":"/\"quoted\""}}
+{"@timestamp":"2024-04-18T09:45:00.0000005Z","metric.name":"http.rtt","metric.type":"histogram","metric.value":0.15,"labels":{"method":"GET","path":"/\"quoted\""}}
+{"@timestamp":"2024-04-18T09:45:00.0000005Z","metric.name":"cache","metric.type":"gauge","metric.value":"+Inf","metric.sample_rate":0.5}
+{"@timestamp":"2024-04-18T09:45:00.0000005Z","metric.name":"users.ids","metric.type":"set","metric.value":18446744073709551615}
+`,
+		},
+		{
+			naming: &OTelNaming,
+			format: UnixNano,
+			output: `{"timeUnixNano":1713433500000000500,"name":"http.count","type":"counter","value":1,"attributes":{"method":"GET","path":"/\"quoted\""}}
+{"timeUnixNano":1713433500000000500,"name":"http.rtt","type":"histogram","value":0.15,"attributes":{"method":"GET","path":"/\"quoted\""}}
+{"timeUnixNano":1713433500000000500,"name":"cache","type":"gauge","value":"+Inf","sampleRate":0.5}
+{"timeUnixNano":1713433500000000500,"name":"users.ids","type":"set","value":18446744073709551615}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var b []byte
+		for _, m := range testMeasures {
+			b = AppendMeasure(b, testTime, m, test.naming, test.format)
+		}
+		if s := string(b); s != test.output {
+			t.Errorf("bad output:\n%s\nexpected:\n%s", s, test.output)
+		}
+	}
+}
+
+func TestHandlerRoundTrip(t *testing.T) {
+	for _, naming := range []Naming{DefaultNaming, ECSNaming, OTelNaming} {
+		for _, format := range []TimeFormat{RFC3339, UnixNano} {
+			var b bytes.Buffer
+			h := NewHandlerWith(HandlerConfig{Output: &b, Naming: naming, TimeFormat: format})
+			h.HandleMeasures(testTime, testMeasures...)
+			h.Close()
+
+			if s := h.Stats(); s.BytesSent != uint64(b.Len()) {
+				t.Errorf("bad stats: %+v", s)
+			}
+
+			r := &statstest.Handler{}
+			d := NewDecoder(&b)
+			d.Naming = naming
+
+			if err := d.HandleAll(r); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []stats.Measure{
+				{Name: "http", Fields: []stats.Field{stats.MakeField("count", int64(1), stats.Counter)}, Tags: testMeasures[0].Tags},
+				{Name: "http", Fields: []stats.Field{stats.MakeField("rtt", 0.15, stats.Histogram)}, Tags: testMeasures[0].Tags},
+				{Name: "cache", Fields: []stats.Field{stats.MakeField("", math.Inf(+1), stats.Gauge)}, SampleRate: 0.5},
+				{Name: "users", Fields: []stats.Field{stats.MakeField("ids", uint64(math.MaxUint64), stats.Distinct)}},
+			}
+
+			if measures := r.Measures(); !reflect.DeepEqual(measures, expected) {
+				t.Errorf("bad measures decoded with %+v:\n%#v", naming, measures)
+			}
+			if r.FlushCalls() != 1 {
+				t.Error("the handler was not flushed")
+			}
+		}
+	}
+}
+
+func TestDecoderTime(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`{"time":1713433500000000500,"name":"a","value":1}` + "\n" +
+		`{"time":"2024-04-18T09:45:00.0000005Z","name":"a","value":1}`))
+
+	for range 2 {
+		tm, _, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tm.Equal(testTime) {
+			t.Error("bad time:", tm)
+		}
+	}
+}
+
+func TestZeroTime(t *testing.T) {
+	m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("", 1, stats.Counter)}}
+
+	for _, format := range []TimeFormat{RFC3339, UnixNano} {
+		b := AppendMeasure(nil, time.Time{}, m, nil, format)
+		if s, expected := string(b), `{"name":"a","type":"counter","value":1}`+"\n"; s != expected {
+			t.Errorf("bad output:\n%s\nexpected:\n%s", s, expected)
+		}
+
+		tm, _, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tm.IsZero() {
+			t.Error("bad time:", tm)
+		}
+	}
+}
+
+func TestDecoderSkipsOtherRecords(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`
+{"level":"info","msg":"server started"}
+{"time":"2024-04-18T09:45:00Z","name":"requests","type":"counter","value":3,"host":"web-1"}
+{"level":"error","name":"not a metric"}
+`))
+
+	_, m, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := stats.Measure{Name: "requests", Fields: []stats.Field{stats.MakeField("", int64(3), stats.Counter)}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("bad measure: %#v", m)
+	}
+
+	if _, _, err := d.Decode(); !errors.Is(err, io.EOF) {
+		t.Error("expected io.EOF, got", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, input := range []string{
+		`{"name":"a","value":"hello"}`,
+		`{"name":"a","value":1,"type":"timer"}`,
+		`{"name":"a","value":1,"time":"yesterday"}`,
+		`{"name":"a","value":1,"tags":["a","b"]}`,
+		`not json`,
+	} {
+		if _, _, err := NewDecoder(strings.NewReader(input)).Decode(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%s: expected an error, got %v", input, err)
+		}
+	}
+}
+
+func BenchmarkAppendMeasure(b *testing.B) {
+	buf := make([]byte, 0, 4096)
+
+	for b.Loop() {
+		buf = buf[:0]
+		for _, m := range testMeasures {
+			buf = AppendMeasure(buf, testTime, m, nil, RFC3339)
+		}
+	}
+}
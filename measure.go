@@ -20,17 +20,60 @@ type Measure struct {
 	Name   string
 	Fields []Field
 	Tags   []Tag
+
+	// The rate at which the measure was sampled, a value between 0 and 1.
+	// Zero means that the measure was not sampled.
+	SampleRate float64
+
+	// Optional set of the measure tags, which handlers use to identify series
+	// without hashing the tags again (see TagsHash). The set is only used when
+	// Tags is the slice returned by TagSet.Tags, so handlers that change the
+	// tags of a measure don't need to reset it.
+	TagSet TagSet
 }
 
 // Clone creates and returns a deep copy of m. The original and returned values
 // and do not share any pointers to mutable types (but may share string values
-// for example).
+// for example). The tags of a TagSet are immutable, so they are shared.
 func (m Measure) Clone() Measure {
-	return Measure{
-		Name:   m.Name,
-		Fields: copyFields(m.Fields),
-		Tags:   copyTags(m.Tags),
+	c := Measure{
+		Name:       m.Name,
+		Fields:     copyFields(m.Fields),
+		SampleRate: m.SampleRate,
+	}
+	if s, ok := m.ValidTagSet(); ok {
+		c.Tags, c.TagSet = s.Tags(), s
+	} else {
+		c.Tags = copyTags(m.Tags)
 	}
+	return c
+}
+
+// TagsHash returns the hash of the tags of m, which handlers may use as a key
+// to identify series. It is the hash of the TagSet of m when it has one, or
+// the value returned by HashTags otherwise.
+func (m Measure) TagsHash() uint64 {
+	if s, ok := m.ValidTagSet(); ok {
+		return s.Hash()
+	}
+	return HashTags(m.Tags)
+}
+
+// ValidTagSet returns the TagSet of m, and whether it holds the tags of m.
+// Handlers may compare the sets of measures that have one instead of their
+// tags.
+func (m Measure) ValidTagSet() (TagSet, bool) {
+	s := m.TagSet
+	if s.set == nil || len(m.Tags) != len(s.set.tags) || len(m.Tags) == 0 {
+		return TagSet{}, false
+	}
+	return s, &m.Tags[0] == &s.set.tags[0]
+}
+
+// Sampled returns true if m was sampled, in which case SampleRate holds the
+// rate at which it was sampled.
+func (m Measure) Sampled() bool {
+	return m.SampleRate > 0 && m.SampleRate < 1
 }
 
 func (m Measure) String() string {
@@ -66,7 +109,8 @@ func stringTags(tags []Tag) []string {
 //     int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
 //     float32, float64, or time.Duration, and represent fields of the measures.
 //     The struct fields may also define a 'type' tag with a value of "counter",
-//     "gauge" or "histogram" to tune the behavior of the measure handlers.
+//     "gauge", "histogram" or "set" to tune the behavior of the measure
+//     handlers.
 //
 //  2. All fields exposing a 'tag' tag are expected to be of type string and
 //     represent tags of the measures.
@@ -74,13 +118,74 @@ func stringTags(tags []Tag) []string {
 //  3. All struct fields are searched recursively for fields matching rule (1)
 //     and (2). Tags found within a struct are inherited by measures generated from
 //     sub-fields, they may also be overwritten.
+//
+//  4. Fields of measures may also define 'help' and 'unit' tags, which are
+//     registered in the Descriptions registry for the handlers that expose
+//     metric metadata.
+//
+// If value implements the MeasureAppender interface, its AppendMeasures method
+// is used instead of reflection.
 func MakeMeasures(prefix string, value interface{}, tags ...Tag) []Measure {
 	if !TagsAreSorted(tags) {
 		SortTags(tags)
 	}
+	if a, ok := value.(MeasureAppender); ok {
+		return a.AppendMeasures(nil, prefix, tags...)
+	}
 	return makeMeasures(nil, prefix, reflect.ValueOf(value), tags...)
 }
 
+// MeasureAppender is implemented by types which append the measures that they
+// represent to a slice. MakeMeasures and Engine.Report use the AppendMeasures
+// method of values implementing the interface instead of walking their struct
+// fields with reflection.
+//
+// The cmd/statsgen program generates implementations of this interface from
+// the same struct tags as the ones described in MakeMeasures.
+type MeasureAppender interface {
+	// AppendMeasures appends the measures to the given slice and returns it.
+	// The names of the measures are prefixed with prefix, and tags must be
+	// merged with the tags of the measures in sorted order.
+	AppendMeasures(measures []Measure, prefix string, tags ...Tag) []Measure
+}
+
+// AppendMeasure appends to measures a measure named after prefix and name, with
+// a copy of fields, and the merge of the sorted tag lists structTags and tags.
+// The memory held by the measure past the end of the slice is reused when the
+// slice has enough capacity.
+//
+// The function is intended to be used by implementations of MeasureAppender.
+func AppendMeasure(measures []Measure, prefix, name string, fields []Field, structTags, tags []Tag) []Measure {
+	n := len(measures)
+
+	if n < cap(measures) {
+		measures = measures[:n+1]
+	} else {
+		measures = append(measures, Measure{})
+	}
+
+	m := &measures[n]
+	m.Name = concat(prefix, name)
+	m.Fields = append(m.Fields[:0], fields...)
+	m.Tags = appendSortedTags(m.Tags[:0], structTags, tags)
+	m.SampleRate = 0
+	return measures
+}
+
+// appendSortedTags appends the merge of the sorted tag lists t1 and t2 to tags,
+// the tags of t2 come first when both lists have tags with the same name.
+func appendSortedTags(tags, t1, t2 []Tag) []Tag {
+	for len(t1) != 0 && len(t2) != 0 {
+		if t1[0].Name < t2[0].Name {
+			tags, t1 = append(tags, t1[0]), t1[1:]
+		} else {
+			tags, t2 = append(tags, t2[0]), t2[1:]
+		}
+	}
+	tags = append(tags, t1...)
+	return append(tags, t2...)
+}
+
 func makeMeasures(cache *measureCache, prefix string, value reflect.Value, tags ...Tag) []Measure {
 	return appendMeasures(nil, cache, prefix, value, tags...)
 }
@@ -207,6 +312,7 @@ func (m *Measure) reset() {
 	m.Name = ""
 	m.Fields = m.Fields[:0]
 	m.Tags = m.Tags[:0]
+	m.SampleRate = 0
 }
 
 type measureFuncs struct {
@@ -273,6 +379,15 @@ func appendMeasureFuncs(measures []measureFuncs, typ reflect.Type, name string,
 					panic("unsupported value type found for metric " + concat(name, metric) + ": " + field.Type.String())
 				}
 				mf.fields = append(mf.fields, f)
+
+				if help, unit := field.Tag.Get("help"), field.Tag.Get("unit"); help != "" || unit != "" {
+					Descriptions.SetField(Key{Measure: name, Field: metric}, Description{
+						Help:    help,
+						Unit:    unit,
+						Type:    t,
+						HasType: true,
+					})
+				}
 			}
 		}
 	}
@@ -395,6 +510,8 @@ func makeFieldType(mtype string) FieldType {
 		return Counter
 	case "gauge":
 		return Gauge
+	case "set":
+		return Distinct
 	default:
 		return Histogram
 	}
@@ -171,3 +171,47 @@ func TestMakeMeasures(t *testing.T) {
 		t.Logf("found:    %#v", measures)
 	}
 }
+
+type appenderMetrics struct {
+	calls struct {
+		count int           `metric:"count" type:"counter"`
+		time  time.Duration `metric:"time"  type:"histogram"`
+	} `metric:"calls"`
+
+	host string `tag:"host"`
+	zone string `tag:"zone"`
+}
+
+func (m *appenderMetrics) AppendMeasures(measures []Measure, prefix string, tags ...Tag) []Measure {
+	return AppendMeasure(measures, prefix, "calls", []Field{
+		IntField("count", int64(m.calls.count), Counter),
+		DurationField("time", m.calls.time, Histogram),
+	}, []Tag{
+		{Name: "host", Value: m.host},
+		{Name: "zone", Value: m.zone},
+	}, tags)
+}
+
+func TestMakeMeasuresAppender(t *testing.T) {
+	m := &appenderMetrics{host: "localhost", zone: "us-west-2a"}
+	m.calls.count = 1
+	m.calls.time = time.Second
+
+	tags := []Tag{T("a", "1"), T("host", "other"), T("type", "test")}
+
+	expected := makeMeasures(nil, "prefix", reflect.ValueOf(m), tags...)
+	found := MakeMeasures("prefix", m, tags...)
+
+	if !reflect.DeepEqual(expected, found) {
+		t.Error("bad measures:")
+		t.Logf("expected: %v", expected)
+		t.Logf("found:    %v", found)
+	}
+
+	// The memory of measures past the end of the slice is reused.
+	found = m.AppendMeasures(found[:0], "", tags...)
+
+	if found[0].Name != "calls" || len(found[0].Fields) != 2 || len(found[0].Tags) != 5 {
+		t.Error("bad measure:", found[0])
+	}
+}
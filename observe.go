@@ -0,0 +1,187 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultObserveInterval is the default interval at which the callbacks of a
+// MetricObservers registry are run by Start.
+const DefaultObserveInterval = 15 * time.Second
+
+// MetricObservers is a registry of callbacks producing measures on demand, for
+// values which are cheaper to read when they are collected than to track as
+// they change, like the size of a pool or the length of a queue.
+//
+// The callbacks are run by calls to Collect, either periodically by the
+// goroutine started by Start, or by pull-based handlers when they are scraped,
+// like prometheus.Handler. Measures produced by callbacks are forwarded to the
+// handler of the engine that the callback was registered on.
+//
+// The zero value is an empty registry. Registries are safe to use concurrently
+// from multiple goroutines.
+type MetricObservers struct {
+	mutex     sync.Mutex
+	observers []*observer
+
+	// Serializes the calls to Collect, so the callbacks are never run
+	// concurrently.
+	collect sync.Mutex
+}
+
+// Observers is the registry where callbacks are registered by engines that
+// don't have their Observers field set.
+var Observers = &MetricObservers{}
+
+// Collect runs all the callbacks of the registry. Callbacks that panic are
+// reported to the error handler (see SetErrorHandler), and don't prevent the
+// other callbacks from running.
+func (o *MetricObservers) Collect() {
+	o.collect.Lock()
+	defer o.collect.Unlock()
+
+	o.mutex.Lock()
+	observers := slices.Clone(o.observers)
+	o.mutex.Unlock()
+
+	for _, obs := range observers {
+		obs.call()
+	}
+}
+
+// Start starts a goroutine which runs the callbacks of the registry every
+// interval, until the returned io.Closer is closed. If interval is zero,
+// DefaultObserveInterval is used.
+func (o *MetricObservers) Start(interval time.Duration) io.Closer {
+	if interval <= 0 {
+		interval = DefaultObserveInterval
+	}
+
+	stop := make(chan struct{})
+	join := make(chan struct{})
+
+	go func() {
+		defer close(join)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				o.Collect()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return &observersCloser{stop: stop, join: join}
+}
+
+// Len returns the number of callbacks in the registry.
+func (o *MetricObservers) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.observers)
+}
+
+func (o *MetricObservers) register(fn func()) io.Closer {
+	obs := &observer{registry: o, fn: fn}
+	o.mutex.Lock()
+	o.observers = append(o.observers, obs)
+	o.mutex.Unlock()
+	return obs
+}
+
+func (o *MetricObservers) unregister(obs *observer) {
+	o.mutex.Lock()
+	o.observers = slices.DeleteFunc(o.observers, func(x *observer) bool { return x == obs })
+	o.mutex.Unlock()
+}
+
+type observersCloser struct {
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
+}
+
+func (c *observersCloser) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
+	return nil
+}
+
+// observer is a callback of a MetricObservers registry, closing it removes it
+// from the registry.
+type observer struct {
+	registry *MetricObservers
+	fn       func()
+	once     sync.Once
+}
+
+func (obs *observer) Close() error {
+	obs.once.Do(func() { obs.registry.unregister(obs) })
+	return nil
+}
+
+func (obs *observer) call() {
+	defer func() {
+		if err := recover(); err != nil {
+			HandleError(fmt.Errorf("stats: observer callback panicked: %v", err))
+		}
+	}()
+	obs.fn()
+}
+
+// ObserveFunc registers fn as a callback reporting the value of the gauge
+// identified by name and tags, each time the callbacks of the engine are
+// collected (see MetricObservers). Closing the returned io.Closer unregisters
+// the callback.
+func (e *Engine) ObserveFunc(name string, fn func() float64, tags ...Tag) io.Closer {
+	tags = copyTags(tags)
+	return e.observers().register(func() {
+		e.Set(name, fn(), tags...)
+	})
+}
+
+// ObserveCounterFunc registers fn as a callback returning the running total of
+// the counter identified by name and tags. Each time the callbacks of the
+// engine are collected (see MetricObservers), the counter is incremented by
+// the difference with the total returned by the previous call, or by the
+// total itself on the first call, or if it decreased (which is handled as a
+// counter reset). Closing the returned io.Closer unregisters the callback.
+func (e *Engine) ObserveCounterFunc(name string, fn func() float64, tags ...Tag) io.Closer {
+	tags = copyTags(tags)
+	last := 0.0
+	return e.observers().register(func() {
+		value := fn()
+		delta := value - last
+		if value < last {
+			delta = value
+		}
+		last = value
+		e.Add(name, delta, tags...)
+	})
+}
+
+// ObserveBatch registers fn as a callback producing measures on the engine it
+// receives, which is e, each time the callbacks of the engine are collected
+// (see MetricObservers). Batch callbacks are useful to report multiple values
+// read at once, for example by calling Report. Closing the returned io.Closer
+// unregisters the callback.
+func (e *Engine) ObserveBatch(fn func(*Engine)) io.Closer {
+	return e.observers().register(func() { fn(e) })
+}
+
+func (e *Engine) observers() *MetricObservers {
+	if e.Observers != nil {
+		return e.Observers
+	}
+	return Observers
+}
@@ -0,0 +1,117 @@
+package stats_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestObservers(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	t.Run("gauges", func(t *testing.T) {
+		h := &statstest.Handler{}
+		e := stats.NewEngine("", h)
+		e.Observers = &stats.MetricObservers{}
+
+		size := 3.0
+		c := e.WithPrefix("pool").ObserveFunc("size", func() float64 { return size }, stats.T("pool", "db"))
+
+		e.Observers.Collect()
+		size = 5
+		e.Observers.Collect()
+
+		metrics := h.Select("pool.size", stats.T("pool", "db"))
+		assert.Len(t, metrics, 2)
+		last, _ := metrics.Last()
+		assert.Equal(t, 5.0, last)
+
+		assert.NoError(t, c.Close())
+		assert.NoError(t, c.Close())
+		e.Observers.Collect()
+		assert.Len(t, h.Select("pool.size"), 2, "closed callbacks must not run")
+		assert.Equal(t, 0, e.Observers.Len())
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		h := &statstest.Handler{}
+		e := stats.NewEngine("", h)
+		e.Observers = &stats.MetricObservers{}
+
+		total := 10.0
+		e.ObserveCounterFunc("hits", func() float64 { return total })
+
+		var deltas []float64
+		for _, v := range []float64{10, 15, 15, 4} {
+			total = v
+			h.Clear()
+			e.Observers.Collect()
+			deltas = append(deltas, h.Select("hits").Sum())
+		}
+		assert.Equal(t, []float64{10, 5, 0, 4}, deltas)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		h := &statstest.Handler{}
+		e := stats.NewEngine("cache", h)
+		e.Observers = &stats.MetricObservers{}
+
+		e.ObserveBatch(func(e *stats.Engine) {
+			e.Set("entries", 100)
+			e.Set("bytes", 4096)
+		})
+		e.Observers.Collect()
+
+		statstest.AssertGauge(t, h, "cache.entries", 100)
+		statstest.AssertGauge(t, h, "cache.bytes", 4096)
+	})
+
+	t.Run("panics are reported", func(t *testing.T) {
+		var errs []error
+		stats.SetErrorHandler(stats.ErrorHandlerFunc(func(err error) { errs = append(errs, err) }))
+		defer stats.SetErrorHandler(nil)
+
+		h := &statstest.Handler{}
+		e := stats.NewEngine("", h)
+		e.Observers = &stats.MetricObservers{}
+
+		e.ObserveFunc("broken", func() float64 { panic("boom") })
+		e.ObserveFunc("working", func() float64 { return 1 })
+		e.Observers.Collect()
+
+		statstest.AssertGauge(t, h, "working", 1)
+		assert.Equal(t, []error{errors.New("stats: observer callback panicked: boom")}, errs)
+	})
+
+	t.Run("scheduler", func(t *testing.T) {
+		h := &statstest.Handler{}
+		e := stats.NewEngine("", h)
+		e.Observers = &stats.MetricObservers{}
+
+		var mutex sync.Mutex
+		calls := 0
+		e.ObserveFunc("calls", func() float64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			calls++
+			return float64(calls)
+		})
+
+		s := e.Observers.Start(time.Millisecond)
+		assert.Eventually(t, func() bool { return len(h.Select("calls")) >= 3 }, time.Second, time.Millisecond)
+		assert.NoError(t, s.Close())
+		assert.NoError(t, s.Close())
+
+		n := len(h.Select("calls"))
+		time.Sleep(10 * time.Millisecond)
+		assert.Len(t, h.Select("calls"), n, "the scheduler must stop when closed")
+	})
+}
@@ -2,15 +2,18 @@ module github.com/segmentio/stats/v5/otlp
 
 go 1.24.0
 
+// The otlp module uses the sample rates, tag sets, handler counters and metric
+// descriptions added in stats v5.9.0. It builds against the parent directory
+// until that version is tagged, see the replace directive below.
 require (
-	github.com/segmentio/stats/v5 v5.6.3
+	github.com/segmentio/stats/v5 v5.9.0
 	go.opentelemetry.io/proto/otlp v1.3.1
 	google.golang.org/protobuf v1.36.10
 )
 
 require (
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0 // indirect
-	golang.org/x/exp v0.0.0-20250506013437-ce4c2cf36ca6 // indirect
+	github.com/segmentio/fasthash v1.0.3 // indirect
 	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
@@ -18,3 +21,5 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
 	google.golang.org/grpc v1.79.3 // indirect
 )
+
+replace github.com/segmentio/stats/v5 => ../
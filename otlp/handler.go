@@ -5,14 +5,15 @@ import (
 	"context"
 	"fmt"
 	"hash/maphash"
-	"log"
 	"sync"
 	"time"
 
 	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/sketch"
 )
 
 const (
@@ -39,13 +40,26 @@ const (
 //
 // This Handler leverages a doubly linked list with a map to implement
 // a ring buffer with a lookup to ensure a low memory usage.
+//
+// The handler counts the requests it sent to the destination, and the metrics
+// it discarded, which the program can monitor with the Stats method. The bytes
+// sent are the size of the protobuf encoding of the requests.
 type Handler struct {
 	Client        Client
 	Context       context.Context
 	FlushInterval time.Duration
 	MaxMetrics    int
 
-	once sync.Once
+	// ErrorHandler receives the errors encountered by the handler when
+	// flushing metrics. If nil, the errors are passed to stats.HandleError.
+	ErrorHandler stats.ErrorHandler
+
+	counters stats.HandlerCounters
+
+	once      sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+	join      chan struct{}
 
 	mu      sync.RWMutex
 	ordered list.List
@@ -65,56 +79,117 @@ func NewHandler(ctx context.Context, endpoint string) *Handler {
 	}
 }
 
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	h.once.Do(h.init)
+	h.handleMeasures(t, measures...)
+}
+
+// HandlerMeasure is an alias of HandleMeasures.
+//
+// Deprecated: the method was misnamed, use HandleMeasures instead.
 func (h *Handler) HandlerMeasure(t time.Time, measures ...stats.Measure) {
-	h.once.Do(func() {
-		if h.FlushInterval == 0 {
-			return
-		}
+	h.HandleMeasures(t, measures...)
+}
 
-		go h.start(h.Context)
+// Flush sends the metrics that were updated since the last flush to the
+// OpenTelemetry destination, satisfies the stats.Flusher interface.
+func (h *Handler) Flush() {
+	if err := h.flush(); err != nil {
+		h.handleError(err)
+	}
+}
+
+// Stats returns a snapshot of the counters of the handler.
+func (h *Handler) Stats() stats.HandlerStats {
+	return h.counters.Stats()
+}
+
+// Close stops the background flushing of metrics and sends the metrics that
+// were updated since the last flush, satisfies the io.Closer and stats.Closer
+// interfaces.
+func (h *Handler) Close() error {
+	h.once.Do(h.init)
+	h.closeOnce.Do(func() {
+		if h.done != nil {
+			close(h.done)
+			<-h.join
+		}
 	})
+	return h.flush()
+}
 
-	h.handleMeasures(t, measures...)
+func (h *Handler) init() {
+	if h.FlushInterval == 0 {
+		return
+	}
+
+	h.done = make(chan struct{})
+	h.join = make(chan struct{})
+
+	go h.start(h.context())
 }
 
 func (h *Handler) start(ctx context.Context) {
-	defer h.flush()
+	defer close(h.join)
 
 	t := time.NewTicker(h.FlushInterval)
+	defer t.Stop()
 
 	for {
 		select {
 		case <-t.C:
-			if err := h.flush(); err != nil {
-				log.Printf("stats/otlp: %s", err)
-			}
+			h.Flush()
 		case <-ctx.Done():
-			break
+			h.Flush()
+			return
+		case <-h.done:
+			return
 		}
 	}
 }
 
+func (h *Handler) context() context.Context {
+	if h.Context != nil {
+		return h.Context
+	}
+	return context.Background()
+}
+
 func (h *Handler) handleMeasures(t time.Time, measures ...stats.Measure) {
 	for _, measure := range measures {
+		// Sampled counters and histograms are scaled back up by the inverse
+		// of their sample rate.
+		weight := 1.0
+		if measure.Sampled() {
+			weight = 1 / measure.SampleRate
+		}
+
+		tags := tagsHash(&measure)
+
 		for _, field := range measure.Fields {
 			m := metric{
 				time:        t,
 				measureName: measure.Name,
 				fieldName:   field.Name,
 				fieldType:   field.Type(),
-				tags:        measure.Tags,
 				value:       field.Value,
 			}
 
-			if field.Type() == stats.Histogram {
+			switch field.Type() {
+			case stats.Counter:
+				if weight != 1 {
+					m.value = stats.ValueOf(valueOf(m.value) * weight)
+				}
+			case stats.Histogram:
 				k := stats.Key{Measure: measure.Name, Field: field.Name}
-				m.sum = valueOf(m.value)
+				m.sum = valueOf(m.value) * weight
 				m.buckets = makeMetricBuckets(stats.Buckets[k])
-				m.buckets.update(valueOf(m.value))
-				m.count++
+				m.buckets.update(valueOf(m.value), weight)
+				m.count += weight
 			}
 
-			sign := m.signature()
+			sign := signature(measure.Name, field.Name, tags)
 			m.sign = sign
 
 			known := h.lookup(sign, func(a *metric) *metric {
@@ -122,20 +197,29 @@ func (h *Handler) handleMeasures(t time.Time, measures ...stats.Measure) {
 				case stats.Counter:
 					a.value = a.add(m.value)
 				case stats.Histogram:
-					a.sum += valueOf(m.value)
-					a.count++
+					a.sum += m.sum
+					a.count += m.count
 					for i := range a.buckets {
 						a.buckets[i].count += m.buckets[i].count
 					}
+				case stats.Distinct:
+					a.set.Add(m.value.Uint())
 				}
 				return a
 			})
 
 			if known == nil {
+				m.tags = metricTags(&measure)
+
+				if m.fieldType == stats.Distinct {
+					m.set = &sketch.HyperLogLog{}
+					m.set.Add(m.value.Uint())
+				}
+
 				n := h.push(sign, &m)
 				if n > h.MaxMetrics {
 					if err := h.flush(); err != nil {
-						log.Printf("stats/otlp: %s", err)
+						h.handleError(err)
 					}
 				}
 			}
@@ -173,13 +257,20 @@ func (h *Handler) flush() error {
 		},
 	}
 
-	if err := h.Client.Handle(h.Context, request); err != nil {
-		return fmt.Errorf("failed to flush measures: %s", err)
+	if err := h.Client.Handle(h.context(), request); err != nil {
+		h.counters.WriteError()
+		h.counters.Dropped(len(metrics))
+		return fmt.Errorf("failed to flush measures: %w", err)
 	}
 
+	h.counters.Sent(proto.Size(request))
 	return nil
 }
 
+func (h *Handler) handleError(err error) {
+	stats.HandleErrorWith(h.ErrorHandler, fmt.Errorf("stats/otlp: %w", err))
+}
+
 func (h *Handler) lookup(signature uint64, update func(*metric) *metric) *metric {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -208,6 +299,10 @@ func (h *Handler) push(sign uint64, m *metric) int {
 		last := h.ordered.Back()
 		h.ordered.Remove(last)
 		delete(h.metrics, last.Value.(*metric).sign)
+
+		if !last.Value.(*metric).flushed {
+			h.counters.Dropped(1)
+		}
 	}
 
 	return len(h.metrics)
@@ -1,6 +1,8 @@
 package otlp
 
 import (
+	"math"
+
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
 
@@ -13,8 +15,12 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 	for _, metric := range metrics {
 		attributes := tagsToAttributes(metric.tags...)
 
+		desc, _ := stats.Descriptions.Lookup(stats.Key{Measure: metric.measureName, Field: metric.fieldName})
+
 		m := &metricpb.Metric{
-			Name: metric.measureName + "." + metric.fieldName,
+			Name:        metric.measureName + "." + metric.fieldName,
+			Description: desc.Help,
+			Unit:        desc.Unit,
 		}
 
 		switch metric.fieldType {
@@ -64,18 +70,31 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 
 			for i, b := range metric.buckets {
 				explicitBounds[i] = b.upperBound
-				bucketCounts[i] = b.count
+				bucketCounts[i] = uint64(math.Round(b.count))
 			}
 
 			histogram := m.GetHistogram()
 			histogram.DataPoints = append(histogram.DataPoints, &metricpb.HistogramDataPoint{
 				TimeUnixNano:   uint64(metric.time.UnixNano()),
 				Sum:            &metric.sum,
-				Count:          metric.count,
+				Count:          uint64(math.Round(metric.count)),
 				ExplicitBounds: explicitBounds,
 				BucketCounts:   bucketCounts,
 			})
 
+		case stats.Distinct:
+			// Sets are exported as gauges estimating the number of distinct
+			// values that the series received.
+			m.Data = &metricpb.Metric_Gauge{
+				Gauge: &metricpb.Gauge{
+					DataPoints: []*metricpb.NumberDataPoint{{
+						TimeUnixNano: uint64(metric.time.UnixNano()),
+						Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: math.Round(metric.set.Estimate())},
+						Attributes:   attributes,
+					}},
+				},
+			}
+
 		default:
 		}
 
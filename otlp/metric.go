@@ -1,11 +1,12 @@
 package otlp
 
 import (
+	"encoding/binary"
 	"hash/maphash"
-	"sort"
 	"time"
 
 	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/sketch"
 )
 
 type metric struct {
@@ -17,29 +18,50 @@ type metric struct {
 	value       stats.Value
 	sum         float64
 	sign        uint64
-	count       uint64
+	count       float64
 	buckets     metricBuckets
+	set         *sketch.HyperLogLog
 	tags        []stats.Tag
 }
 
-func (m *metric) signature() uint64 {
+// signature returns the key of the series of a metric, tags is the hash of the
+// tags of its measure, which is computed once for all fields.
+func signature(measureName, fieldName string, tags uint64) uint64 {
 	h := maphash.Hash{}
 	h.SetSeed(hashseed)
-	h.WriteString(m.measureName)
-	h.WriteString(m.fieldName)
+	h.WriteString(measureName)
+	h.WriteString(fieldName)
 
-	sort.Slice(m.tags, func(i, j int) bool {
-		return m.tags[i].Name > m.tags[j].Name
-	})
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], tags)
+	h.Write(b[:])
 
-	for _, tag := range m.tags {
-		h.WriteString(tag.String())
+	return h.Sum64()
+}
+
+// tagsHash returns the hash of the tags of measure, which doesn't depend on the
+// order of the tags. The tags of the measure are not modified.
+func tagsHash(measure *stats.Measure) uint64 {
+	if _, ok := measure.ValidTagSet(); ok || stats.TagsAreSorted(measure.Tags) {
+		return measure.TagsHash()
 	}
+	return stats.NewTagSet(measure.Tags...).Hash()
+}
 
-	return h.Sum64()
+// metricTags returns the tags of measure that a new metric retains. They are
+// copied unless they belong to a tag set, since the program may reuse them.
+func metricTags(measure *stats.Measure) []stats.Tag {
+	if s, ok := measure.ValidTagSet(); ok {
+		return s.Tags()
+	}
+	return append([]stats.Tag(nil), measure.Tags...)
 }
 
 func (m *metric) add(v stats.Value) stats.Value {
+	if m.value.Type() != v.Type() {
+		return stats.ValueOf(valueOf(m.value) + valueOf(v))
+	}
+
 	switch v.Type() {
 	case stats.Int:
 		return stats.ValueOf(m.value.Int() + v.Int())
@@ -52,7 +74,7 @@ func (m *metric) add(v stats.Value) stats.Value {
 }
 
 type bucket struct {
-	count      uint64
+	count      float64
 	upperBound float64
 }
 
@@ -66,10 +88,10 @@ func makeMetricBuckets(buckets []stats.Value) metricBuckets {
 	return b
 }
 
-func (b metricBuckets) update(v float64) {
+func (b metricBuckets) update(v, weight float64) {
 	for i := range b {
 		if v <= b[i].upperBound {
-			b[i].count++
+			b[i].count += weight
 			break
 		}
 	}
@@ -2,10 +2,12 @@ package otlp
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -86,6 +88,67 @@ var (
 				},
 			},
 		},
+		{
+			in: []stats.Measure{
+				{
+					Name: "foobar",
+					Fields: []stats.Field{
+						stats.MakeField("users", stats.HashValue("alice"), stats.Distinct),
+						stats.MakeField("users", stats.HashValue("bob"), stats.Distinct),
+						stats.MakeField("users", stats.HashValue("alice"), stats.Distinct),
+					},
+					Tags: []stats.Tag{{Name: "env", Value: "dev"}},
+				},
+			},
+			out: []*metricpb.Metric{
+				{
+					Name: "foobar.users",
+					Data: &metricpb.Metric_Gauge{
+						Gauge: &metricpb.Gauge{
+							DataPoints: []*metricpb.NumberDataPoint{
+								{
+									TimeUnixNano: uint64(now.UnixNano()),
+									Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: 2},
+									Attributes:   tagsToAttributes(stats.T("env", "dev")),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			in: []stats.Measure{
+				{
+					Name:       "foobar",
+					Fields:     []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+					Tags:       []stats.Tag{{Name: "env", Value: "dev"}},
+					SampleRate: 0.25,
+				},
+				{
+					Name:   "foobar",
+					Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+					Tags:   []stats.Tag{{Name: "env", Value: "dev"}},
+				},
+			},
+			out: []*metricpb.Metric{
+				{
+					Name: "foobar.count",
+					Data: &metricpb.Metric_Sum{
+						Sum: &metricpb.Sum{
+							AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*metricpb.NumberDataPoint{
+								{
+									TimeUnixNano: uint64(now.UnixNano()),
+									Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: 5},
+									Attributes:   tagsToAttributes(stats.T("env", "dev")),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			in: []stats.Measure{
 				{
@@ -98,7 +161,9 @@ var (
 			},
 			out: []*metricpb.Metric{
 				{
-					Name: "foobar.gauge",
+					Name:        "foobar.gauge",
+					Description: "The answer to the ultimate question.",
+					Unit:        "{answer}",
 					Data: &metricpb.Metric_Gauge{
 						Gauge: &metricpb.Gauge{
 							DataPoints: []*metricpb.NumberDataPoint{
@@ -127,6 +192,13 @@ func initTest() {
 		100,
 		1000,
 	)
+
+	stats.Describe("foobar.gauge", stats.Description{
+		Help:    "The answer to the ultimate question.",
+		Unit:    "{answer}",
+		Type:    stats.Gauge,
+		HasType: true,
+	})
 }
 
 func TestHandler(t *testing.T) {
@@ -197,7 +269,7 @@ func TestSendOtel(t *testing.T) {
 	for i, test := range handleTests {
 		idx, tc := i, test
 		t.Run(fmt.Sprintf("handle-%d", idx), func(_ *testing.T) {
-			h.HandlerMeasure(now, tc.in...)
+			h.HandleMeasures(now, tc.in...)
 		})
 	}
 
@@ -205,3 +277,170 @@ func TestSendOtel(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+type recordingClient struct {
+	mutex    sync.Mutex
+	requests []*colmetricpb.ExportMetricsServiceRequest
+}
+
+func (c *recordingClient) Handle(_ context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests = append(c.requests, request)
+	return nil
+}
+
+func (c *recordingClient) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.requests)
+}
+
+var _ stats.Closer = (*Handler)(nil)
+
+func TestHandlerClose(t *testing.T) {
+	c := &recordingClient{}
+	h := &Handler{
+		Client:        c,
+		Context:       context.Background(),
+		FlushInterval: time.Hour,
+		MaxMetrics:    DefaultMaxMetrics,
+	}
+
+	h.HandleMeasures(now, stats.Measure{
+		Name:   "foobar",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+
+	if n := c.count(); n != 0 {
+		t.Fatal("metrics were sent before the handler was closed:", n)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.count(); n != 1 {
+		t.Fatal("bad number of requests after closing the handler:", n)
+	}
+
+	// Closing again does not send the metrics that were already flushed.
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.count(); n != 1 {
+		t.Fatal("bad number of requests after closing the handler twice:", n)
+	}
+}
+
+type failingClient struct{}
+
+func (failingClient) Handle(context.Context, *colmetricpb.ExportMetricsServiceRequest) error {
+	return errors.New("unavailable")
+}
+
+func TestHandlerStats(t *testing.T) {
+	var errs []error
+	h := &Handler{
+		Client:       &recordingClient{},
+		Context:      context.Background(),
+		MaxMetrics:   DefaultMaxMetrics,
+		ErrorHandler: stats.ErrorHandlerFunc(func(err error) { errs = append(errs, err) }),
+	}
+
+	measure := stats.Measure{
+		Name: "foobar",
+		Fields: []stats.Field{
+			stats.MakeField("count", 1, stats.Counter),
+			stats.MakeField("value", 2, stats.Gauge),
+		},
+	}
+
+	h.HandleMeasures(now, measure)
+	h.Flush()
+
+	if s := h.Stats(); s.PacketsSent != 1 || s.BytesSent == 0 || s.WriteErrors != 0 {
+		t.Errorf("bad stats after a successful flush: %+v", s)
+	}
+
+	h.Client = failingClient{}
+	measure.Name = "other"
+	h.HandleMeasures(now, measure)
+	h.Flush()
+
+	if s := h.Stats(); s.PacketsSent != 1 || s.WriteErrors != 1 || s.DroppedMetrics != 2 {
+		t.Errorf("bad stats after a failed flush: %+v", s)
+	}
+
+	if len(errs) != 1 || errs[0].Error() != "stats/otlp: failed to flush measures: unavailable" {
+		t.Error("bad errors:", errs)
+	}
+}
+
+func TestHandlerTagsSignature(t *testing.T) {
+	h := &Handler{MaxMetrics: DefaultMaxMetrics}
+
+	tags := []stats.Tag{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}
+	unsorted := []stats.Tag{tags[1], tags[0]}
+	set := stats.NewTagSet(tags...)
+
+	h.handleMeasures(now,
+		stats.Measure{Name: "foo", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}, Tags: tags},
+		stats.Measure{Name: "foo", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}, Tags: unsorted},
+		stats.Measure{Name: "foo", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}, Tags: set.Tags(), TagSet: set},
+	)
+
+	if !reflect.DeepEqual(unsorted, []stats.Tag{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}}) {
+		t.Error("the tags of the measure were modified:", unsorted)
+	}
+
+	if n := len(h.metrics); n != 1 {
+		t.Fatalf("the measures produced %d series instead of 1", n)
+	}
+
+	m := h.ordered.Front().Value.(*metric)
+	if m.value.Int() != 3 {
+		t.Error("bad counter value:", m.value)
+	}
+
+	// The metric must not retain the tags of the program.
+	tags[0].Value = "changed"
+	if m.tags[0].Value != "1" {
+		t.Error("the metric shares the tags of the measure:", m.tags)
+	}
+}
+
+func BenchmarkHandleMeasuresTagSet(b *testing.B) {
+	tags := stats.NewTagSet(
+		stats.T("cluster", "production"),
+		stats.T("host", "web-1234"),
+		stats.T("method", "GET"),
+		stats.T("path", "/api/v1/users"),
+		stats.T("service", "api"),
+		stats.T("status", "200"),
+	)
+	fields := []stats.Field{
+		stats.MakeField("count", 1, stats.Counter),
+		stats.MakeField("bytes", 512, stats.Counter),
+		stats.MakeField("inflight", 10, stats.Gauge),
+	}
+
+	b.Run("tags", func(b *testing.B) {
+		h := &Handler{MaxMetrics: DefaultMaxMetrics}
+		m := stats.Measure{Name: "http", Fields: fields, Tags: append([]stats.Tag(nil), tags.Tags()...)}
+
+		for b.Loop() {
+			h.handleMeasures(now, m)
+		}
+	})
+
+	b.Run("tagset", func(b *testing.B) {
+		h := &Handler{MaxMetrics: DefaultMaxMetrics}
+		m := stats.Measure{Name: "http", Fields: fields, Tags: tags.Tags(), TagSet: tags}
+
+		for b.Loop() {
+			h.handleMeasures(now, m)
+		}
+	})
+}
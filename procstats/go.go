@@ -21,7 +21,12 @@ func init() {
 	)
 }
 
+//go:generate go run github.com/segmentio/stats/v5/cmd/statsgen -type=GoMetrics
+
 // GoMetrics is a metric collector that reports metrics from the Go runtime.
+//
+// GoMetrics reads runtime.MemStats, which stops the world, see RuntimeMetrics
+// for a collector based on the runtime/metrics package.
 type GoMetrics struct {
 	engine    *stats.Engine
 	goVersion string `tag:"go_version"`
@@ -130,7 +135,7 @@ func NewGoMetricsWith(eng *stats.Engine) *GoMetrics {
 
 // Collect satisfies the Collector interface.
 func (g *GoMetrics) Collect() {
-	now := time.Now()
+	now := g.engine.CurrentTime()
 
 	lastTotalAlloc := g.ms.TotalAlloc
 	lastLookups := g.ms.Lookups
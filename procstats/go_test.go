@@ -5,10 +5,27 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	stats "github.com/segmentio/stats/v5"
 	"github.com/segmentio/stats/v5/statstest"
 )
 
+func TestGoMetricsAppendMeasures(t *testing.T) {
+	g := NewGoMetricsWith(stats.NewEngine("", stats.Discard))
+	g.Collect()
+
+	tags := []stats.Tag{stats.T("a", "1"), stats.T("type", "2")}
+
+	// Arrays elements are reported with reflection, which gives the expected
+	// measures of the generated AppendMeasures method.
+	expected := stats.MakeMeasures("prefix", [1]GoMetrics{*g}, tags...)
+	found := g.AppendMeasures(nil, "prefix", tags...)
+
+	assert.NotEmpty(t, found)
+	assert.Equal(t, expected, found)
+}
+
 func TestGoMetrics(t *testing.T) {
 	h := &statstest.Handler{}
 	e := stats.NewEngine("", h)
@@ -36,3 +53,23 @@ func TestGoMetrics(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+func TestGoMetricsNow(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	var times []time.Time
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := stats.NewEngine("", stats.HandlerFunc(func(t time.Time, _ ...stats.Measure) {
+		times = append(times, t)
+	}))
+	e.Now = statstest.NewClock(now).Now
+
+	NewGoMetricsWith(e).Collect()
+
+	assert.NotEmpty(t, times)
+	for _, tm := range times {
+		assert.Equal(t, now, tm)
+	}
+}
@@ -0,0 +1,87 @@
+// Code generated by "statsgen -type=GoMetrics"; DO NOT EDIT.
+
+package procstats
+
+import stats "github.com/segmentio/stats/v5"
+
+// AppendMeasures satisfies the stats.MeasureAppender interface.
+func (g *GoMetrics) AppendMeasures(measures []stats.Measure, prefix string, tags ...stats.Tag) []stats.Measure {
+	measures = stats.AppendMeasure(measures, prefix, "go.runtime", []stats.Field{
+		stats.IntField("cpu.num", int64(g.runtime.numCPU), stats.Gauge),
+		stats.IntField("goroutine.num", int64(g.runtime.numGoroutine), stats.Gauge),
+		stats.IntField("cgo.calls", int64(g.runtime.numCgoCall), stats.Counter),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("alloc.bytes", g.memstats.total.alloc, stats.Gauge),
+		stats.UintField("total_alloc.bytes", g.memstats.total.totalAlloc, stats.Counter),
+		stats.UintField("lookups.count", g.memstats.total.lookups, stats.Counter),
+		stats.UintField("mallocs.count", g.memstats.total.mallocs, stats.Counter),
+		stats.UintField("frees.count", g.memstats.total.frees, stats.Counter),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.total.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("alloc.bytes", g.memstats.heap.alloc, stats.Gauge),
+		stats.UintField("sys.bytes", g.memstats.heap.sys, stats.Gauge),
+		stats.UintField("idle.bytes", g.memstats.heap.idle, stats.Gauge),
+		stats.UintField("inuse.bytes", g.memstats.heap.inuse, stats.Gauge),
+		stats.UintField("released.bytes", g.memstats.heap.released, stats.Counter),
+		stats.UintField("objects.count", g.memstats.heap.objects, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.heap.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("inuse.bytes", g.memstats.stack.inuse, stats.Gauge),
+		stats.UintField("sys.bytes", g.memstats.stack.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.stack.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("inuse.bytes", g.memstats.mspan.inuse, stats.Gauge),
+		stats.UintField("sys.bytes", g.memstats.mspan.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.mspan.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("inuse.bytes", g.memstats.mcache.inuse, stats.Gauge),
+		stats.UintField("sys.bytes", g.memstats.mcache.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.mcache.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("sys.bytes", g.memstats.buckhash.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.buckhash.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("sys.bytes", g.memstats.gc.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.gc.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("sys.bytes", g.memstats.other.sys, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+		{Name: "type", Value: g.memstats.other.memtype},
+	}, tags)
+	measures = stats.AppendMeasure(measures, prefix, "go.memstats", []stats.Field{
+		stats.UintField("gc.count", uint64(g.memstats.numGC), stats.Counter),
+		stats.UintField("gc_next.bytes", g.memstats.nextGC, stats.Gauge),
+		stats.DurationField("gc_pause.seconds.avg", g.memstats.gcPauseAvg, stats.Gauge),
+		stats.DurationField("gc_pause.seconds.min", g.memstats.gcPauseMin, stats.Gauge),
+		stats.DurationField("gc_pause.seconds.max", g.memstats.gcPauseMax, stats.Gauge),
+		stats.FloatField("gc_cpu.fraction", g.memstats.gcCPUFraction, stats.Gauge),
+	}, []stats.Tag{
+		{Name: "go_version", Value: g.goVersion},
+	}, tags)
+	return measures
+}
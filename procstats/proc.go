@@ -131,7 +131,7 @@ func NewProcMetricsWith(eng *stats.Engine, pid int) *ProcMetrics {
 // Collect satisfies the Collector interface.
 func (p *ProcMetrics) Collect() {
 	if m, err := CollectProcInfo(p.pid); err == nil {
-		now := time.Now()
+		now := p.engine.CurrentTime()
 
 		if !p.lastTime.IsZero() {
 			var ratio float64
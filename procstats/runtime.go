@@ -0,0 +1,258 @@
+package procstats
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// RuntimeMetrics is a metric collector that reports all the metrics supported
+// by the runtime/metrics package. Unlike GoMetrics, it does not stop the world
+// to collect the metrics.
+//
+// The runtime metric named "/<group>/<path>:<unit>" is reported on the measure
+// "go.<group>" as the field "<path>.<unit>", where the slashes of the path are
+// replaced with dots and dashes with underscores. For example, the metric
+// "/gc/heap/allocs-by-size:bytes" is reported as the field
+// "heap.allocs_by_size.bytes" of the measure "go.gc".
+//
+// Cumulative metrics are reported as counters incremented by the difference
+// with the previous collection, and the other metrics as gauges, including the
+// GOGC and GOMEMLIMIT settings ("go.gc" fields "gogc.percent" and
+// "gomemlimit.bytes").
+//
+// Histograms, like the scheduling latencies and the GC pauses, are reported
+// like the histograms forwarded by stats.AggregatingHandler: the number of
+// values since the previous collection of a histogram field named "f" is the
+// "f.count" counter, and the number of those values less than or equal to the
+// upper bound of each bucket is the "f.bucket" counter, on a measure carrying
+// an extra "le" tag set to the bound. The bounds go from 1µs to 1s by powers
+// of 10 for seconds, and from 16B to 16KiB by powers of 4 for bytes, followed
+// by "+Inf". The runtime does not track the sums of the values, so there are
+// no sum, min or max fields.
+//
+// The counts are read from the buckets of the runtime histograms, which are
+// finer than the reported ones. Values of a runtime bucket which straddles a
+// reported bound are counted in the next bound.
+type RuntimeMetrics struct {
+	engine    *stats.Engine
+	goVersion string
+	samples   []metrics.Sample
+	series    []runtimeSeries
+	measures  runtimeMeasures
+}
+
+var (
+	secondsBuckets = []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1}
+	bytesBuckets   = []float64{16, 64, 256, 1024, 4096, 16384}
+)
+
+type runtimeSeries struct {
+	measure    string
+	field      string
+	cumulative bool
+	buckets    []float64
+	lastUint   uint64
+	lastFloat  float64
+	lastCounts []uint64
+}
+
+// NewRuntimeMetrics creates a new collector of the runtime metrics that
+// produces metrics on the default stats engine.
+func NewRuntimeMetrics() *RuntimeMetrics {
+	return NewRuntimeMetricsWith(stats.DefaultEngine)
+}
+
+// NewRuntimeMetricsWith creates a new collector of the runtime metrics that
+// produces metrics on eng.
+func NewRuntimeMetricsWith(eng *stats.Engine) *RuntimeMetrics {
+	r := &RuntimeMetrics{
+		engine:    eng,
+		goVersion: runtime.Version(),
+	}
+
+	for _, desc := range metrics.All() {
+		if desc.Kind == metrics.KindBad {
+			continue
+		}
+		measure, field := runtimeMetricName(desc.Name)
+		r.samples = append(r.samples, metrics.Sample{Name: desc.Name})
+		r.series = append(r.series, runtimeSeries{
+			measure:    measure,
+			field:      field,
+			cumulative: desc.Cumulative,
+			buckets:    runtimeBuckets(field),
+		})
+	}
+
+	return r
+}
+
+// Collect satisfies the Collector interface.
+func (r *RuntimeMetrics) Collect() {
+	now := r.engine.CurrentTime()
+	metrics.Read(r.samples)
+
+	r.measures = r.measures[:0]
+
+	for i := range r.samples {
+		s := &r.series[i]
+
+		switch v := r.samples[i].Value; v.Kind() {
+		case metrics.KindUint64:
+			r.measures = r.measures.appendField(s.measure, s.uint64Field(v.Uint64()))
+		case metrics.KindFloat64:
+			r.measures = r.measures.appendField(s.measure, s.float64Field(v.Float64()))
+		case metrics.KindFloat64Histogram:
+			r.measures = s.appendHistogram(r.measures, v.Float64Histogram())
+		}
+	}
+
+	r.engine.ReportAt(now, r)
+}
+
+// AppendMeasures satisfies the stats.MeasureAppender interface.
+func (r *RuntimeMetrics) AppendMeasures(measures []stats.Measure, prefix string, tags ...stats.Tag) []stats.Measure {
+	structTags := []stats.Tag{{Name: "go_version", Value: r.goVersion}, {Name: "le"}}
+
+	for _, m := range r.measures {
+		if m.le == "" {
+			measures = stats.AppendMeasure(measures, prefix, m.name, m.fields, structTags[:1], tags)
+		} else {
+			structTags[1].Value = m.le
+			measures = stats.AppendMeasure(measures, prefix, m.name, m.fields, structTags, tags)
+		}
+	}
+
+	return measures
+}
+
+func (s *runtimeSeries) uint64Field(value uint64) stats.Field {
+	if !s.cumulative {
+		return stats.UintField(s.field, value, stats.Gauge)
+	}
+	delta := value - s.lastUint
+	if value < s.lastUint {
+		delta = value
+	}
+	s.lastUint = value
+	return stats.UintField(s.field, delta, stats.Counter)
+}
+
+func (s *runtimeSeries) float64Field(value float64) stats.Field {
+	if !s.cumulative {
+		return stats.FloatField(s.field, value, stats.Gauge)
+	}
+	delta := value - s.lastFloat
+	if value < s.lastFloat {
+		delta = value
+	}
+	s.lastFloat = value
+	return stats.FloatField(s.field, delta, stats.Counter)
+}
+
+// runtimeBuckets returns the bounds of the buckets reported for the runtime
+// histogram field named field.
+func runtimeBuckets(field string) []float64 {
+	switch {
+	case strings.HasSuffix(field, ".seconds"):
+		return secondsBuckets
+	case strings.HasSuffix(field, ".bytes"):
+		return bytesBuckets
+	default:
+		return nil
+	}
+}
+
+// appendHistogram appends to measures the count of the values of h since the
+// previous collection, and the cumulative counts of the buckets of the series.
+func (s *runtimeSeries) appendHistogram(measures runtimeMeasures, h *metrics.Float64Histogram) runtimeMeasures {
+	if len(s.lastCounts) != len(h.Counts) {
+		s.lastCounts = make([]uint64, len(h.Counts))
+	}
+
+	deltas := make([]uint64, len(h.Counts))
+	total := uint64(0)
+
+	for i, count := range h.Counts {
+		n := count - s.lastCounts[i]
+		if count < s.lastCounts[i] {
+			n = count
+		}
+		s.lastCounts[i] = count
+		deltas[i] = n
+		total += n
+	}
+
+	if total == 0 {
+		return measures
+	}
+
+	measures = measures.appendField(s.measure, stats.UintField(s.field+".count", total, stats.Counter))
+
+	// Like prometheus buckets, the counts are cumulative. The upper bound of
+	// runtime bucket i is h.Buckets[i+1].
+	count, i := uint64(0), 0
+
+	for _, limit := range s.buckets {
+		for ; i < len(deltas) && h.Buckets[i+1] <= limit; i++ {
+			count += deltas[i]
+		}
+		if count != 0 {
+			measures = measures.appendBucket(s.measure, s.field, formatBucket(limit), count)
+		}
+	}
+
+	return measures.appendBucket(s.measure, s.field, "+Inf", total)
+}
+
+func formatBucket(limit float64) string {
+	return strconv.FormatFloat(limit, 'g', -1, 64)
+}
+
+type runtimeMeasure struct {
+	name   string
+	fields []stats.Field
+	le     string
+}
+
+type runtimeMeasures []runtimeMeasure
+
+// appendField appends field to the last measure if it has the same name and is
+// not a histogram bucket, or to a new measure otherwise. Since the runtime
+// metrics are sorted by name, fields of the same group end up in the same
+// measure.
+func (measures runtimeMeasures) appendField(name string, field stats.Field) runtimeMeasures {
+	if n := len(measures); n != 0 {
+		if last := &measures[n-1]; last.name == name && last.le == "" {
+			last.fields = append(last.fields, field)
+			return measures
+		}
+	}
+	return append(measures, runtimeMeasure{name: name, fields: []stats.Field{field}})
+}
+
+// appendBucket appends the count of the bucket le of the histogram field named
+// field.
+func (measures runtimeMeasures) appendBucket(name, field, le string, count uint64) runtimeMeasures {
+	return append(measures, runtimeMeasure{
+		name:   name,
+		fields: []stats.Field{stats.UintField(field+".bucket", count, stats.Counter)},
+		le:     le,
+	})
+}
+
+// runtimeMetricName returns the measure and field names of the runtime metric
+// named name.
+func runtimeMetricName(name string) (measure, field string) {
+	path, unit, _ := strings.Cut(strings.TrimPrefix(name, "/"), ":")
+	group, path, _ := strings.Cut(path, "/")
+
+	r := strings.NewReplacer("/", ".", "-", "_")
+	measure = "go." + r.Replace(group)
+	field = r.Replace(path) + "." + r.Replace(unit)
+	return measure, field
+}
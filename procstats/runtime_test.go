@@ -0,0 +1,134 @@
+package procstats
+
+import (
+	"math"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/prometheus"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	tests := []struct {
+		name    string
+		measure string
+		field   string
+	}{
+		{"/gc/heap/allocs:bytes", "go.gc", "heap.allocs.bytes"},
+		{"/gc/heap/allocs-by-size:bytes", "go.gc", "heap.allocs_by_size.bytes"},
+		{"/sched/latencies:seconds", "go.sched", "latencies.seconds"},
+		{"/cpu/classes/gc/total:cpu-seconds", "go.cpu", "classes.gc.total.cpu_seconds"},
+	}
+
+	for _, test := range tests {
+		measure, field := runtimeMetricName(test.name)
+		assert.Equal(t, test.measure, measure, test.name)
+		assert.Equal(t, test.field, field, test.name)
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	defer debug.SetGCPercent(debug.SetGCPercent(150))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(1 << 30))
+
+	h := &statstest.Handler{}
+	r := NewRuntimeMetricsWith(stats.NewEngine("", h))
+	r.Collect()
+
+	statstest.AssertGauge(t, h, "go.gc.gogc.percent", 150)
+	statstest.AssertGauge(t, h, "go.gc.gomemlimit.bytes", 1<<30)
+	assert.Equal(t, []stats.Tag{stats.T("go_version", runtime.Version())}, h.Select("go.gc.gogc.percent")[0].Tags)
+
+	h.Clear()
+	samples := []metrics.Sample{{Name: "/gc/cycles/total:gc-cycles"}}
+	metrics.Read(samples)
+	before := samples[0].Value.Uint64()
+
+	for range 3 {
+		runtime.GC()
+	}
+
+	r.Collect()
+	metrics.Read(samples)
+	after := samples[0].Value.Uint64()
+
+	statstest.AssertCounter(t, h, "go.gc.cycles.total.gc_cycles", float64(after-before))
+
+	// Each GC cycle stops the world twice.
+	assert.GreaterOrEqual(t, h.Select("go.sched.pauses.total.gc.seconds.count").Sum(), float64(2*(after-before)))
+	assert.NotEmpty(t, h.Select("go.sched.pauses.total.gc.seconds.bucket", stats.T("le", "+Inf")))
+}
+
+func TestRuntimeSeriesHistogram(t *testing.T) {
+	s := &runtimeSeries{measure: "go.sched", field: "latencies.seconds", cumulative: true, buckets: []float64{0.001, 0.01}}
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 1, 4, 0},
+		Buckets: []float64{math.Inf(-1), 0, 0.001, 0.004, math.Inf(+1)},
+	}
+
+	bucket := func(le string, count uint64) runtimeMeasure {
+		return runtimeMeasure{name: "go.sched", fields: []stats.Field{stats.UintField("latencies.seconds.bucket", count, stats.Counter)}, le: le}
+	}
+
+	measures := s.appendHistogram(nil, h)
+	assert.Equal(t, runtimeMeasures{
+		{name: "go.sched", fields: []stats.Field{stats.UintField("latencies.seconds.count", 5, stats.Counter)}},
+		bucket("0.001", 1),
+		bucket("0.01", 5),
+		bucket("+Inf", 5),
+	}, measures)
+
+	h.Counts = []uint64{0, 1, 6, 2}
+	measures = s.appendHistogram(nil, h)
+	assert.Equal(t, runtimeMeasures{
+		{name: "go.sched", fields: []stats.Field{stats.UintField("latencies.seconds.count", 4, stats.Counter)}},
+		bucket("0.01", 2),
+		bucket("+Inf", 4),
+	}, measures)
+
+	assert.Empty(t, s.appendHistogram(nil, h), "histograms without new values must not produce measures")
+}
+
+func TestRuntimeHistogramsPrometheus(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &prometheus.Handler{}
+	r := NewRuntimeMetricsWith(stats.NewEngine("runtime_test", h))
+
+	s := &runtimeSeries{measure: "go.sched", field: "latencies.seconds", cumulative: true, buckets: secondsBuckets}
+	r.measures = s.appendHistogram(nil, &metrics.Float64Histogram{
+		Counts:  []uint64{3, 0, 5, 0, 2},
+		Buckets: []float64{2e-6, 4e-6, 20e-6, 40e-6, 200e-6, 400e-6},
+	})
+	r.engine.Report(r)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	// The runtime buckets don't straddle the reported bounds, so the counts
+	// are exact.
+	for le, count := range map[string]string{
+		"1e-05":  "3",
+		"0.0001": "8",
+		"0.001":  "10",
+		"+Inf":   "10",
+	} {
+		line := `runtime_test_go_sched_latencies_seconds_bucket{go_version="` + runtime.Version() + `",le="` + le + `"} ` + count + " "
+		assert.Contains(t, w.Body.String(), line)
+	}
+	assert.NotContains(t, w.Body.String(), `le="1e-06"`, "empty buckets must not be reported")
+	assert.Contains(t, w.Body.String(), `runtime_test_go_sched_latencies_seconds_count{go_version="`+runtime.Version()+`"} 10 `)
+}
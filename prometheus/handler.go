@@ -19,7 +19,8 @@ import (
 // Typically, a program creates one Handler, registers it to the stats package,
 // and adds it to the muxer used by the application under the /metrics path.
 //
-// The handle ignores histograms that have no buckets set.
+// Histograms that have no buckets set are exposed as summaries, with the
+// quantiles set in Quantiles.
 type Handler struct {
 	// Setting this field will trim this prefix from metric namespaces of the
 	// metrics received by this handler.
@@ -45,6 +46,41 @@ type Handler struct {
 	// If nil, stats.Buckets is used instead.
 	Buckets stats.HistogramBuckets
 
+	// Descriptions is the registry of metric descriptions used by the handler
+	// to expose the help of metrics. If nil, stats.Descriptions is used
+	// instead.
+	Descriptions *stats.MetricDescriptions
+
+	// Quantiles exposed for histograms that have no buckets set, which are
+	// then exposed as summaries. The quantiles are estimated with sketches
+	// (see the sketch package), the values must be in the (0, 1) range.
+	//
+	// If nil, the 0.5, 0.9 and 0.99 quantiles are exposed. Set to an empty
+	// slice to expose histograms with no buckets as summaries with only a sum
+	// and a count.
+	Quantiles []float64
+
+	// Length of the sliding window over which the quantiles of summaries are
+	// computed. The default is to use a 1 minute window.
+	SummaryWindow time.Duration
+
+	// Length of the sliding window over which the number of distinct values of
+	// sets (stats.Distinct fields) is estimated, sets are exposed as gauges.
+	// The default is to use a 1 minute window.
+	SetWindow time.Duration
+
+	// Observers is the registry of callbacks that the handler runs before
+	// exposing the metrics, so the values observed by the callbacks are up to
+	// date when scraped (see stats.MetricObservers). If nil, no callbacks are
+	// run.
+	//
+	// The registry must be the one of an engine which forwards measures to
+	// the handler directly (see stats.Engine.Observers): the measures produced
+	// by the callbacks must reach the handler synchronously to be exposed by
+	// the scrape that ran them, which is not the case if the engine dispatches
+	// them through a stats.AsyncHandler for example.
+	Observers *stats.MetricObservers
+
 	opcount uint64
 	metrics metricStore
 }
@@ -56,12 +92,22 @@ func (h *Handler) HandleMeasures(mtime time.Time, measures ...stats.Measure) {
 	for _, m := range measures {
 		scope := h.trimPrefix(m.Name)
 
+		// Sampled counters and histograms are scaled back up by the inverse
+		// of their sample rate.
+		weight := 1.0
+		if m.Sampled() {
+			weight = 1 / m.SampleRate
+		}
+
 		cache.labels = cache.labels[:0]
 		cache.labels = cache.labels.appendTags(m.Tags...)
+		tagSet, _ := m.ValidTagSet()
+		hash := m.TagsHash()
 
 		for _, f := range m.Fields {
 			var buckets []stats.Value
 			mtype := typeOf(f.Type())
+			desc, _ := h.descriptions().Lookup(stats.Key{Measure: m.Name, Field: f.Name})
 
 			if mtype == histogram {
 				k := stats.Key{Measure: m.Name, Field: f.Name}
@@ -73,14 +119,26 @@ func (h *Handler) HandleMeasures(mtime time.Time, measures ...stats.Measure) {
 				}
 			}
 
-			h.metrics.update(metric{
+			metric := metric{
 				mtype:  mtype,
 				scope:  scope,
 				name:   f.Name,
+				help:   desc.Help,
 				value:  valueOf(f.Value),
 				time:   mtime,
 				labels: cache.labels,
-			}, buckets)
+				hash:   hash,
+				tagSet: tagSet,
+			}
+
+			switch {
+			case mtype == set:
+				h.metrics.updateSet(metric, f.Value.Uint(), h.setWindow())
+			case mtype == histogram && len(buckets) == 0:
+				h.metrics.updateSummary(metric, h.quantiles(), h.summaryWindow(), weight)
+			default:
+				h.metrics.update(metric, buckets, weight)
+			}
 		}
 
 		for i := range cache.labels {
@@ -106,6 +164,13 @@ func (h *Handler) trimPrefix(s string) string {
 	return s
 }
 
+func (h *Handler) descriptions() *stats.MetricDescriptions {
+	if d := h.Descriptions; d != nil {
+		return d
+	}
+	return stats.Descriptions
+}
+
 func (h *Handler) timeout() time.Duration {
 	if timeout := h.MetricTimeout; timeout != 0 {
 		return timeout
@@ -113,6 +178,27 @@ func (h *Handler) timeout() time.Duration {
 	return 2 * time.Minute
 }
 
+func (h *Handler) quantiles() []float64 {
+	if h.Quantiles != nil {
+		return h.Quantiles
+	}
+	return defaultQuantiles
+}
+
+func (h *Handler) summaryWindow() time.Duration {
+	if window := h.SummaryWindow; window != 0 {
+		return window
+	}
+	return time.Minute
+}
+
+func (h *Handler) setWindow() time.Duration {
+	if window := h.SetWindow; window != 0 {
+		return window
+	}
+	return time.Minute
+}
+
 // ServeHTTP satisfies the http.Handler interface.
 func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	switch req.Method {
@@ -132,6 +218,9 @@ func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		w = zw
 	}
 
+	if h.Observers != nil {
+		h.Observers.Collect()
+	}
 	h.WriteStats(w)
 }
 
@@ -195,6 +284,10 @@ func (cache *handleMetricCache) Less(i, j int) bool {
 	return cache.labels[i].less(cache.labels[j])
 }
 
+// defaultQuantiles are the quantiles of summaries when Handler.Quantiles is
+// nil.
+var defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
 // DefaultHandler is a prometheus handler configured to trim the default metric
 // namespace off of metrics that it handles.
 var DefaultHandler = &Handler{
@@ -209,6 +302,8 @@ func typeOf(t stats.FieldType) metricType {
 		return gauge
 	case stats.Histogram:
 		return histogram
+	case stats.Distinct:
+		return set
 	default:
 		return untyped
 	}
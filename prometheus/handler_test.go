@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -118,6 +119,47 @@ C_sum 10.7 1496614320000
 	}
 }
 
+func TestHandlerSampledMeasures(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Field: "C"}: {
+				stats.ValueOf(0.5),
+				stats.ValueOf(1.0),
+			},
+		},
+	}
+
+	handler.HandleMeasures(now,
+		stats.Measure{Fields: []stats.Field{stats.MakeField("A", 2, stats.Counter)}, SampleRate: 0.5},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 3, stats.Gauge)}, SampleRate: 0.5},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("C", 0.1, stats.Histogram)}, SampleRate: 0.25},
+	)
+
+	b := &strings.Builder{}
+	handler.WriteStats(b)
+
+	const expects = `# TYPE A counter
+A 4 1496614320000
+
+# TYPE B gauge
+B 3 1496614320000
+
+# TYPE C histogram
+C_bucket{le="0.5"} 4 1496614320000
+C_bucket{le="1"} 4 1496614320000
+C_count 4 1496614320000
+C_sum 0.4 1496614320000
+`
+
+	if s := b.String(); s != expects {
+		t.Error("bad output:")
+		t.Log("expected:", expects)
+		t.Log("found:", s)
+	}
+}
+
 func BenchmarkHandleMetric(b *testing.B) {
 	now := time.Now()
 
@@ -157,3 +199,243 @@ func BenchmarkHandleMetric(b *testing.B) {
 		})
 	}
 }
+
+func TestHandlerSummaries(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Field: "B"}: {stats.ValueOf(1.0)},
+		},
+		Quantiles: []float64{0.5, 0.9},
+	}
+
+	for i := 1; i <= 10; i++ {
+		handler.HandleMeasures(now,
+			stats.Measure{Fields: []stats.Field{stats.MakeField("A", i, stats.Histogram)}, Tags: []stats.Tag{stats.T("id", "1")}},
+			stats.Measure{Fields: []stats.Field{stats.MakeField("B", 0.5, stats.Histogram)}},
+		)
+	}
+
+	b := &strings.Builder{}
+	handler.WriteStats(b)
+
+	const expects = `# TYPE A summary
+A{id="1",quantile="0.5"} 5.002829575110683 1496614320000
+A{id="1",quantile="0.9"} 8.93541864376352 1496614320000
+A_count{id="1"} 10 1496614320000
+A_sum{id="1"} 55 1496614320000
+
+# TYPE B histogram
+B_bucket{le="1"} 10 1496614320000
+B_count 10 1496614320000
+B_sum 5 1496614320000
+`
+
+	if s := b.String(); s != expects {
+		t.Error("bad output:")
+		t.Log("expected:", expects)
+		t.Log("found:", s)
+	}
+}
+
+func TestHandlerDefaultQuantiles(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		scenario  string
+		quantiles []float64
+		expects   []string
+	}{
+		{
+			scenario: "histograms with no buckets are summaries by default",
+			expects:  []string{"# TYPE A summary\n", `A{quantile="0.5"} `, `A{quantile="0.9"} `, `A{quantile="0.99"} `, "A_count 10 "},
+		},
+		{
+			scenario:  "summaries have only a sum and a count with an empty list of quantiles",
+			quantiles: []float64{},
+			expects:   []string{"# TYPE A summary\nA_count 10 1496614320000\nA_sum 55 1496614320000\n"},
+		},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			handler := &Handler{Quantiles: test.quantiles}
+
+			for i := 1; i <= 10; i++ {
+				handler.HandleMeasures(now, stats.Measure{Fields: []stats.Field{stats.MakeField("A", i, stats.Histogram)}})
+			}
+
+			b := &strings.Builder{}
+			handler.WriteStats(b)
+
+			for _, expect := range test.expects {
+				if s := b.String(); !strings.Contains(s, expect) {
+					t.Errorf("bad output, expected %q:", expect)
+					t.Log("found:", s)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerSets(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+	clock := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	handler := &Handler{SetWindow: time.Minute}
+
+	report := func(users ...string) {
+		for _, user := range users {
+			handler.HandleMeasures(now, stats.Measure{
+				Fields: []stats.Field{stats.MakeField("users", stats.HashValue(user), stats.Distinct)},
+			})
+		}
+	}
+
+	expect := func(s string) {
+		t.Helper()
+		b := &strings.Builder{}
+		handler.WriteStats(b)
+		if b.String() != s {
+			t.Error("bad output:")
+			t.Log("expected:", s)
+			t.Log("found:", b.String())
+		}
+	}
+
+	report("alice", "bob", "alice", "carol")
+	expect("# TYPE users gauge\nusers 3 1496614320000\n")
+
+	// The estimate covers the previous window, and the current one.
+	clock = clock.Add(time.Minute)
+	report("dave")
+	expect("# TYPE users gauge\nusers 4 1496614320000\n")
+
+	clock = clock.Add(time.Minute)
+	report("alice")
+	expect("# TYPE users gauge\nusers 2 1496614320000\n")
+
+	clock = clock.Add(2 * time.Minute)
+	expect("# TYPE users gauge\nusers 0 1496614320000\n")
+}
+
+func TestHandlerDescriptions(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	descs := &stats.MetricDescriptions{}
+	descs.Set("requests.count", stats.Description{Help: "Number of requests.", Type: stats.Counter, HasType: true})
+	descs.Set("requests.rtt", stats.Description{Help: "Time to serve requests.", Unit: "seconds", Type: stats.Histogram, HasType: true})
+
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Measure: "requests", Field: "rtt"}: {stats.ValueOf(1.0)},
+		},
+		Descriptions: descs,
+	}
+
+	handler.HandleMeasures(now, stats.Measure{
+		Name: "requests",
+		Fields: []stats.Field{
+			stats.MakeField("count", 1, stats.Counter),
+			stats.MakeField("rtt", 0.5, stats.Histogram),
+			stats.MakeField("size", 10, stats.Gauge),
+		},
+	})
+
+	b := &strings.Builder{}
+	handler.WriteStats(b)
+
+	const expects = `# HELP requests_count Number of requests.
+# TYPE requests_count counter
+requests_count 1 1496614320000
+
+# HELP requests_rtt Time to serve requests.
+# TYPE requests_rtt histogram
+requests_rtt_bucket{le="1"} 1 1496614320000
+requests_rtt_count 1 1496614320000
+requests_rtt_sum 0.5 1496614320000
+
+# TYPE requests_size gauge
+requests_size 10 1496614320000
+`
+
+	if s := b.String(); s != expects {
+		t.Error("bad output:")
+		t.Log("expected:", expects)
+		t.Log("found:", s)
+	}
+}
+
+func BenchmarkHandleMeasuresTagSet(b *testing.B) {
+	now := time.Now()
+	tags := stats.NewTagSet(
+		stats.T("cluster", "production"),
+		stats.T("host", "web-1234"),
+		stats.T("method", "GET"),
+		stats.T("path", "/api/v1/users"),
+		stats.T("service", "api"),
+		stats.T("status", "200"),
+	)
+	fields := []stats.Field{
+		stats.MakeField("count", 1, stats.Counter),
+		stats.MakeField("bytes", 512, stats.Counter),
+		stats.MakeField("inflight", 10, stats.Gauge),
+	}
+
+	b.Run("tags", func(b *testing.B) {
+		handler := &Handler{}
+		m := stats.Measure{Name: "http", Fields: fields, Tags: copyTags(tags.Tags())}
+
+		for b.Loop() {
+			handler.HandleMeasures(now, m)
+		}
+	})
+
+	b.Run("tagset", func(b *testing.B) {
+		handler := &Handler{}
+		m := stats.Measure{Name: "http", Fields: fields, Tags: tags.Tags(), TagSet: tags}
+
+		for b.Loop() {
+			handler.HandleMeasures(now, m)
+		}
+	})
+}
+
+func copyTags(tags []stats.Tag) []stats.Tag {
+	return append([]stats.Tag(nil), tags...)
+}
+
+func TestHandlerObservers(t *testing.T) {
+	observers := &stats.MetricObservers{}
+	handler := &Handler{Observers: observers}
+
+	eng := stats.NewEngine("", handler)
+	eng.Now = func() time.Time { return time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC) }
+	eng.Observers = observers
+
+	size := 0.0
+	defer eng.ObserveFunc("queue.size", func() float64 { size++; return size }).Close()
+
+	for _, expects := range []string{"1", "2"} {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+
+		if s := res.Body.String(); !strings.Contains(s, "\nqueue_size "+expects+" 1496614320000\n") {
+			t.Errorf("bad output, expected queue_size to be %s:", expects)
+			t.Log("found:", s)
+		}
+	}
+
+	// Handlers without observers don't run the callbacks of the global
+	// registry, which may produce measures on other engines.
+	calls := 0
+	defer stats.NewEngine("", stats.Discard).ObserveBatch(func(*stats.Engine) { calls++ }).Close()
+
+	(&Handler{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+	if calls != 0 {
+		t.Errorf("the callbacks of stats.Observers were run %d times", calls)
+	}
+}
@@ -1,8 +1,6 @@
 package prometheus
 
 import (
-	"github.com/segmentio/fasthash/jody"
-
 	"github.com/segmentio/stats/v5"
 )
 
@@ -38,17 +36,6 @@ func (l labels) copy() labels {
 	return makeLabels(l...)
 }
 
-func (l labels) hash() uint64 {
-	h := jody.Init64
-
-	for i := range l {
-		h = jody.AddString64(h, l[i].name)
-		h = jody.AddString64(h, l[i].value)
-	}
-
-	return h
-}
-
 func (l labels) equal(other labels) bool {
 	if len(l) != len(other) {
 		return false
@@ -1,6 +1,7 @@
 package prometheus
 
 import (
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -8,6 +9,7 @@ import (
 	"unsafe"
 
 	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/sketch"
 )
 
 type metricType int
@@ -18,6 +20,9 @@ const (
 	gauge
 	histogram
 	summary
+	// Sets are exposed as gauges estimating the number of distinct values they
+	// received over a sliding window.
+	set
 )
 
 func (t metricType) String() string {
@@ -32,6 +37,8 @@ func (t metricType) String() string {
 		return "histogram"
 	case summary:
 		return "summary"
+	case set:
+		return "gauge"
 	default:
 		return "unknown"
 	}
@@ -46,10 +53,15 @@ type metric struct {
 	mtype  metricType
 	scope  string
 	name   string
+	root   string
 	help   string
 	value  float64
 	time   time.Time
 	labels labels
+	// Identify the series of the metric when it is updated, hash is the key of
+	// the labels and tagSet the set they were made from, if any.
+	hash   uint64
+	tagSet stats.TagSet
 }
 
 func (m metric) key() metricKey {
@@ -57,6 +69,9 @@ func (m metric) key() metricKey {
 }
 
 func (m metric) rootName() string {
+	if m.root != "" {
+		return m.root
+	}
 	if m.mtype == histogram {
 		return m.name[:strings.LastIndexByte(m.name, '_')]
 	}
@@ -94,10 +109,22 @@ func (store *metricStore) lookup(mtype metricType, key metricKey, help string) *
 	return entry
 }
 
-func (store *metricStore) update(metric metric, buckets []stats.Value) {
+func (store *metricStore) update(metric metric, buckets []stats.Value, weight float64) {
 	entry := store.lookup(metric.mtype, metric.key(), metric.help)
-	state := entry.lookup(metric.labels)
-	state.update(metric.mtype, metric.value, metric.time, buckets)
+	state := entry.lookup(metric)
+	state.update(metric.mtype, metric.value, metric.time, buckets, weight)
+}
+
+func (store *metricStore) updateSummary(metric metric, quantiles []float64, window time.Duration, weight float64) {
+	entry := store.lookup(summary, metric.key(), metric.help)
+	state := entry.lookup(metric)
+	state.updateSummary(metric.value, metric.time, quantiles, window, weight)
+}
+
+func (store *metricStore) updateSet(metric metric, member uint64, window time.Duration) {
+	entry := store.lookup(set, metric.key(), metric.help)
+	state := entry.lookup(metric)
+	state.updateSet(member, metric.time, window)
 }
 
 func (store *metricStore) collect(metrics []metric) []metric {
@@ -150,7 +177,7 @@ func newMetricEntry(mtype metricType, scope, name, help string) *metricEntry {
 		states: make(metricStateMap),
 	}
 
-	if mtype == histogram {
+	if mtype == histogram || mtype == summary {
 		// Here we cache those metric names to avoid having to recompute them
 		// every time we collect the state of the metrics.
 		entry.bucket = name + "_bucket"
@@ -161,19 +188,17 @@ func newMetricEntry(mtype metricType, scope, name, help string) *metricEntry {
 	return entry
 }
 
-func (entry *metricEntry) lookup(labels labels) *metricState {
-	key := labels.hash()
-
+func (entry *metricEntry) lookup(metric metric) *metricState {
 	entry.mutex.RLock()
-	state := entry.states.find(key, labels)
+	state := entry.states.find(metric)
 	entry.mutex.RUnlock()
 
 	if state == nil {
 		entry.mutex.Lock()
 
-		if state = entry.states.find(key, labels); state == nil {
-			state = newMetricState(labels)
-			entry.states.put(key, state)
+		if state = entry.states.find(metric); state == nil {
+			state = newMetricState(metric.labels, metric.tagSet)
+			entry.states.put(metric.hash, state)
 		}
 
 		entry.mutex.Unlock()
@@ -239,27 +264,31 @@ func (entry *metricEntry) cleanup(exp time.Time, empty func()) {
 type metricState struct {
 	// immutable
 	labels labels
+	tagSet stats.TagSet
 	// mutable
 	mutex   sync.Mutex
 	buckets metricBuckets
 	value   float64
 	sum     float64
-	count   uint64
+	count   float64
 	time    time.Time
+	summary *metricSummary
+	set     *metricSet
 }
 
-func newMetricState(labels labels) *metricState {
+func newMetricState(labels labels, tagSet stats.TagSet) *metricState {
 	return &metricState{
 		labels: labels.copy(),
+		tagSet: tagSet,
 	}
 }
 
-func (state *metricState) update(mtype metricType, value float64, time time.Time, buckets []stats.Value) {
+func (state *metricState) update(mtype metricType, value float64, time time.Time, buckets []stats.Value, weight float64) {
 	state.mutex.Lock()
 
 	switch mtype {
 	case counter:
-		state.value += value
+		state.value += value * weight
 
 	case gauge:
 		state.value = value
@@ -268,10 +297,40 @@ func (state *metricState) update(mtype metricType, value float64, time time.Time
 		if len(state.buckets) != len(buckets) {
 			state.buckets = makeMetricBuckets(buckets, state.labels)
 		}
-		state.buckets.update(value)
-		state.sum += value
-		state.count++
+		state.buckets.update(value, weight)
+		state.sum += value * weight
+		state.count += weight
+	}
+
+	state.time = time
+	state.mutex.Unlock()
+}
+
+func (state *metricState) updateSummary(value float64, time time.Time, quantiles []float64, window time.Duration, weight float64) {
+	// The windows of summaries are based on the wall clock rather than the
+	// time of measures, which may be zero or out of order.
+	now := timeNow()
+	state.mutex.Lock()
+
+	if state.summary == nil || len(state.summary.quantiles) != len(quantiles) {
+		state.summary = newMetricSummary(quantiles, state.labels, now)
 	}
+	state.summary.update(value, now, window, weight)
+	state.sum += value * weight
+	state.count += weight
+
+	state.time = time
+	state.mutex.Unlock()
+}
+
+func (state *metricState) updateSet(member uint64, time time.Time, window time.Duration) {
+	now := timeNow()
+	state.mutex.Lock()
+
+	if state.set == nil {
+		state.set = &metricSet{start: now}
+	}
+	state.set.update(member, now, window)
 
 	state.time = time
 	state.mutex.Unlock()
@@ -296,7 +355,7 @@ func (state *metricState) collect(metrics []metric, entry *metricEntry) []metric
 		// Prometheus' scraper expects for histogram buckets to be cumulative.
 		// [1] https://prometheus.io/docs/practices/histograms/#apdex-score
 		// [2] https://en.wikipedia.org/wiki/Histogram#Cumulative_histogram
-		var cumulativeCount uint64
+		var cumulativeCount float64
 		for _, bucket := range state.buckets {
 			cumulativeCount += bucket.count
 			metrics = append(metrics, metric{
@@ -304,7 +363,7 @@ func (state *metricState) collect(metrics []metric, entry *metricEntry) []metric
 				scope:  entry.scope,
 				name:   entry.bucket,
 				help:   entry.help,
-				value:  float64(cumulativeCount),
+				value:  cumulativeCount,
 				time:   state.time,
 				labels: bucket.labels,
 			})
@@ -324,7 +383,61 @@ func (state *metricState) collect(metrics []metric, entry *metricEntry) []metric
 				scope:  entry.scope,
 				name:   entry.count,
 				help:   entry.help,
-				value:  float64(state.count),
+				value:  state.count,
+				time:   state.time,
+				labels: state.labels,
+			},
+		)
+
+	case set:
+		if state.set == nil {
+			break
+		}
+		metrics = append(metrics, metric{
+			mtype:  entry.mtype,
+			scope:  entry.scope,
+			name:   entry.name,
+			help:   entry.help,
+			value:  state.set.estimate(timeNow()),
+			time:   state.time,
+			labels: state.labels,
+		})
+
+	case summary:
+		if state.summary == nil {
+			break
+		}
+		values := state.summary.values(timeNow())
+		for i, q := range state.summary.quantiles {
+			metrics = append(metrics, metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.name,
+				root:   entry.name,
+				help:   entry.help,
+				value:  values[i],
+				time:   state.time,
+				labels: q.labels,
+			})
+		}
+		metrics = append(metrics,
+			metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.sum,
+				root:   entry.name,
+				help:   entry.help,
+				value:  state.sum,
+				time:   state.time,
+				labels: state.labels,
+			},
+			metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.count,
+				root:   entry.name,
+				help:   entry.help,
+				value:  state.count,
 				time:   state.time,
 				labels: state.labels,
 			},
@@ -341,11 +454,16 @@ func (m metricStateMap) put(key uint64, state *metricState) {
 	m[key] = append(m[key], state)
 }
 
-func (m metricStateMap) find(key uint64, labels labels) *metricState {
-	states := m[key]
+func (m metricStateMap) find(metric metric) *metricState {
+	states := m[metric.hash]
 
 	for _, state := range states {
-		if state.labels.equal(labels) {
+		// Metrics made from the same tag set have the same labels, which saves
+		// comparing them.
+		if metric.tagSet.Len() != 0 && state.tagSet.Equal(metric.tagSet) {
+			return state
+		}
+		if state.labels.equal(metric.labels) {
 			return state
 		}
 	}
@@ -355,7 +473,7 @@ func (m metricStateMap) find(key uint64, labels labels) *metricState {
 
 type metricBucket struct {
 	limit  float64
-	count  uint64
+	count  float64
 	labels labels
 }
 
@@ -375,15 +493,121 @@ func makeMetricBuckets(buckets []stats.Value, labels labels) metricBuckets {
 	return b
 }
 
-func (m metricBuckets) update(value float64) {
+func (m metricBuckets) update(value, weight float64) {
 	for i := range m {
 		if value <= m[i].limit {
-			m[i].count++
+			m[i].count += weight
 			break
 		}
 	}
 }
 
+var timeNow = time.Now
+
+// metricSummary tracks the quantiles of a summary over a sliding window. Two
+// sketches are rotated at every window, the quantiles are computed over the
+// values of the current and previous windows.
+type metricSummary struct {
+	current   sketch.Sketch
+	previous  sketch.Sketch
+	start     time.Time
+	window    time.Duration
+	quantiles []metricQuantile
+}
+
+type metricQuantile struct {
+	quantile float64
+	labels   labels
+}
+
+func newMetricSummary(quantiles []float64, labels labels, start time.Time) *metricSummary {
+	s := &metricSummary{
+		start:     start,
+		quantiles: make([]metricQuantile, len(quantiles)),
+	}
+
+	for i, q := range quantiles {
+		s.quantiles[i] = metricQuantile{
+			quantile: q,
+			labels:   labels.copyAppend(label{"quantile", string(appendFloat(nil, q))}),
+		}
+	}
+
+	return s
+}
+
+func (s *metricSummary) update(value float64, now time.Time, window time.Duration, weight float64) {
+	s.window = window
+	s.rotate(now)
+	s.current.AddWithCount(value, weight)
+}
+
+func (s *metricSummary) rotate(now time.Time) {
+	if elapsed := now.Sub(s.start); elapsed >= s.window {
+		s.previous, s.current = s.current, s.previous
+		s.current.Reset()
+
+		if elapsed >= 2*s.window {
+			s.previous.Reset()
+		}
+
+		s.start = now
+	}
+}
+
+// values returns the values of the quantiles at time now.
+func (s *metricSummary) values(now time.Time) []float64 {
+	s.rotate(now)
+
+	var merged sketch.Sketch
+	merged.Merge(&s.previous)
+	merged.Merge(&s.current)
+
+	values := make([]float64, len(s.quantiles))
+	for i := range s.quantiles {
+		values[i] = merged.Quantile(s.quantiles[i].quantile)
+	}
+	return values
+}
+
+// metricSet estimates the number of distinct values of a set over a sliding
+// window, with the same rotation of sketches as metricSummary.
+type metricSet struct {
+	current  sketch.HyperLogLog
+	previous sketch.HyperLogLog
+	start    time.Time
+	window   time.Duration
+}
+
+func (s *metricSet) update(member uint64, now time.Time, window time.Duration) {
+	s.window = window
+	s.rotate(now)
+	s.current.Add(member)
+}
+
+func (s *metricSet) rotate(now time.Time) {
+	if elapsed := now.Sub(s.start); elapsed >= s.window {
+		s.previous, s.current = s.current, s.previous
+		s.current.Reset()
+
+		if elapsed >= 2*s.window {
+			s.previous.Reset()
+		}
+
+		s.start = now
+	}
+}
+
+// estimate returns the number of distinct values of the set at time now.
+func (s *metricSet) estimate(now time.Time) float64 {
+	s.rotate(now)
+
+	var merged sketch.HyperLogLog
+	merged.Merge(&s.previous)
+	merged.Merge(&s.current)
+	return math.Round(merged.Estimate())
+}
+
 // This function builds a string of column-separated float representations of
 // the given list of buckets, which is then split by calls to nextLe to generate
 // the values of the "le" label for each bucket of a histogram.
@@ -28,7 +28,7 @@ func TestFuzzyDeadlock(t *testing.T) {
 			value: 1,
 			time:  time.Now().Add(-time.Hour), // expired
 		}
-		store.update(m, nil)
+		store.update(m, nil, 1)
 
 		// 2) race collect vs cleanup once
 		done := make(chan struct{}, 2)
@@ -53,6 +53,26 @@ func TestFuzzyDeadlock(t *testing.T) {
 	}
 }
 
+func TestMetricStoreTagSet(t *testing.T) {
+	tags := stats.NewTagSet(stats.T("a", "1"), stats.T("b", "2"))
+	labels := labels{}.appendTags(tags.Tags()...)
+
+	var store metricStore
+	// Metrics carrying the tag set and metrics only carrying the labels must
+	// update the same series.
+	store.update(metric{mtype: counter, name: "A", value: 1, labels: labels, hash: tags.Hash(), tagSet: tags}, nil, 1)
+	store.update(metric{mtype: counter, name: "A", value: 2, labels: labels.copy(), hash: stats.HashTags(tags.Tags())}, nil, 1)
+	store.update(metric{mtype: counter, name: "A", value: 4, labels: labels, hash: tags.Hash(), tagSet: tags}, nil, 1)
+
+	metrics := store.collect(nil)
+
+	if !reflect.DeepEqual(metrics, []metric{
+		{mtype: counter, name: "A", value: 7, labels: labels},
+	}) {
+		t.Errorf("bad metrics: %#v", metrics)
+	}
+}
+
 func TestUnsafeByteSliceToString(t *testing.T) {
 	for _, test := range []struct {
 		name     string
@@ -116,7 +136,7 @@ func TestMetricStore(t *testing.T) {
 			stats.ValueOf(0.5),
 			stats.ValueOf(0.75),
 			stats.ValueOf(1.0),
-		})
+		}, 1)
 	}
 
 	metrics := store.collect(nil)
@@ -215,11 +235,11 @@ func TestMetricStoreCleanup(t *testing.T) {
 	now := time.Now()
 
 	store := metricStore{}
-	store.update(metric{mtype: counter, name: "A", value: 1, time: now.Add(-time.Hour)}, nil)
-	store.update(metric{mtype: counter, name: "B", value: 1, time: now.Add(-time.Minute)}, nil)
-	store.update(metric{mtype: counter, name: "C", value: 1, time: now.Add(-time.Second)}, nil)
-	store.update(metric{mtype: counter, name: "D", value: 1, time: now}, nil)
-	store.update(metric{mtype: counter, name: "E", value: 1, time: now.Add(time.Second)}, nil)
+	store.update(metric{mtype: counter, name: "A", value: 1, time: now.Add(-time.Hour)}, nil, 1)
+	store.update(metric{mtype: counter, name: "B", value: 1, time: now.Add(-time.Minute)}, nil, 1)
+	store.update(metric{mtype: counter, name: "C", value: 1, time: now.Add(-time.Second)}, nil, 1)
+	store.update(metric{mtype: counter, name: "D", value: 1, time: now}, nil, 1)
+	store.update(metric{mtype: counter, name: "E", value: 1, time: now.Add(time.Second)}, nil, 1)
 
 	wg := sync.WaitGroup{}
 	wg.Add(8)
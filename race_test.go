@@ -0,0 +1,7 @@
+//go:build race
+
+package stats_test
+
+// sync.Pool randomly drops objects when the race detector is enabled, tests
+// checking that code paths don't allocate are skipped in that case.
+const raceEnabled = true
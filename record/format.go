@@ -0,0 +1,344 @@
+// Package record captures the measures produced by a program to a compact
+// binary format, and replays them to any stats.Handler.
+//
+// A Recorder is a handler which records the batches of measures it receives,
+// either to a file or, in ring mode, to memory so the most recent measures can
+// be dumped when the program panics:
+//
+//	rec := &record.Recorder{Path: "stats.rec", MaxSize: 64 << 20}
+//	defer rec.Close()
+//
+//	stats.Register(rec)
+//
+// The recorded measures can then be replayed offline to a different backend:
+//
+//	f, _ := os.Open("stats.rec")
+//	defer f.Close()
+//
+//	err := record.Replay(f, influxdb.NewClient("localhost:8086"), 0)
+//
+// # Format
+//
+// Recordings start with a 5 bytes header, the "srec" magic followed by the
+// version of the format, and are followed by a sequence of batches. Each batch
+// is prefixed with its length as an unsigned varint, and holds the time of the
+// batch and its measures. The time is a byte set to 1 followed by the number
+// of nanoseconds since the Unix epoch, or a byte set to 0 for the zero time.
+// Integers are encoded as varints, and strings as their length followed by
+// their bytes. Every file written by a Recorder starts with a header, so
+// rotated files can be replayed independently.
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+const (
+	magic = "srec"
+
+	// Version 2 encodes the zero time of batches explicitly, the recordings
+	// of version 1 are not supported.
+	version = 2
+
+	headerSize = len(magic) + 1
+
+	// Batches larger than this are considered corrupted, it protects readers
+	// from allocating unbounded amounts of memory.
+	maxBatchSize = 256 << 20
+)
+
+// ErrInvalidFormat is returned when reading data that isn't a recording, or a
+// recording of a version that this package doesn't support.
+var ErrInvalidFormat = errors.New("stats/record: invalid format")
+
+// appendTime appends t to b. The zero time is encoded explicitly since its
+// number of nanoseconds since the Unix epoch overflows an int64.
+func appendTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(b, 0)
+	}
+	b = append(b, 1)
+	return binary.AppendVarint(b, t.UnixNano())
+}
+
+func appendHeader(b []byte) []byte {
+	b = append(b, magic...)
+	return append(b, version)
+}
+
+// appendBatch appends the encoding of a batch of measures at time t to b,
+// including its length prefix.
+func appendBatch(b []byte, t time.Time, measures []stats.Measure) []byte {
+	// The batch is encoded after room reserved for the longest length prefix,
+	// then moved back next to its actual prefix.
+	start := len(b)
+	b = append(b, make([]byte, binary.MaxVarintLen64)...)
+	n := len(b)
+
+	b = appendTime(b, t)
+	b = binary.AppendUvarint(b, uint64(len(measures)))
+
+	for i := range measures {
+		b = appendMeasure(b, &measures[i])
+	}
+
+	size := len(b) - n
+	prefix := binary.PutUvarint(b[start:], uint64(size))
+	copy(b[start+prefix:], b[n:])
+	return b[:start+prefix+size]
+}
+
+func appendMeasure(b []byte, m *stats.Measure) []byte {
+	b = appendString(b, m.Name)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(m.SampleRate))
+	b = binary.AppendUvarint(b, uint64(len(m.Fields)))
+
+	for _, f := range m.Fields {
+		b = appendString(b, f.Name)
+		b = append(b, byte(f.Type()), byte(f.Value.Type()))
+
+		switch v := f.Value; v.Type() {
+		case stats.Bool, stats.Uint:
+			b = binary.AppendUvarint(b, v.Uint())
+		case stats.Int, stats.Duration:
+			b = binary.AppendVarint(b, v.Int())
+		case stats.Float:
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float()))
+		}
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(m.Tags)))
+
+	for _, t := range m.Tags {
+		b = appendString(b, t.Name)
+		b = appendString(b, t.Value)
+	}
+
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// Reader decodes the batches of measures of a recording.
+type Reader struct {
+	r      *bufio.Reader
+	header bool
+	buf    []byte
+}
+
+// NewReader returns a Reader decoding the recording read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next decodes the next batch of the recording, and returns its time and
+// measures. The measures remain valid after the next call.
+//
+// At the end of the recording, Next returns io.EOF. If the recording ends in
+// the middle of a batch, which happens when the program writing it crashed,
+// it returns io.ErrUnexpectedEOF.
+func (r *Reader) Next() (time.Time, []stats.Measure, error) {
+	if !r.header {
+		if err := r.readHeader(); err != nil {
+			return time.Time{}, nil, err
+		}
+		r.header = true
+	}
+
+	size, err := binary.ReadUvarint(r.r)
+	switch {
+	case errors.Is(err, io.EOF):
+		return time.Time{}, nil, io.EOF
+	case err != nil:
+		return time.Time{}, nil, unexpectedEOF(err)
+	case size > maxBatchSize:
+		return time.Time{}, nil, fmt.Errorf("%w: batch of %d bytes", ErrInvalidFormat, size)
+	}
+
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return time.Time{}, nil, unexpectedEOF(err)
+	}
+
+	d := decoder{b: r.buf}
+	t := d.time()
+	measures := make([]stats.Measure, d.length())
+
+	for i := range measures {
+		measures[i] = d.measure()
+	}
+
+	if d.err != nil {
+		return time.Time{}, nil, d.err
+	}
+	return t, measures, nil
+}
+
+func (r *Reader) readHeader() error {
+	var h [headerSize]byte
+
+	if _, err := io.ReadFull(r.r, h[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return ErrInvalidFormat
+	}
+
+	if string(h[:len(magic)]) != magic || h[len(magic)] != version {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decoder reads the values encoded in a batch. Decoding errors are sticky, the
+// methods return zero values after the first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: malformed batch", ErrInvalidFormat)
+	}
+	d.b = nil
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) time() time.Time {
+	switch d.byte() {
+	case 0:
+		return time.Time{}
+	case 1:
+		return time.Unix(0, d.varint())
+	default:
+		d.fail()
+		return time.Time{}
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// length decodes the length of a sequence, which cannot be larger than the
+// number of bytes left in the batch since every element uses at least one.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) == 0 {
+		d.fail()
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) uint64() uint64 {
+	if len(d.b) < 8 {
+		d.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func (d *decoder) measure() stats.Measure {
+	m := stats.Measure{
+		Name:       d.string(),
+		SampleRate: math.Float64frombits(d.uint64()),
+	}
+
+	if n := d.length(); n != 0 {
+		m.Fields = make([]stats.Field, n)
+
+		for i := range m.Fields {
+			name := d.string()
+			ftype := stats.FieldType(d.byte())
+			m.Fields[i] = stats.MakeField(name, d.value(stats.Type(d.byte())), ftype)
+		}
+	}
+
+	if n := d.length(); n != 0 {
+		m.Tags = make([]stats.Tag, n)
+
+		for i := range m.Tags {
+			m.Tags[i] = stats.Tag{Name: d.string(), Value: d.string()}
+		}
+	}
+
+	return m
+}
+
+func (d *decoder) value(t stats.Type) stats.Value {
+	switch t {
+	case stats.Null:
+		return stats.Value{}
+	case stats.Bool:
+		return stats.ValueOf(d.uvarint() != 0)
+	case stats.Int:
+		return stats.ValueOf(d.varint())
+	case stats.Uint:
+		return stats.ValueOf(d.uvarint())
+	case stats.Float:
+		return stats.ValueOf(math.Float64frombits(d.uint64()))
+	case stats.Duration:
+		return stats.ValueOf(time.Duration(d.varint()))
+	default:
+		d.fail()
+		return stats.Value{}
+	}
+}
@@ -0,0 +1,299 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+var testMeasures = []stats.Measure{
+	{
+		Name: "http",
+		Fields: []stats.Field{
+			stats.MakeField("count", 1, stats.Counter),
+			stats.MakeField("rtt", 150*time.Millisecond, stats.Histogram),
+			stats.MakeField("ratio", 0.25, stats.Gauge),
+			stats.MakeField("size", uint64(1024), stats.Histogram),
+			stats.MakeField("ok", true, stats.Gauge),
+			stats.MakeField("users", stats.HashValue("luke"), stats.Distinct),
+			stats.MakeField("debt", -42, stats.Gauge),
+		},
+		Tags: []stats.Tag{stats.T("method", "GET"), stats.T("status", "200")},
+	},
+	{
+		Name:       "sampled",
+		Fields:     []stats.Field{stats.MakeField("", 1, stats.Counter)},
+		SampleRate: 0.5,
+	},
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.rec")
+	rec := NewRecorder(path)
+
+	t0 := time.Unix(1700000000, 123)
+	rec.HandleMeasures(t0, testMeasures...)
+	rec.HandleMeasures(t0.Add(time.Second), testMeasures[1])
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := NewReader(f)
+
+	tm, measures, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tm.Equal(t0) || !reflect.DeepEqual(measures, testMeasures) {
+		t.Errorf("bad first batch at %v:\n%#v", tm, measures)
+	}
+
+	tm, measures, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tm.Equal(t0.Add(time.Second)) || !reflect.DeepEqual(measures, testMeasures[1:]) {
+		t.Errorf("bad second batch at %v:\n%#v", tm, measures)
+	}
+
+	if _, _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Error("expected io.EOF at the end of the recording, got", err)
+	}
+}
+
+func TestRecorderRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.rec")
+	rec := &Recorder{Path: path, MaxBackups: 2}
+
+	// Each file holds exactly two batches.
+	batch := appendBatch(nil, time.Unix(1, 0), testMeasures[1:])
+	rec.MaxSize = int64(headerSize + 2*len(batch))
+
+	for i := range 7 {
+		rec.HandleMeasures(time.Unix(int64(i), 0), testMeasures[1])
+	}
+	rec.Close()
+
+	for file, times := range map[string][]int64{
+		path:        {6},
+		path + ".1": {4, 5},
+		path + ".2": {2, 3},
+	} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := &timesHandler{}
+		if err := Replay(bytes.NewReader(b), h, 0); err != nil {
+			t.Error(file, err)
+		}
+		if !reflect.DeepEqual(h.unix(), times) {
+			t.Errorf("%s: bad batches: %v != %v", file, h.unix(), times)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("too many backups were retained:", err)
+	}
+}
+
+func TestRecorderRing(t *testing.T) {
+	batch := appendBatch(nil, time.Unix(1, 0), testMeasures[1:])
+	rec := NewRingRecorder(3 * len(batch))
+
+	for i := range 5 {
+		rec.HandleMeasures(time.Unix(int64(i), 0), testMeasures[1])
+	}
+
+	var b bytes.Buffer
+	if err := rec.Dump(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &timesHandler{}
+	if err := Replay(&b, h, 0); err != nil {
+		t.Fatal(err)
+	}
+	if times := h.unix(); !reflect.DeepEqual(times, []int64{2, 3, 4}) {
+		t.Error("bad batches retained by the ring:", times)
+	}
+}
+
+func TestRecorderDumpOnPanic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "panic.rec")
+	rec := NewRingRecorder(1024)
+	rec.HandleMeasures(time.Unix(1, 0), testMeasures...)
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Error("the panic was not resumed:", v)
+			}
+		}()
+		defer rec.DumpOnPanic(path)
+		panic("boom")
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := &statstest.Handler{}
+	if err := Replay(f, h, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.Measures(), testMeasures) {
+		t.Errorf("bad measures dumped: %#v", h.Measures())
+	}
+	if h.FlushCalls() != 1 {
+		t.Error("the handler was not flushed after the replay")
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	rec := NewRingRecorder(1024)
+	rec.HandleMeasures(time.Unix(100, 0), testMeasures[1])
+	rec.HandleMeasures(time.Unix(110, 0), testMeasures[1])
+	rec.HandleMeasures(time.Unix(130, 0), testMeasures[1])
+
+	var b bytes.Buffer
+	rec.Dump(&b)
+
+	clock := time.Unix(1000, 0)
+	now := func() time.Time { return clock }
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		clock = clock.Add(d)
+	}
+
+	h := &timesHandler{}
+	if err := replay(NewReader(&b), h, 2, now, sleep); err != nil {
+		t.Fatal(err)
+	}
+
+	if times := h.unix(); !reflect.DeepEqual(times, []int64{1000, 1005, 1015}) {
+		t.Error("bad rescaled times:", times)
+	}
+	if !reflect.DeepEqual(sleeps, []time.Duration{5 * time.Second, 10 * time.Second}) {
+		t.Error("bad delays between batches:", sleeps)
+	}
+}
+
+func TestRecordZeroTime(t *testing.T) {
+	var b []byte
+	b = appendHeader(b)
+	b = appendBatch(b, time.Time{}, testMeasures)
+	b = appendBatch(b, time.Unix(0, 0), testMeasures)
+	b = appendBatch(b, time.Unix(100, 0), testMeasures)
+
+	r := NewReader(bytes.NewReader(b))
+	for _, want := range []time.Time{{}, time.Unix(0, 0), time.Unix(100, 0)} {
+		got, _, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) || got.IsZero() != want.IsZero() {
+			t.Errorf("bad time: want %v, got %v", want, got)
+		}
+	}
+
+	clock := time.Unix(1000, 0)
+	var sleeps []time.Duration
+	h := &timesHandler{}
+	err := replay(NewReader(bytes.NewReader(b)), h, 2,
+		func() time.Time { return clock },
+		func(d time.Duration) { sleeps = append(sleeps, d); clock = clock.Add(d) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.times[0].IsZero() {
+		t.Error("the zero time was not preserved by the replay:", h.times[0])
+	}
+	if times := h.unix()[1:]; !reflect.DeepEqual(times, []int64{1000, 1050}) {
+		t.Error("bad rescaled times:", times)
+	}
+	if !reflect.DeepEqual(sleeps, []time.Duration{50 * time.Second}) {
+		t.Error("bad delays between batches:", sleeps)
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	var b []byte
+	b = appendHeader(b)
+	b = appendBatch(b, time.Unix(1, 0), testMeasures)
+	b = appendBatch(b, time.Unix(2, 0), testMeasures)
+
+	h := &timesHandler{}
+	err := Replay(bytes.NewReader(b[:len(b)-3]), h, 0)
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expected io.ErrUnexpectedEOF, got", err)
+	}
+	if times := h.unix(); !reflect.DeepEqual(times, []int64{1}) {
+		t.Error("the complete batches were not replayed:", times)
+	}
+}
+
+func TestReplayInvalidFormat(t *testing.T) {
+	for _, b := range [][]byte{
+		[]byte("hello world"),
+		append([]byte(magic), version+1),
+		append(appendHeader(nil), 4, 0, 1, 0xff, 0xff),
+	} {
+		if err := Replay(bytes.NewReader(b), &statstest.Handler{}, 0); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%q: expected ErrInvalidFormat, got %v", b, err)
+		}
+	}
+
+	if err := Replay(bytes.NewReader(nil), &statstest.Handler{}, 0); err != nil {
+		t.Error("replaying an empty input must not fail:", err)
+	}
+}
+
+func BenchmarkRecorder(b *testing.B) {
+	rec := NewRecorder(filepath.Join(b.TempDir(), "stats.rec"))
+	defer rec.Close()
+	now := time.Now()
+
+	for b.Loop() {
+		rec.HandleMeasures(now, testMeasures...)
+	}
+}
+
+// timesHandler records the times of the batches it handles.
+type timesHandler struct {
+	times []time.Time
+}
+
+func (h *timesHandler) HandleMeasures(t time.Time, _ ...stats.Measure) {
+	h.times = append(h.times, t)
+}
+
+func (h *timesHandler) unix() []int64 {
+	s := make([]int64, len(h.times))
+	for i, t := range h.times {
+		s[i] = t.Unix()
+	}
+	return s
+}
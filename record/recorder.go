@@ -0,0 +1,241 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+// DefaultMaxBackups is the default number of rotated files that a Recorder
+// retains.
+const DefaultMaxBackups = 3
+
+// Recorder is a stats.Handler which records the batches of measures it
+// receives, with the time they were handled at.
+//
+// By default the batches are appended to the file at Path, which is rotated
+// when it reaches MaxSize. When RingSize is set, the recorder runs in ring
+// mode instead: it retains the most recent batches in memory, and writes them
+// only when Dump is called, like a flight recorder.
+//
+// Errors writing the file are reported to ErrorHandler, or to the global error
+// handler of the stats package if nil. The program must call Close to release
+// the file.
+type Recorder struct {
+	// Path of the file that measures are recorded to. When the file is rotated,
+	// it is renamed with a ".1" suffix, and the suffixes of previous files are
+	// incremented. Files that already exist are truncated.
+	Path string
+
+	// Size in bytes after which the file is rotated. If zero, the file is
+	// never rotated.
+	MaxSize int64
+
+	// Number of rotated files retained, the oldest files are removed. If
+	// zero, DefaultMaxBackups is used.
+	MaxBackups int
+
+	// Number of bytes of the most recent batches retained in memory in ring
+	// mode. Zero disables ring mode.
+	RingSize int
+
+	// Handler of errors encountered when writing the file.
+	ErrorHandler stats.ErrorHandler
+
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+	buffer []byte
+
+	// In ring mode, queue of encoded batches, and the sum of their sizes.
+	ring     [][]byte
+	ringSize int
+}
+
+// NewRecorder returns a Recorder writing measures to the file at path.
+func NewRecorder(path string) *Recorder {
+	return &Recorder{Path: path}
+}
+
+// NewRingRecorder returns a Recorder retaining the size most recent bytes of
+// batches in memory.
+func NewRingRecorder(size int) *Recorder {
+	return &Recorder{RingSize: size}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (r *Recorder) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	if len(measures) == 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	if r.RingSize != 0 {
+		r.push(appendBatch(nil, t, measures))
+		return
+	}
+
+	r.buffer = appendBatch(r.buffer[:0], t, measures)
+
+	if err := r.write(r.buffer); err != nil {
+		r.handleError(err)
+	}
+}
+
+// Dump writes a recording of the batches retained in memory to w, in ring
+// mode. The recording may be replayed with Replay.
+func (r *Recorder) Dump(w io.Writer) error {
+	r.mutex.Lock()
+	b := appendHeader(make([]byte, 0, headerSize+r.ringSize))
+	for _, batch := range r.ring {
+		b = append(b, batch...)
+	}
+	r.mutex.Unlock()
+
+	_, err := w.Write(b)
+	return err
+}
+
+// DumpOnPanic dumps the batches retained in memory to the file at path if the
+// program panics, then resumes panicking. It must be deferred:
+//
+//	defer rec.DumpOnPanic("stats.rec")
+func (r *Recorder) DumpOnPanic(path string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	if err := r.dumpFile(path); err != nil {
+		r.handleError(err)
+	}
+
+	panic(v)
+}
+
+func (r *Recorder) dumpFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Dump(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close closes the file that the recorder writes to, the measures handled
+// after calling Close are discarded. In ring mode, the batches retained in
+// memory can still be dumped.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *Recorder) push(batch []byte) {
+	r.ring = append(r.ring, batch)
+	r.ringSize += len(batch)
+
+	// The most recent batch is always retained, even if it is larger than
+	// the ring.
+	for len(r.ring) > 1 && r.ringSize > r.RingSize {
+		r.ringSize -= len(r.ring[0])
+		r.ring[0] = nil
+		r.ring = r.ring[1:]
+	}
+}
+
+func (r *Recorder) write(batch []byte) error {
+	if r.file != nil && r.MaxSize != 0 && r.size+int64(len(batch)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.file.Write(batch)
+	r.size += int64(n)
+	return err
+}
+
+func (r *Recorder) open() error {
+	if r.Path == "" {
+		return errors.New("no path to record measures to")
+	}
+
+	f, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+
+	n, err := f.Write(appendHeader(nil))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file, r.size = f, int64(n)
+	return nil
+}
+
+func (r *Recorder) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	backups := r.maxBackups()
+	// The oldest file is overwritten by the rename if it exists.
+	for i := backups - 1; i > 0; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(r.Path, r.backup(1))
+}
+
+func (r *Recorder) backup(i int) string {
+	return r.Path + "." + strconv.Itoa(i)
+}
+
+func (r *Recorder) maxBackups() int {
+	if r.MaxBackups > 0 {
+		return r.MaxBackups
+	}
+	return DefaultMaxBackups
+}
+
+func (r *Recorder) handleError(err error) {
+	stats.HandleErrorWith(r.ErrorHandler, fmt.Errorf("stats/record: %w", err))
+}
@@ -0,0 +1,55 @@
+package record
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+// Replay reads the recording from r and passes its batches of measures to h,
+// then flushes h if it implements stats.Flusher.
+//
+// When speed is zero or negative, the batches are replayed as fast as possible
+// and keep their original time. Otherwise the batches are replayed at the pace
+// they were recorded at, scaled by speed (2 replays twice as fast), and their
+// time is rescaled to the time they are replayed at. Batches recorded without a
+// time (the zero time) are replayed immediately and keep the zero time.
+//
+// Replay returns nil when it reached the end of the recording, or the error
+// that interrupted it, in which case the batches read before the error were
+// replayed already.
+func Replay(r io.Reader, h stats.Handler, speed float64) error {
+	return replay(NewReader(r), h, speed, time.Now, time.Sleep)
+}
+
+func replay(r *Reader, h stats.Handler, speed float64, now func() time.Time, sleep func(time.Duration)) error {
+	var first, start time.Time
+
+	for {
+		t, measures, err := r.Next()
+		if err != nil {
+			if f, ok := h.(stats.Flusher); ok {
+				f.Flush()
+			}
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return err
+		}
+
+		if speed > 0 && !t.IsZero() {
+			if first.IsZero() {
+				first, start = t, now()
+			}
+			t = start.Add(time.Duration(float64(t.Sub(first)) / speed))
+
+			if delay := t.Sub(now()); delay > 0 {
+				sleep(delay)
+			}
+		}
+
+		h.HandleMeasures(t, measures...)
+	}
+}
@@ -0,0 +1,241 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+// Handler is a measure handler which applies relabeling rules to measures
+// before forwarding them to another handler.
+//
+// Rules are applied in order to each measure. Measures dropped by a Keep or
+// Drop rule are not forwarded, and tags with an empty value are removed from
+// the rewritten measures. Measures passed to the wrapped handler always have
+// sorted tags, and the measures passed to HandleMeasures are never modified.
+type Handler struct {
+	handler stats.Handler
+	rules   []rule
+}
+
+// NewHandler returns a Handler which applies rules to measures before
+// forwarding them to handler. The function returns an error if one of the rules
+// is invalid.
+func NewHandler(handler stats.Handler, rules ...Rule) (*Handler, error) {
+	h := &Handler{
+		handler: handler,
+		rules:   make([]rule, len(rules)),
+	}
+
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return nil, err
+		}
+		h.rules[i] = c
+	}
+
+	return h, nil
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	var relabeled []stats.Measure
+	var buffer []byte
+
+	for i := range measures {
+		m, keep, changed := h.relabel(measures[i], &buffer)
+
+		if !changed && relabeled == nil {
+			continue
+		}
+
+		if relabeled == nil {
+			relabeled = make([]stats.Measure, i, len(measures))
+			copy(relabeled, measures[:i])
+		}
+
+		if keep {
+			relabeled = append(relabeled, m)
+		}
+	}
+
+	if relabeled != nil {
+		measures = relabeled
+	}
+
+	if len(measures) != 0 {
+		h.handler.HandleMeasures(t, measures...)
+	}
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (h *Handler) Flush() {
+	if f, ok := h.handler.(stats.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close closes the handler that measures are forwarded to, or flushes it if it
+// has no Close method. Close satisfies the stats.Closer interface.
+func (h *Handler) Close() error {
+	if c, ok := h.handler.(stats.Closer); ok {
+		return c.Close()
+	}
+	h.Flush()
+	return nil
+}
+
+// relabel applies the rules to m. It returns the rewritten measure, whether it
+// should be kept, and whether it differs from m.
+func (h *Handler) relabel(m stats.Measure, buffer *[]byte) (stats.Measure, bool, bool) {
+	l := labels{name: m.Name, tags: m.Tags}
+
+	for i := range h.rules {
+		r := &h.rules[i]
+
+		switch r.Action {
+		case Replace:
+			*buffer = l.join((*buffer)[:0], r.SourceLabels, r.Separator)
+			match := r.regex.FindSubmatchIndex(*buffer)
+			if match == nil {
+				break
+			}
+			target := string(r.regex.Expand(nil, []byte(r.TargetLabel), *buffer, match))
+			value := string(r.regex.Expand(nil, []byte(r.Replacement), *buffer, match))
+			l.set(target, value)
+
+		case Keep:
+			*buffer = l.join((*buffer)[:0], r.SourceLabels, r.Separator)
+			if !r.regex.Match(*buffer) {
+				return m, false, true
+			}
+
+		case Drop:
+			*buffer = l.join((*buffer)[:0], r.SourceLabels, r.Separator)
+			if r.regex.Match(*buffer) {
+				return m, false, true
+			}
+
+		case HashMod:
+			*buffer = l.join((*buffer)[:0], r.SourceLabels, r.Separator)
+			sum := md5.Sum(*buffer)
+			mod := binary.BigEndian.Uint64(sum[8:]) % r.Modulus
+			l.set(r.TargetLabel, strconv.FormatUint(mod, 10))
+
+		case LabelMap:
+			tags := l.tags
+			for _, t := range tags {
+				if r.regex.MatchString(t.Name) {
+					l.set(r.regex.ReplaceAllString(t.Name, r.Replacement), t.Value)
+				}
+			}
+
+		case LabelDrop:
+			l.filter(func(t stats.Tag) bool { return !r.regex.MatchString(t.Name) })
+
+		case LabelKeep:
+			l.filter(func(t stats.Tag) bool { return r.regex.MatchString(t.Name) })
+		}
+	}
+
+	if !l.copied && l.name == m.Name {
+		return m, true, false
+	}
+
+	if l.copied {
+		l.filter(func(t stats.Tag) bool { return t.Value != "" })
+		if !stats.TagsAreSorted(l.tags) {
+			l.tags = stats.SortTags(l.tags)
+		}
+	}
+
+	m.Name = l.name
+	m.Tags = l.tags
+	return m, true, true
+}
+
+// labels is the set of labels that rules operate on. The tags are copied the
+// first time they are modified so the original measure is left untouched.
+type labels struct {
+	name   string
+	tags   []stats.Tag
+	copied bool
+}
+
+func (l *labels) get(name string) string {
+	if name == NameLabel {
+		return l.name
+	}
+	for _, t := range l.tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+func (l *labels) set(name, value string) {
+	if name == NameLabel {
+		l.name = value
+		return
+	}
+
+	l.copy()
+
+	for i := range l.tags {
+		if l.tags[i].Name == name {
+			l.tags[i].Value = value
+			return
+		}
+	}
+
+	l.tags = append(l.tags, stats.T(name, value))
+}
+
+func (l *labels) filter(keep func(stats.Tag) bool) {
+	n := 0
+
+	for _, t := range l.tags {
+		if keep(t) {
+			n++
+		}
+	}
+
+	if n == len(l.tags) {
+		return
+	}
+
+	l.copy()
+	tags := l.tags[:0]
+
+	for _, t := range l.tags {
+		if keep(t) {
+			tags = append(tags, t)
+		}
+	}
+
+	l.tags = tags
+}
+
+func (l *labels) copy() {
+	if !l.copied {
+		tags := make([]stats.Tag, len(l.tags), len(l.tags)+1)
+		copy(tags, l.tags)
+		l.tags = tags
+		l.copied = true
+	}
+}
+
+func (l *labels) join(b []byte, names []string, separator string) []byte {
+	for i, name := range names {
+		if i != 0 {
+			b = append(b, separator...)
+		}
+		b = append(b, l.get(name)...)
+	}
+	return b
+}
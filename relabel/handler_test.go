@@ -0,0 +1,205 @@
+package relabel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestHandler(t *testing.T) {
+	rule := func(r Rule) Rule {
+		d := DefaultRule
+		d.SourceLabels = r.SourceLabels
+		d.TargetLabel = r.TargetLabel
+		d.Modulus = r.Modulus
+		if r.Regex != "" {
+			d.Regex = r.Regex
+		}
+		if r.Replacement != "" {
+			d.Replacement = r.Replacement
+		}
+		if r.Action != "" {
+			d.Action = r.Action
+		}
+		return d
+	}
+
+	tests := []struct {
+		scenario string
+		rules    []Rule
+		in       stats.Measure
+		out      []stats.Measure
+	}{
+		{
+			scenario: "measures are forwarded unchanged without rules",
+			in:       measure("http", stats.T("host", "a")),
+			out:      []stats.Measure{measure("http", stats.T("host", "a"))},
+		},
+		{
+			scenario: "keep rules drop measures that don't match",
+			rules:    []Rule{rule(Rule{SourceLabels: []string{NameLabel}, Regex: "rpc", Action: Keep})},
+			in:       measure("http"),
+		},
+		{
+			scenario: "drop rules drop measures that match",
+			rules:    []Rule{rule(Rule{SourceLabels: []string{"env"}, Regex: "dev|test", Action: Drop})},
+			in:       measure("http", stats.T("env", "test")),
+		},
+		{
+			scenario: "drop rules keep measures that don't match",
+			rules:    []Rule{rule(Rule{SourceLabels: []string{"env"}, Regex: "dev|test", Action: Drop})},
+			in:       measure("http", stats.T("env", "prod")),
+			out:      []stats.Measure{measure("http", stats.T("env", "prod"))},
+		},
+		{
+			scenario: "replace rules expand capture groups and keep tags sorted",
+			rules: []Rule{rule(Rule{
+				SourceLabels: []string{"host", "port"},
+				Regex:        `([^.]+)\..*;(.*)`,
+				TargetLabel:  "address",
+				Replacement:  "$1:$2",
+			})},
+			in:  measure("http", stats.T("host", "a.example.com"), stats.T("port", "80")),
+			out: []stats.Measure{measure("http", stats.T("address", "a:80"), stats.T("host", "a.example.com"), stats.T("port", "80"))},
+		},
+		{
+			scenario: "replace rules rewrite the measure name",
+			rules: []Rule{rule(Rule{
+				SourceLabels: []string{NameLabel},
+				Regex:        "legacy_(.*)",
+				TargetLabel:  NameLabel,
+			})},
+			in:  measure("legacy_http"),
+			out: []stats.Measure{measure("http")},
+		},
+		{
+			scenario: "replace rules with an empty replacement remove the target label",
+			rules: []Rule{{
+				SourceLabels: []string{"user_id"},
+				Regex:        ".+",
+				TargetLabel:  "user_id",
+				Action:       Replace,
+			}},
+			in:  measure("http", stats.T("host", "a"), stats.T("user_id", "42")),
+			out: []stats.Measure{measure("http", stats.T("host", "a"))},
+		},
+		{
+			scenario: "hashmod rules set the target label to the hash modulus",
+			rules: []Rule{rule(Rule{
+				SourceLabels: []string{"host"},
+				TargetLabel:  "shard",
+				Modulus:      1,
+				Action:       HashMod,
+			})},
+			in:  measure("http", stats.T("host", "a")),
+			out: []stats.Measure{measure("http", stats.T("host", "a"), stats.T("shard", "0"))},
+		},
+		{
+			scenario: "labelmap rules copy matching labels",
+			rules:    []Rule{rule(Rule{Regex: "k8s_(.*)", Action: LabelMap})},
+			in:       measure("http", stats.T("k8s_pod", "p"), stats.T("zone", "z")),
+			out:      []stats.Measure{measure("http", stats.T("k8s_pod", "p"), stats.T("pod", "p"), stats.T("zone", "z"))},
+		},
+		{
+			scenario: "labeldrop rules remove matching labels",
+			rules:    []Rule{rule(Rule{Regex: "user_id|request_id", Action: LabelDrop})},
+			in:       measure("http", stats.T("host", "a"), stats.T("request_id", "1"), stats.T("user_id", "2")),
+			out:      []stats.Measure{measure("http", stats.T("host", "a"))},
+		},
+		{
+			scenario: "relabeled tags are deduplicated",
+			rules:    []Rule{rule(Rule{Regex: "zone", Action: LabelDrop})},
+			in:       measure("http", stats.T("host", "a"), stats.T("zone", "z"), stats.T("env", "e"), stats.T("host", "b")),
+			out:      []stats.Measure{measure("http", stats.T("env", "e"), stats.T("host", "b"))},
+		},
+		{
+			scenario: "labelkeep rules remove labels that don't match",
+			rules:    []Rule{rule(Rule{Regex: "host|zone", Action: LabelKeep})},
+			in:       measure("http", stats.T("host", "a"), stats.T("request_id", "1"), stats.T("zone", "z")),
+			out:      []stats.Measure{measure("http", stats.T("host", "a"), stats.T("zone", "z"))},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			r, err := NewHandler(h, test.rules...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			in := test.in.Clone()
+			r.HandleMeasures(time.Now(), in)
+
+			assert.ElementsMatch(t, test.out, h.Measures())
+			assert.Equal(t, test.in, in, "the input measure must not be modified")
+		})
+	}
+}
+
+func TestNewHandlerInvalidRules(t *testing.T) {
+	for _, r := range []Rule{
+		{Regex: "(", Action: Keep},
+		{Regex: ".*", Action: Replace},
+		{Regex: ".*", Action: HashMod, TargetLabel: "shard"},
+		{Regex: ".*", Action: "unknown"},
+	} {
+		if _, err := NewHandler(stats.Discard, r); err == nil {
+			t.Errorf("no error returned for invalid rule %+v", r)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	expected := []Rule{
+		{
+			SourceLabels: []string{NameLabel},
+			Separator:    ";",
+			Regex:        `debug\..*`,
+			Replacement:  "$1",
+			Action:       Drop,
+		},
+		{
+			SourceLabels: []string{"host"},
+			Separator:    ";",
+			Regex:        `([^.]+)\..*`,
+			TargetLabel:  "host",
+			Replacement:  "$1",
+			Action:       Replace,
+		},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		rules, err := ParseJSON([]byte(`[
+			{"source_labels": ["__name__"], "regex": "debug\\..*", "action": "drop"},
+			{"source_labels": ["host"], "regex": "([^.]+)\\..*", "target_label": "host"}
+		]`))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, rules)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		rules, err := ParseYAML([]byte(`
+- source_labels: [__name__]
+  regex: "debug\\..*"
+  action: drop
+- source_labels: [host]
+  regex: '([^.]+)\..*'
+  target_label: host
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, rules)
+	})
+}
+
+func measure(name string, tags ...stats.Tag) stats.Measure {
+	return stats.Measure{
+		Name:   name,
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   tags,
+	}
+}
@@ -0,0 +1,184 @@
+// Package relabel implements a measure handler rewriting the names and tags of
+// measures with a list of declarative rules.
+//
+// The rules follow the semantics of the relabel_configs section of Prometheus
+// configurations: each rule joins the values of its source labels, matches the
+// result against a regular expression, and applies an action. The measure name
+// is exposed to the rules as the special "__name__" label, all other labels are
+// the measure tags.
+//
+// Rules can be built in Go code, or loaded from JSON or YAML documents with
+// ParseJSON and ParseYAML:
+//
+//	# rules.yaml
+//	- source_labels: [__name__]
+//	  regex: "debug\\..*"
+//	  action: drop
+//	- source_labels: [host]
+//	  regex: "([^.]+)\\..*"
+//	  target_label: host
+//	- regex: "user_id|request_id"
+//	  action: labeldrop
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+	"gopkg.in/yaml.v3"
+)
+
+// NameLabel is the label name that rules use to refer to the measure name.
+const NameLabel = "__name__"
+
+// Action is an enumeration of the actions that a relabeling rule can perform.
+type Action string
+
+const (
+	// Replace sets the target label to the replacement, expanded with the
+	// capture groups of the regular expression, if the source labels match.
+	// If the expanded replacement is empty, the target label is removed.
+	Replace Action = "replace"
+
+	// Keep drops measures for which the source labels don't match the regular
+	// expression.
+	Keep Action = "keep"
+
+	// Drop drops measures for which the source labels match the regular
+	// expression.
+	Drop Action = "drop"
+
+	// HashMod sets the target label to the modulus of a hash of the source
+	// label values.
+	HashMod Action = "hashmod"
+
+	// LabelMap copies the values of all labels with a name matching the regular
+	// expression to labels named after the replacement.
+	LabelMap Action = "labelmap"
+
+	// LabelDrop removes all labels with a name matching the regular expression.
+	LabelDrop Action = "labeldrop"
+
+	// LabelKeep removes all labels with a name not matching the regular
+	// expression.
+	LabelKeep Action = "labelkeep"
+)
+
+// Rule is the configuration of a relabeling rule.
+//
+// The zero value is not a valid rule, programs constructing rules should start
+// from a copy of DefaultRule. The JSON and YAML decoders apply the values of
+// DefaultRule to the fields missing from the documents.
+type Rule struct {
+	// Labels whose values are joined with Separator and matched against Regex.
+	SourceLabels []string `json:"source_labels,omitempty" yaml:"source_labels,omitempty"`
+
+	// Separator placed between the values of SourceLabels.
+	Separator string `json:"separator,omitempty" yaml:"separator,omitempty"`
+
+	// Regular expression matched against the source values, or against the
+	// label names for the LabelMap, LabelDrop, and LabelKeep actions. The
+	// expression is anchored at both ends.
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+
+	// Modulus applied to the hash of the source values by the HashMod action.
+	Modulus uint64 `json:"modulus,omitempty" yaml:"modulus,omitempty"`
+
+	// Label written by the Replace and HashMod actions, capture groups of Regex
+	// are expanded in the label name by the Replace action.
+	TargetLabel string `json:"target_label,omitempty" yaml:"target_label,omitempty"`
+
+	// Value written by the Replace action, or label name generated by the
+	// LabelMap action. Capture groups of Regex are expanded in the value.
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+
+	// Action performed by the rule, Replace if empty.
+	Action Action `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// DefaultRule carries the default values of relabeling rules.
+var DefaultRule = Rule{
+	Separator:   ";",
+	Regex:       "(.*)",
+	Replacement: "$1",
+	Action:      Replace,
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (r *Rule) UnmarshalJSON(b []byte) error {
+	type rule Rule
+	v := rule(DefaultRule)
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = Rule(v)
+	return nil
+}
+
+// UnmarshalYAML satisfies the yaml.Unmarshaler interface.
+func (r *Rule) UnmarshalYAML(node *yaml.Node) error {
+	type rule Rule
+	v := rule(DefaultRule)
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	*r = Rule(v)
+	return nil
+}
+
+// ParseJSON parses a list of relabeling rules from a JSON array.
+func ParseJSON(b []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("relabel: parsing JSON rules: %w", err)
+	}
+	return rules, nil
+}
+
+// ParseYAML parses a list of relabeling rules from a YAML sequence.
+func ParseYAML(b []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("relabel: parsing YAML rules: %w", err)
+	}
+	return rules, nil
+}
+
+// rule is the compiled form of a Rule.
+type rule struct {
+	Rule
+	regex *regexp.Regexp
+}
+
+func compile(r Rule) (rule, error) {
+	if r.Action == "" {
+		r.Action = Replace
+	}
+	r.Action = Action(strings.ToLower(string(r.Action)))
+
+	regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return rule{}, fmt.Errorf("relabel: invalid regex %q: %w", r.Regex, err)
+	}
+
+	switch r.Action {
+	case Replace:
+		if r.TargetLabel == "" {
+			return rule{}, fmt.Errorf("relabel: %s action requires a target label", r.Action)
+		}
+	case HashMod:
+		if r.TargetLabel == "" {
+			return rule{}, fmt.Errorf("relabel: %s action requires a target label", r.Action)
+		}
+		if r.Modulus == 0 {
+			return rule{}, fmt.Errorf("relabel: %s action requires a non-zero modulus", r.Action)
+		}
+	case Keep, Drop, LabelMap, LabelDrop, LabelKeep:
+	default:
+		return rule{}, fmt.Errorf("relabel: unknown action %q", r.Action)
+	}
+
+	return rule{Rule: r, regex: regex}, nil
+}
@@ -0,0 +1,183 @@
+package stats
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+// Route is a rule of a Router, dispatching the measures that match it to a
+// handler.
+//
+// A measure matches a route if it satisfies all the conditions set on the
+// route, a route without conditions matches all measures.
+type Route struct {
+	// Glob pattern matched against the measure names, with the syntax of
+	// path.Match. For example "billing.*" matches all names starting with
+	// "billing.".
+	Name string
+
+	// Regular expression matched against the measure names.
+	Regexp *regexp.Regexp
+
+	// Tags that the measures must carry, with the same values.
+	Tags []Tag
+
+	// Handler that the matching measures are dispatched to. If nil, the
+	// matching measures are dropped.
+	Handler Handler
+}
+
+func (r *Route) match(m *Measure) bool {
+	if r.Name != "" {
+		// A malformed pattern never matches.
+		if ok, _ := path.Match(r.Name, m.Name); !ok {
+			return false
+		}
+	}
+
+	if r.Regexp != nil && !r.Regexp.MatchString(m.Name) {
+		return false
+	}
+
+	for _, t := range r.Tags {
+		if !hasTag(m.Tags, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasTag(tags []Tag, tag Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Router is a handler which dispatches measures to other handlers according to
+// a list of routes.
+//
+// The routes are evaluated in order. By default, measures are dispatched to
+// the first route that they match, so routes with a nil handler can be placed
+// first to drop measures. When FanOut is true, measures are dispatched to all
+// routes that they match. The measures that match no routes are dispatched to
+// the Default handler.
+//
+// The fields of a router must not be modified after it started handling
+// measures.
+type Router struct {
+	// Ordered list of routes.
+	Routes []Route
+
+	// Handler receiving the measures that match no routes. If nil, those
+	// measures are dropped.
+	Default Handler
+
+	// Dispatch measures to all the routes that they match instead of the
+	// first one.
+	FanOut bool
+}
+
+// NewRouter returns a Router dispatching measures to the first route that they
+// match, and the other measures to def.
+func NewRouter(def Handler, routes ...Route) *Router {
+	return &Router{Routes: routes, Default: def}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (r *Router) HandleMeasures(t time.Time, measures ...Measure) {
+	if len(measures) == 0 {
+		return
+	}
+
+	// Batches of measures dispatched to each route, the last one is the
+	// default route. Each handler is called once per call to HandleMeasures.
+	batches := make([][]Measure, len(r.Routes)+1)
+
+	for i := range measures {
+		m := &measures[i]
+		matched := false
+
+		for j := range r.Routes {
+			if r.Routes[j].match(m) {
+				batches[j] = append(batches[j], *m)
+				matched = true
+
+				if !r.FanOut {
+					break
+				}
+			}
+		}
+
+		if !matched {
+			batches[len(r.Routes)] = append(batches[len(r.Routes)], *m)
+		}
+	}
+
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		if h := r.handler(i); h != nil {
+			h.HandleMeasures(t, batch...)
+		}
+	}
+}
+
+// Flush flushes the handlers of all routes and the default handler, satisfies
+// the Flusher interface.
+func (r *Router) Flush() {
+	for _, h := range r.handlers() {
+		flush(h)
+	}
+}
+
+// Close closes the handlers of all routes and the default handler (or flushes
+// them if they don't implement Closer), and returns the aggregated errors,
+// satisfies the Closer interface.
+func (r *Router) Close() error {
+	return closeHandlers(context.Background(), r.handlers()...)
+}
+
+// handler returns the handler of the route at index i, or the default handler
+// if i is past the last route.
+func (r *Router) handler(i int) Handler {
+	if i == len(r.Routes) {
+		return r.Default
+	}
+	return r.Routes[i].Handler
+}
+
+func (r *Router) handlers() []Handler {
+	handlers := make([]Handler, 0, len(r.Routes)+1)
+
+	for i := 0; i <= len(r.Routes); i++ {
+		if h := r.handler(i); h != nil && !containsHandler(handlers, h) {
+			handlers = append(handlers, h)
+		}
+	}
+
+	return handlers
+}
+
+// containsHandler returns true if h is in handlers, so handlers shared by
+// multiple routes are flushed once. Handlers of types which are not comparable,
+// like HandlerFunc, are never found.
+func containsHandler(handlers []Handler, h Handler) bool {
+	t := reflect.TypeOf(h)
+	if !t.Comparable() {
+		return false
+	}
+	for _, x := range handlers {
+		if reflect.TypeOf(x) == t && x == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package stats_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func routerMeasures() []stats.Measure {
+	field := []stats.Field{stats.MakeField("count", 1, stats.Counter)}
+	return []stats.Measure{
+		{Name: "billing.invoices", Fields: field},
+		{Name: "debug.cache", Fields: field},
+		{Name: "http", Fields: field, Tags: []stats.Tag{stats.T("team", "payments")}},
+		{Name: "billing.refunds", Fields: field, Tags: []stats.Tag{stats.T("team", "payments")}},
+		{Name: "http", Fields: field, Tags: []stats.Tag{stats.T("team", "search")}},
+		{Name: "db.queries_total", Fields: field},
+	}
+}
+
+func names(measures []stats.Measure) []string {
+	s := make([]string, len(measures))
+	for i, m := range measures {
+		s[i] = m.Name
+		if len(m.Tags) != 0 {
+			s[i] += "," + m.Tags[0].String()
+		}
+	}
+	return s
+}
+
+func TestRouter(t *testing.T) {
+	influx := &statstest.Handler{}
+	payments := &statstest.Handler{}
+	totals := &statstest.Handler{}
+	def := &statstest.Handler{}
+
+	routes := []stats.Route{
+		{Name: "debug.*"},
+		{Name: "billing.*", Handler: influx},
+		{Tags: []stats.Tag{stats.T("team", "payments")}, Handler: payments},
+		{Regexp: regexp.MustCompile(`_total$`), Handler: totals},
+	}
+
+	t.Run("first-match", func(t *testing.T) {
+		defer influx.Clear()
+		defer payments.Clear()
+		defer totals.Clear()
+		defer def.Clear()
+
+		r := stats.NewRouter(def, routes...)
+		r.HandleMeasures(time.Now(), routerMeasures()...)
+
+		assert.Equal(t, []string{"billing.invoices", "billing.refunds,team=payments"}, names(influx.Measures()))
+		assert.Equal(t, []string{"http,team=payments"}, names(payments.Measures()))
+		assert.Equal(t, []string{"db.queries_total"}, names(totals.Measures()))
+		assert.Equal(t, []string{"http,team=search"}, names(def.Measures()))
+	})
+
+	t.Run("fan-out", func(t *testing.T) {
+		defer influx.Clear()
+		defer payments.Clear()
+		defer totals.Clear()
+		defer def.Clear()
+
+		r := &stats.Router{Routes: routes, Default: def, FanOut: true}
+		r.HandleMeasures(time.Now(), routerMeasures()...)
+
+		assert.Equal(t, []string{"billing.invoices", "billing.refunds,team=payments"}, names(influx.Measures()))
+		assert.Equal(t, []string{"http,team=payments", "billing.refunds,team=payments"}, names(payments.Measures()))
+		assert.Equal(t, []string{"db.queries_total"}, names(totals.Measures()))
+		assert.Equal(t, []string{"http,team=search"}, names(def.Measures()))
+	})
+
+	t.Run("combined-conditions", func(t *testing.T) {
+		defer payments.Clear()
+
+		r := stats.NewRouter(nil, stats.Route{
+			Name:    "billing.*",
+			Tags:    []stats.Tag{stats.T("team", "payments")},
+			Handler: payments,
+		})
+		r.HandleMeasures(time.Now(), routerMeasures()...)
+
+		assert.Equal(t, []string{"billing.refunds,team=payments"}, names(payments.Measures()))
+	})
+}
+
+func TestRouterFlush(t *testing.T) {
+	h1 := &statstest.Handler{}
+	h2 := &statstest.Handler{}
+	def := &statstest.Handler{}
+	calls := 0
+
+	r := stats.NewRouter(def,
+		stats.Route{Name: "a.*", Handler: h1},
+		stats.Route{Name: "b.*", Handler: h2},
+		stats.Route{Name: "c.*", Handler: h1},
+		stats.Route{Name: "d.*", Handler: stats.HandlerFunc(func(time.Time, ...stats.Measure) { calls++ })},
+		stats.Route{Name: "e.*"},
+	)
+	r.Flush()
+
+	assert.Equal(t, 1, h1.FlushCalls(), "handlers shared by routes must be flushed once")
+	assert.Equal(t, 1, h2.FlushCalls())
+	assert.Equal(t, 1, def.FlushCalls())
+	assert.Equal(t, 0, calls)
+}
+
+func TestRouterClose(t *testing.T) {
+	errClose := errors.New("close")
+	c := &closingHandler{err: errClose}
+	def := &statstest.Handler{}
+
+	r := stats.NewRouter(def, stats.Route{Name: "a.*", Handler: c})
+
+	assert.ErrorIs(t, r.Close(), errClose)
+	assert.Equal(t, 1, c.closed)
+	assert.Equal(t, 1, def.FlushCalls())
+}
+
+func BenchmarkRouter(b *testing.B) {
+	r := stats.NewRouter(stats.Discard,
+		stats.Route{Name: "debug.*"},
+		stats.Route{Name: "billing.*", Handler: stats.Discard},
+		stats.Route{Tags: []stats.Tag{stats.T("team", "payments")}, Handler: stats.Discard},
+	)
+	measures := routerMeasures()
+	now := time.Now()
+
+	for b.Loop() {
+		r.HandleMeasures(now, measures...)
+	}
+}
@@ -0,0 +1,211 @@
+package sketch
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultInterval is the default interval at which a Handler forwards the
+	// summaries of the histograms it received.
+	DefaultInterval = 10 * time.Second
+)
+
+// DefaultQuantiles is the list of quantiles forwarded by Handler values that
+// don't configure their own.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Handler is a measure handler which summarizes histograms with sketches over
+// a time window, and forwards their quantiles to another handler.
+//
+// Histograms of a field named "f" are forwarded at the end of each window as
+// the "f.count" and "f.sum" counters, and gauges for each configured quantile
+// and the maximum value, named after the quantile: "f.p50", "f.p90", "f.p99",
+// and "f.max" with the default quantiles. Durations are forwarded as durations.
+//
+// Counters and gauges are forwarded to the handler as-is, as soon as they are
+// received.
+//
+// Histograms are aggregated by a stats.AggregatingHandler, so the limit on the
+// number of series and the "stats.aggregator" measure reporting the state of
+// the windows are the ones documented there.
+//
+// Handler values must not be copied after their first use.
+type Handler struct {
+	// The handler that measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler stats.Handler
+
+	// Length of the windows over which histograms are summarized. If zero,
+	// DefaultInterval is used. When negative, no background flushing is done
+	// and the program is responsible for calling Flush to end the windows.
+	Interval time.Duration
+
+	// Quantiles forwarded for each histogram, in the (0, 1) range. If nil,
+	// DefaultQuantiles is used.
+	Quantiles []float64
+
+	// Relative accuracy of the sketches. If zero, DefaultRelativeAccuracy is
+	// used.
+	RelativeAccuracy float64
+
+	once  sync.Once
+	names []string
+	agg   stats.AggregatingHandler
+}
+
+// NewHandler returns a new Handler which forwards the quantiles of the
+// histograms it receives to handler at the given interval.
+func NewHandler(handler stats.Handler, interval time.Duration) *Handler {
+	return &Handler{
+		Handler:  handler,
+		Interval: interval,
+	}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	h.once.Do(h.init)
+
+	var forward []stats.Measure
+	var histograms []stats.Measure
+
+	for i := range measures {
+		m := &measures[i]
+		n := 0
+
+		for _, f := range m.Fields {
+			if f.Type() == stats.Histogram {
+				n++
+			}
+		}
+
+		switch n {
+		case 0:
+			forward = append(forward, *m)
+		case len(m.Fields):
+			histograms = append(histograms, *m)
+		default:
+			other, hist := *m, *m
+			other.Fields = make([]stats.Field, 0, len(m.Fields)-n)
+			hist.Fields = make([]stats.Field, 0, n)
+			for _, f := range m.Fields {
+				if f.Type() == stats.Histogram {
+					hist.Fields = append(hist.Fields, f)
+				} else {
+					other.Fields = append(other.Fields, f)
+				}
+			}
+			forward = append(forward, other)
+			histograms = append(histograms, hist)
+		}
+	}
+
+	if len(histograms) != 0 {
+		h.agg.HandleMeasures(t, histograms...)
+	}
+
+	if len(forward) != 0 {
+		h.Handler.HandleMeasures(t, forward...)
+	}
+}
+
+// Flush forwards the summaries of the current window to the handler, then
+// flushes it. Flush satisfies the stats.Flusher interface.
+func (h *Handler) Flush() {
+	h.once.Do(h.init)
+	h.agg.Flush()
+}
+
+// Close stops the background flushing of the handler, forwards the last window,
+// then closes the handler it wraps. Close satisfies the stats.Closer interface.
+func (h *Handler) Close() error {
+	h.once.Do(h.init)
+	return h.agg.Close()
+}
+
+func (h *Handler) init() {
+	quantiles := h.quantiles()
+	h.names = make([]string, len(quantiles))
+
+	for i, q := range quantiles {
+		h.names[i] = QuantileName(q)
+	}
+
+	h.agg.Handler = h.Handler
+	h.agg.Interval = h.interval()
+	h.agg.Summarize = func(_ stats.Key, first stats.Value) stats.HistogramSummary {
+		return &summary{
+			duration:  first.Type() == stats.Duration,
+			sketch:    Sketch{RelativeAccuracy: h.RelativeAccuracy},
+			quantiles: quantiles,
+			names:     h.names,
+		}
+	}
+}
+
+func (h *Handler) interval() time.Duration {
+	if h.Interval != 0 {
+		return h.Interval
+	}
+	return DefaultInterval
+}
+
+func (h *Handler) quantiles() []float64 {
+	if h.Quantiles != nil {
+		return h.Quantiles
+	}
+	return DefaultQuantiles
+}
+
+// QuantileName returns the suffix used to name the field of quantile q, for
+// example "p99" for 0.99 or "p999" for 0.999.
+func QuantileName(q float64) string {
+	s := strconv.FormatFloat(q, 'f', -1, 64)
+	s = strings.TrimPrefix(s, "0")
+	s = strings.TrimPrefix(s, ".")
+	if len(s) < 2 {
+		s += strings.Repeat("0", 2-len(s))
+	}
+	return "p" + s
+}
+
+// summary is the stats.HistogramSummary of a histogram field in a window.
+type summary struct {
+	duration  bool
+	sketch    Sketch
+	quantiles []float64
+	names     []string
+}
+
+func (s *summary) Add(x, weight float64) {
+	s.sketch.AddWithCount(x, weight)
+}
+
+func (s *summary) AppendFields(fields []stats.Field, name string) []stats.Field {
+	sk := &s.sketch
+
+	fields = append(fields,
+		stats.MakeField(name+".count", uint64(sk.Count()+0.5), stats.Counter),
+		stats.MakeField(name+".sum", s.value(sk.Sum()), stats.Counter),
+	)
+
+	for i, q := range s.quantiles {
+		fields = append(fields, stats.MakeField(name+"."+s.names[i], s.value(sk.Quantile(q)), stats.Gauge))
+	}
+
+	return append(fields, stats.MakeField(name+".max", s.value(sk.Max()), stats.Gauge))
+}
+
+// value converts v back to the type of the histogram values.
+func (s *summary) value(v float64) stats.Value {
+	if s.duration {
+		return stats.ValueOf(time.Duration(v * float64(time.Second)))
+	}
+	return stats.ValueOf(v)
+}
@@ -0,0 +1,72 @@
+package sketch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestHandler(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	s := &Handler{Handler: h, Interval: -1, Quantiles: []float64{0.5, 0.999}}
+	e := stats.NewEngine("", s)
+
+	for i := 1; i <= 100; i++ {
+		e.Observe("rpc.rtt", time.Duration(i)*time.Millisecond, stats.T("method", "get"))
+	}
+	e.Incr("rpc.count", stats.T("method", "get"))
+
+	// Counters are forwarded immediately.
+	assert.Equal(t, []stats.Measure{{
+		Name:   "rpc",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("method", "get")},
+	}}, h.Measures())
+
+	h.Clear()
+	s.Flush()
+
+	measures := h.Measures()
+	assert.Equal(t, 1, h.FlushCalls())
+	assert.Len(t, measures, 2)
+	assert.Equal(t, "stats.aggregator", measures[1].Name)
+
+	m := measures[0]
+	assert.Equal(t, "rpc", m.Name)
+	assert.Equal(t, []stats.Tag{stats.T("method", "get")}, m.Tags)
+
+	fields := map[string]stats.Value{}
+	for _, f := range m.Fields {
+		fields[f.Name] = f.Value
+	}
+
+	assert.Equal(t, stats.ValueOf(uint64(100)), fields["rtt.count"])
+	assert.InDelta(t, 5050*time.Millisecond, fields["rtt.sum"].Duration(), float64(time.Microsecond))
+	assert.InEpsilon(t, 50*time.Millisecond, fields["rtt.p50"].Duration(), 0.02)
+	assert.InEpsilon(t, 100*time.Millisecond, fields["rtt.p999"].Duration(), 0.02)
+	assert.Equal(t, 100*time.Millisecond, fields["rtt.max"].Duration())
+
+	h.Clear()
+	s.Flush()
+	assert.Empty(t, h.Measures(), "empty windows must not produce measures")
+}
+
+func TestQuantileName(t *testing.T) {
+	for q, name := range map[float64]string{
+		0.5:   "p50",
+		0.9:   "p90",
+		0.99:  "p99",
+		0.999: "p999",
+		0.05:  "p05",
+	} {
+		assert.Equal(t, name, QuantileName(q))
+	}
+}
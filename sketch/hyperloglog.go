@@ -0,0 +1,154 @@
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	// DefaultPrecision is the default precision of HyperLogLog sketches, they
+	// use 4 KiB of memory and estimate cardinalities with a standard error of
+	// about 1.6%.
+	DefaultPrecision = 12
+
+	minPrecision = 4
+	maxPrecision = 16
+)
+
+// HyperLogLog is a sketch estimating the number of distinct values that were
+// added to it, the cardinality of a set, in constant memory. The algorithm is
+// described in http://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf.
+//
+// The zero value is an empty sketch using DefaultPrecision. HyperLogLog values
+// are not safe to use concurrently from multiple goroutines.
+type HyperLogLog struct {
+	// Number of bits of the values used to select the registers of the sketch,
+	// in the [4, 16] range. The sketch uses 2^Precision bytes of memory and the
+	// standard error of the estimates is 1.04/sqrt(2^Precision). If zero,
+	// DefaultPrecision is used.
+	Precision int
+
+	registers []uint8
+}
+
+// NewHyperLogLog returns a new HyperLogLog sketch with the given precision.
+func NewHyperLogLog(precision int) *HyperLogLog {
+	return &HyperLogLog{Precision: precision}
+}
+
+// Add adds the value identified by x to the sketch. Values don't need to be
+// hashes, they are mixed so that sequential values are evenly distributed
+// across the registers.
+func (h *HyperLogLog) Add(x uint64) {
+	h.init()
+
+	p := h.precision()
+	x = mix(x)
+	i := x >> (64 - p)
+	// The bit set after the register index bounds the rank when the other
+	// bits are all zeros.
+	r := uint8(bits.LeadingZeros64(x<<p|1<<(p-1)) + 1)
+
+	if r > h.registers[i] {
+		h.registers[i] = r
+	}
+}
+
+// Merge merges other into h, after which h estimates the cardinality of the
+// union of both sets. The sketches must have the same precision.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	if other.registers == nil {
+		return
+	}
+
+	if h.precision() != other.precision() {
+		panic("sketch: cannot merge HyperLogLog sketches of different precisions")
+	}
+
+	h.init()
+
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct values added to h.
+func (h *HyperLogLog) Estimate() float64 {
+	if h.registers == nil {
+		return 0
+	}
+
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(h.registers)) * m * m / sum
+
+	// Small cardinalities are estimated with linear counting, which is more
+	// accurate while registers are still empty. The hashes being 64 bits wide,
+	// no correction is needed for large cardinalities.
+	if estimate <= 2.5*m && zeros != 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return estimate
+}
+
+// Reset empties the sketch, retaining the memory of its registers.
+func (h *HyperLogLog) Reset() {
+	for i := range h.registers {
+		h.registers[i] = 0
+	}
+}
+
+func (h *HyperLogLog) init() {
+	if h.registers == nil {
+		h.registers = make([]uint8, 1<<h.precision())
+	}
+}
+
+func (h *HyperLogLog) precision() int {
+	switch p := h.Precision; {
+	case p == 0:
+		return DefaultPrecision
+	case p < minPrecision:
+		return minPrecision
+	case p > maxPrecision:
+		return maxPrecision
+	default:
+		return p
+	}
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// mix is the finalizer of the splitmix64 generator, it is a bijection so
+// distinct values remain distinct after being mixed.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
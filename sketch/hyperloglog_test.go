@@ -0,0 +1,69 @@
+package sketch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 1000, 10000, 100000, 1000000} {
+		h := HyperLogLog{}
+
+		// Each value is added twice, duplicates must not be counted.
+		for i := 0; i != n; i++ {
+			h.Add(uint64(i))
+			h.Add(uint64(i))
+		}
+
+		estimate := h.Estimate()
+		if math.Abs(estimate-float64(n)) > 0.05*float64(n)+0.5 {
+			t.Errorf("%d distinct values: bad estimate %g", n, estimate)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a := HyperLogLog{}
+	b := HyperLogLog{}
+
+	for i := 0; i != 20000; i++ {
+		a.Add(uint64(i))
+	}
+	for i := 10000; i != 30000; i++ {
+		b.Add(uint64(i))
+	}
+
+	a.Merge(&b)
+	a.Merge(&HyperLogLog{})
+
+	if estimate := a.Estimate(); math.Abs(estimate-30000) > 0.05*30000 {
+		t.Error("bad estimate of the union:", estimate)
+	}
+
+	a.Reset()
+
+	if estimate := a.Estimate(); estimate != 0 {
+		t.Error("bad estimate after reset:", estimate)
+	}
+}
+
+func TestHyperLogLogMergePrecisionMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("merging sketches of different precisions must panic")
+		}
+	}()
+
+	a := NewHyperLogLog(10)
+	b := NewHyperLogLog(12)
+	b.Add(1)
+	a.Merge(b)
+}
+
+func BenchmarkHyperLogLogAdd(b *testing.B) {
+	h := HyperLogLog{}
+
+	for i := 0; b.Loop(); i++ {
+		h.Add(uint64(i))
+	}
+}
@@ -0,0 +1,296 @@
+// Package sketch implements quantile sketches that summarize the distribution
+// of histogram values with a bounded relative error, and a measure handler
+// which uses them to forward the quantiles of histograms instead of their raw
+// values.
+//
+// The sketches implement the DDSketch algorithm described in
+// https://arxiv.org/abs/1908.10693: values are mapped to logarithmically sized
+// bins, so that every quantile is estimated with an error relative to its
+// value, regardless of the shape of the distribution.
+package sketch
+
+import (
+	"math"
+)
+
+const (
+	// DefaultRelativeAccuracy is the default relative accuracy of sketches.
+	DefaultRelativeAccuracy = 0.01
+
+	// DefaultMaxBins is the default maximum number of bins of a sketch. With
+	// the default relative accuracy, it covers values ranging over about 17
+	// orders of magnitude before the lowest bins get collapsed.
+	DefaultMaxBins = 2048
+
+	// minIndexableValue is the smallest absolute value tracked in the bins,
+	// smaller values are counted as zeros.
+	minIndexableValue = 1e-9
+)
+
+// Sketch is a DDSketch, a summary of the distribution of values which answers
+// quantile queries with a bounded relative error.
+//
+// The zero value is a valid sketch using DefaultRelativeAccuracy and
+// DefaultMaxBins. Sketch values are not safe to use concurrently from multiple
+// goroutines.
+type Sketch struct {
+	// The relative accuracy of the quantiles estimated by the sketch, must be
+	// in the (0, 1) range. If zero, DefaultRelativeAccuracy is used.
+	RelativeAccuracy float64
+
+	// Maximum number of bins used to track positive and negative values. When
+	// the limit is reached, the bins of the smallest values are collapsed,
+	// which degrades the accuracy of the lowest quantiles only. If zero,
+	// DefaultMaxBins is used.
+	MaxBins int
+
+	gamma      float64
+	multiplier float64
+
+	positive store
+	negative store
+	zeros    float64
+
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+// New returns a new sketch with the given relative accuracy.
+func New(relativeAccuracy float64) *Sketch {
+	return &Sketch{RelativeAccuracy: relativeAccuracy}
+}
+
+// Add adds v to the sketch.
+func (s *Sketch) Add(v float64) {
+	s.AddWithCount(v, 1)
+}
+
+// AddWithCount adds v to the sketch, counting it n times. The count may be
+// fractional, which is useful to account for sampled values.
+func (s *Sketch) AddWithCount(v, n float64) {
+	if n <= 0 || math.IsNaN(v) {
+		return
+	}
+
+	s.init()
+
+	switch {
+	case v >= minIndexableValue:
+		s.positive.add(s.index(v), n, s.maxBins())
+	case v <= -minIndexableValue:
+		s.negative.add(s.index(-v), n, s.maxBins())
+	default:
+		s.zeros += n
+	}
+
+	if s.count == 0 {
+		s.min, s.max = v, v
+	} else {
+		s.min = math.Min(s.min, v)
+		s.max = math.Max(s.max, v)
+	}
+
+	s.count += n
+	s.sum += v * n
+}
+
+// Merge adds the values summarized by other to s. Both sketches must have the
+// same relative accuracy.
+func (s *Sketch) Merge(other *Sketch) {
+	if other.count == 0 {
+		return
+	}
+
+	s.init()
+	s.positive.merge(&other.positive, s.maxBins())
+	s.negative.merge(&other.negative, s.maxBins())
+	s.zeros += other.zeros
+
+	if s.count == 0 {
+		s.min, s.max = other.min, other.max
+	} else {
+		s.min = math.Min(s.min, other.min)
+		s.max = math.Max(s.max, other.max)
+	}
+
+	s.count += other.count
+	s.sum += other.sum
+}
+
+// Quantile returns an estimate of the value at quantile q, which must be in
+// the [0, 1] range. The method returns NaN if the sketch is empty.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+
+	switch q {
+	case 0:
+		return s.min
+	case 1:
+		return s.max
+	}
+
+	rank := q * (s.count - 1)
+	var v float64
+
+	if n := s.negative.total(); rank < n {
+		// Negative values are ranked from the largest absolute value down.
+		v = -s.value(s.negative.reverseIndexAt(rank))
+	} else if rank -= n; rank < s.zeros {
+		v = 0
+	} else {
+		v = s.value(s.positive.indexAt(rank - s.zeros))
+	}
+
+	// Bins are centered on their values, clamping to the exact min and max
+	// makes the estimates of extreme quantiles more accurate.
+	return math.Max(s.min, math.Min(s.max, v))
+}
+
+// Count returns the number of values added to the sketch.
+func (s *Sketch) Count() float64 { return s.count }
+
+// Sum returns the sum of the values added to the sketch.
+func (s *Sketch) Sum() float64 { return s.sum }
+
+// Min returns the smallest value added to the sketch, or zero if it is empty.
+func (s *Sketch) Min() float64 { return s.min }
+
+// Max returns the largest value added to the sketch, or zero if it is empty.
+func (s *Sketch) Max() float64 { return s.max }
+
+// Reset empties the sketch, retaining the memory allocated for its bins.
+func (s *Sketch) Reset() {
+	s.positive.reset()
+	s.negative.reset()
+	s.zeros = 0
+	s.count = 0
+	s.sum = 0
+	s.min = 0
+	s.max = 0
+}
+
+func (s *Sketch) init() {
+	if s.gamma == 0 {
+		alpha := s.RelativeAccuracy
+		if alpha <= 0 || alpha >= 1 {
+			alpha = DefaultRelativeAccuracy
+		}
+		s.gamma = (1 + alpha) / (1 - alpha)
+		s.multiplier = 1 / math.Log(s.gamma)
+	}
+}
+
+func (s *Sketch) maxBins() int {
+	if s.MaxBins > 0 {
+		return s.MaxBins
+	}
+	return DefaultMaxBins
+}
+
+// index returns the index of the bin that v falls into, bin i covers values in
+// the (gamma^(i-1), gamma^i] range.
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) * s.multiplier))
+}
+
+// value returns the representative value of bin i, which is within the
+// relative accuracy of any value in the bin.
+func (s *Sketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (1 + s.gamma)
+}
+
+// store is a dense array of bin counts, starting at bin index offset.
+type store struct {
+	bins   []float64
+	offset int
+	count  float64
+}
+
+func (st *store) add(index int, n float64, maxBins int) {
+	st.count += n
+
+	if len(st.bins) == 0 {
+		st.bins = append(st.bins[:0], n)
+		st.offset = index
+		return
+	}
+
+	switch {
+	case index < st.offset:
+		if grow := st.offset - index; len(st.bins)+grow > maxBins {
+			// Collapse the lowest bins: values smaller than the lowest tracked
+			// bin are counted in it.
+			grow = maxBins - len(st.bins)
+			if grow <= 0 {
+				st.bins[0] += n
+				return
+			}
+			index = st.offset - grow
+		}
+		grow := st.offset - index
+		st.bins = append(make([]float64, grow, grow+len(st.bins)), st.bins...)
+		st.offset = index
+
+	case index >= st.offset+len(st.bins):
+		grow := index - (st.offset + len(st.bins)) + 1
+		st.bins = append(st.bins, make([]float64, grow)...)
+
+		if excess := len(st.bins) - maxBins; excess > 0 {
+			var collapsed float64
+			for _, c := range st.bins[:excess+1] {
+				collapsed += c
+			}
+			st.bins = append(st.bins[:0], st.bins[excess:]...)
+			st.bins[0] = collapsed
+			st.offset += excess
+		}
+	}
+
+	st.bins[index-st.offset] += n
+}
+
+func (st *store) merge(other *store, maxBins int) {
+	for i, n := range other.bins {
+		if n != 0 {
+			st.add(other.offset+i, n, maxBins)
+		}
+	}
+}
+
+func (st *store) total() float64 {
+	return st.count
+}
+
+// indexAt returns the index of the bin holding the value of the given rank,
+// counting from the lowest bin.
+func (st *store) indexAt(rank float64) int {
+	var n float64
+	for i, c := range st.bins {
+		if n += c; n > rank {
+			return st.offset + i
+		}
+	}
+	return st.offset + len(st.bins) - 1
+}
+
+// reverseIndexAt returns the index of the bin holding the value of the given
+// rank, counting from the highest bin.
+func (st *store) reverseIndexAt(rank float64) int {
+	var n float64
+	for i := len(st.bins) - 1; i >= 0; i-- {
+		if n += st.bins[i]; n > rank {
+			return st.offset + i
+		}
+	}
+	return st.offset
+}
+
+func (st *store) reset() {
+	st.bins = st.bins[:0]
+	st.offset = 0
+	st.count = 0
+}
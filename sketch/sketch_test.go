@@ -0,0 +1,116 @@
+package sketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSketchQuantiles(t *testing.T) {
+	const alpha = 0.01
+
+	distributions := map[string]func(*rand.Rand) float64{
+		"uniform":     func(r *rand.Rand) float64 { return r.Float64() * 1000 },
+		"exponential": func(r *rand.Rand) float64 { return r.ExpFloat64() },
+		"lognormal":   func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64() * 3) },
+		"mixed signs": func(r *rand.Rand) float64 { return r.NormFloat64() * 100 },
+	}
+
+	for name, dist := range distributions {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			s := New(alpha)
+			values := make([]float64, 10000)
+
+			for i := range values {
+				values[i] = dist(r)
+				s.Add(values[i])
+			}
+
+			sort.Float64s(values)
+
+			for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+				exact := values[int(q*float64(len(values)-1))]
+				estimate := s.Quantile(q)
+
+				if math.Abs(estimate-exact) > alpha*math.Abs(exact)+1e-9 {
+					t.Errorf("quantile %g: expected %g ± %g%%, got %g", q, exact, 100*alpha, estimate)
+				}
+			}
+
+			if s.Count() != float64(len(values)) {
+				t.Errorf("bad count: %g", s.Count())
+			}
+			if s.Min() != values[0] || s.Max() != values[len(values)-1] {
+				t.Errorf("bad min/max: %g/%g", s.Min(), s.Max())
+			}
+		})
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	s1, s2, s3 := &Sketch{}, &Sketch{}, &Sketch{}
+
+	for i := 1; i <= 1000; i++ {
+		s3.Add(float64(i))
+		if i%2 == 0 {
+			s1.Add(float64(i))
+		} else {
+			s2.Add(float64(i))
+		}
+	}
+
+	s1.Merge(s2)
+
+	for _, q := range []float64{0, 0.5, 0.9, 0.99, 1} {
+		if v1, v3 := s1.Quantile(q), s3.Quantile(q); v1 != v3 {
+			t.Errorf("quantile %g: merged sketch returned %g, expected %g", q, v1, v3)
+		}
+	}
+
+	if s1.Sum() != s3.Sum() {
+		t.Errorf("bad sum: %g != %g", s1.Sum(), s3.Sum())
+	}
+}
+
+func TestSketchMaxBins(t *testing.T) {
+	s := &Sketch{MaxBins: 64}
+
+	for i := 0; i != 100; i++ {
+		s.Add(math.Pow(10, float64(i%20)))
+	}
+
+	if n := len(s.positive.bins); n > 64 {
+		t.Errorf("sketch has too many bins: %d", n)
+	}
+
+	// The highest quantiles remain accurate when the lowest bins collapse.
+	if v := s.Quantile(0.99); math.Abs(v-1e19) > 0.01*1e19 {
+		t.Errorf("bad p99: %g", v)
+	}
+}
+
+func TestSketchEmpty(t *testing.T) {
+	s := &Sketch{}
+
+	if v := s.Quantile(0.5); !math.IsNaN(v) {
+		t.Errorf("empty sketch returned %g", v)
+	}
+
+	s.Add(1)
+	s.Reset()
+
+	if v := s.Quantile(0.5); !math.IsNaN(v) {
+		t.Errorf("reset sketch returned %g", v)
+	}
+}
+
+func BenchmarkSketchAdd(b *testing.B) {
+	s := &Sketch{}
+	r := rand.New(rand.NewSource(1))
+
+	for b.Loop() {
+		s.Add(r.ExpFloat64())
+	}
+}
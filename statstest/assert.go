@@ -0,0 +1,58 @@
+package statstest
+
+import (
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// AssertCounter checks that the counters named name and carrying tags that
+// were recorded by h add up to want.
+func AssertCounter(t testing.TB, h *Handler, name string, want float64, tags ...stats.Tag) bool {
+	t.Helper()
+
+	metrics := h.Select(name, tags...)
+	if len(metrics) == 0 {
+		t.Errorf("statstest: no counter named %q with tags %v", name, tags)
+		return false
+	}
+
+	if sum := metrics.Sum(); sum != want {
+		t.Errorf("statstest: counter %q with tags %v: got %v, want %v", name, tags, sum, want)
+		return false
+	}
+
+	return true
+}
+
+// AssertGauge checks that the last value of the gauges named name and carrying
+// tags that were recorded by h is want.
+func AssertGauge(t testing.TB, h *Handler, name string, want float64, tags ...stats.Tag) bool {
+	t.Helper()
+
+	last, ok := h.Select(name, tags...).Last()
+	if !ok {
+		t.Errorf("statstest: no gauge named %q with tags %v", name, tags)
+		return false
+	}
+
+	if last != want {
+		t.Errorf("statstest: gauge %q with tags %v: got %v, want %v", name, tags, last, want)
+		return false
+	}
+
+	return true
+}
+
+// AssertObservations checks that want values were observed on the histograms
+// named name and carrying tags that were recorded by h.
+func AssertObservations(t testing.TB, h *Handler, name string, want int, tags ...stats.Tag) bool {
+	t.Helper()
+
+	if n := h.Select(name, tags...).Observations(); n != want {
+		t.Errorf("statstest: histogram %q with tags %v: got %d observations, want %d", name, tags, n, want)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package statstest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock which only moves when told to, for tests that measure
+// durations. Its Now method can be assigned to the Now field of a
+// stats.Engine so the durations reported by the engine are deterministic.
+//
+// The zero value starts at the zero time. Clocks are safe to use concurrently
+// from multiple goroutines.
+type Clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewClock returns a new clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Add moves the clock forward by d, and returns the new time.
+func (c *Clock) Add(d time.Duration) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set sets the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mutex.Lock()
+	c.now = now
+	c.mutex.Unlock()
+}
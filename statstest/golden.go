@@ -0,0 +1,112 @@
+package statstest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// UpdateGolden is true when AssertGolden overwrites the golden files instead
+// of comparing them, which is enabled by setting the STATSTEST_UPDATE
+// environment variable to a non-empty value.
+var UpdateGolden = os.Getenv("STATSTEST_UPDATE") != ""
+
+// Format returns a text representation of measures, with one line per metric
+// in the form:
+//
+//	name{tag=value,...} type value
+//
+// Sampled metrics are followed by "@" and their sample rate. The tags of each
+// metric are sorted, and so are the lines, so the representation doesn't
+// depend on the order in which the measures were produced.
+func Format(measures ...stats.Measure) string {
+	metrics := MetricsOf(measures...)
+	lines := make([]string, len(metrics))
+
+	for i, m := range metrics {
+		lines[i] = formatMetric(m)
+	}
+
+	slices.Sort(lines)
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func formatMetric(m Metric) string {
+	tags := slices.Clone(m.Tags)
+	slices.SortStableFunc(tags, func(a, b stats.Tag) int { return strings.Compare(a.Name, b.Name) })
+
+	b := []byte(m.Name)
+	if len(tags) != 0 {
+		b = append(b, '{')
+		for i, t := range tags {
+			if i != 0 {
+				b = append(b, ',')
+			}
+			b = append(b, t.Name...)
+			b = append(b, '=')
+			b = append(b, t.Value...)
+		}
+		b = append(b, '}')
+	}
+
+	b = append(b, ' ')
+	b = append(b, m.Type.String()...)
+	b = append(b, ' ')
+	b = append(b, m.Value.String()...)
+
+	if m.SampleRate > 0 && m.SampleRate < 1 {
+		b = append(b, " @"...)
+		b = strconv.AppendFloat(b, m.SampleRate, 'g', -1, 64)
+	}
+
+	return string(b)
+}
+
+// AssertGolden checks that the measures recorded by h match the content of the
+// golden file at path, in the format returned by Format. When UpdateGolden is
+// true, the file is written with the recorded measures instead.
+func AssertGolden(t testing.TB, h *Handler, path string) bool {
+	t.Helper()
+
+	got := Format(h.Measures()...)
+
+	if UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("statstest: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("statstest: %s", err)
+		}
+		return true
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("statstest: golden file %s does not exist, set STATSTEST_UPDATE=1 to create it", path)
+		} else {
+			t.Errorf("statstest: %s", err)
+		}
+		return false
+	}
+
+	if got != string(want) {
+		t.Errorf("statstest: measures don't match golden file %s\n--- got:\n%s--- want:\n%s", path, got, want)
+		return false
+	}
+
+	return true
+}
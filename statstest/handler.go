@@ -54,3 +54,14 @@ func (h *Handler) Clear() {
 	h.measures = h.measures[:0]
 	h.Unlock()
 }
+
+// Metrics returns the metrics made of the fields of the handled measures.
+func (h *Handler) Metrics() Metrics {
+	return MetricsOf(h.Measures()...)
+}
+
+// Select returns the handled metrics named name which carry all the given
+// tags.
+func (h *Handler) Select(name string, tags ...stats.Tag) Metrics {
+	return h.Metrics().Select(name, tags...)
+}
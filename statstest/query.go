@@ -0,0 +1,151 @@
+package statstest
+
+import (
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Metric is a single field of a measure. Its name is the name of the measure
+// and the name of the field joined by a dot, which is the name that was passed
+// to the engine methods like Incr or Observe.
+type Metric struct {
+	Name       string
+	Type       stats.FieldType
+	Value      stats.Value
+	Tags       []stats.Tag
+	SampleRate float64
+}
+
+// Float returns the value of m as a float64, durations are expressed in
+// seconds.
+func (m Metric) Float() float64 {
+	switch v := m.Value; v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return 1
+		}
+	case stats.Int:
+		return float64(v.Int())
+	case stats.Uint:
+		return float64(v.Uint())
+	case stats.Float:
+		return v.Float()
+	case stats.Duration:
+		return v.Duration().Seconds()
+	}
+	return 0
+}
+
+// HasTags returns true if m carries all the given tags, with the same values.
+func (m Metric) HasTags(tags ...stats.Tag) bool {
+	for _, t := range tags {
+		if !hasTag(m.Tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(tags []stats.Tag, tag stats.Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Metrics is a list of metrics, in the order that their measures were handled.
+type Metrics []Metric
+
+// MetricsOf splits measures into the metrics made of each of their fields.
+func MetricsOf(measures ...stats.Measure) Metrics {
+	var metrics Metrics
+
+	for _, m := range measures {
+		for _, f := range m.Fields {
+			metrics = append(metrics, Metric{
+				Name:       metricName(m.Name, f.Name),
+				Type:       f.Type(),
+				Value:      stats.ValueOf(f.Value.Interface()),
+				Tags:       m.Tags,
+				SampleRate: m.SampleRate,
+			})
+		}
+	}
+
+	return metrics
+}
+
+func metricName(measure, field string) string {
+	switch {
+	case measure == "":
+		return field
+	case field == "":
+		return measure
+	default:
+		return measure + "." + field
+	}
+}
+
+// Select returns the metrics named name which carry all the given tags. They
+// may carry other tags as well.
+func (metrics Metrics) Select(name string, tags ...stats.Tag) Metrics {
+	var selected Metrics
+
+	for _, m := range metrics {
+		if m.Name == name && m.HasTags(tags...) {
+			selected = append(selected, m)
+		}
+	}
+
+	return selected
+}
+
+// Sum returns the sum of the values of the counters in metrics. Sample rates
+// are ignored.
+func (metrics Metrics) Sum() float64 {
+	sum := 0.0
+	for _, m := range metrics {
+		if m.Type == stats.Counter {
+			sum += m.Float()
+		}
+	}
+	return sum
+}
+
+// Last returns the value of the last gauge in metrics, and false if there are
+// none.
+func (metrics Metrics) Last() (float64, bool) {
+	for i := len(metrics) - 1; i >= 0; i-- {
+		if metrics[i].Type == stats.Gauge {
+			return metrics[i].Float(), true
+		}
+	}
+	return 0, false
+}
+
+// Observations returns the number of values observed on the histograms in
+// metrics. Sample rates are ignored.
+func (metrics Metrics) Observations() int {
+	n := 0
+	for _, m := range metrics {
+		if m.Type == stats.Histogram {
+			n++
+		}
+	}
+	return n
+}
+
+// Durations returns the values of the histograms in metrics holding durations,
+// like the ones produced by a stats.Clock.
+func (metrics Metrics) Durations() []time.Duration {
+	var durations []time.Duration
+	for _, m := range metrics {
+		if m.Type == stats.Histogram && m.Value.Type() == stats.Duration {
+			durations = append(durations, m.Value.Duration())
+		}
+	}
+	return durations
+}
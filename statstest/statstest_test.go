@@ -0,0 +1,155 @@
+package statstest_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestSelect(t *testing.T) {
+	h := &statstest.Handler{}
+	eng := stats.NewEngine("app", h, stats.T("service", "api"))
+
+	eng.Incr("requests.count", stats.T("code", "200"))
+	eng.Add("requests.count", 2, stats.T("code", "500"))
+	eng.Incr("requests.count", stats.T("code", "200"))
+	eng.Set("queue.size", 4)
+	eng.Set("queue.size", 2)
+	eng.Observe("requests.rtt", time.Second)
+
+	assert.Len(t, h.Select("app.requests.count"), 3)
+	assert.Len(t, h.Select("app.requests.count", stats.T("code", "200"), stats.T("service", "api")), 2)
+	assert.Empty(t, h.Select("app.requests.count", stats.T("code", "404")))
+
+	assert.Equal(t, 4.0, h.Select("app.requests.count").Sum())
+	last, ok := h.Select("app.queue.size").Last()
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, last)
+	assert.Equal(t, 1, h.Select("app.requests.rtt").Observations())
+	assert.Equal(t, []time.Duration{time.Second}, h.Select("app.requests.rtt").Durations())
+}
+
+// recorder captures the errors reported by the assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	h := &statstest.Handler{}
+	eng := stats.NewEngine("", h)
+
+	eng.Add("hits", 3, stats.T("cache", "a"))
+	eng.Add("hits", 2, stats.T("cache", "b"))
+	eng.Set("entries", 10)
+	eng.Observe("lookup", 0.5)
+	eng.Observe("lookup", 0.7)
+
+	r := &recorder{TB: t}
+	assert.True(t, statstest.AssertCounter(r, h, "hits", 5))
+	assert.True(t, statstest.AssertCounter(r, h, "hits", 3, stats.T("cache", "a")))
+	assert.True(t, statstest.AssertGauge(r, h, "entries", 10))
+	assert.True(t, statstest.AssertObservations(r, h, "lookup", 2))
+	assert.Empty(t, r.errors)
+
+	assert.False(t, statstest.AssertCounter(r, h, "hits", 4))
+	assert.False(t, statstest.AssertCounter(r, h, "misses", 0))
+	assert.False(t, statstest.AssertGauge(r, h, "hits", 5))
+	assert.False(t, statstest.AssertObservations(r, h, "lookup", 1))
+	assert.Equal(t, []string{
+		`statstest: counter "hits" with tags []: got 5, want 4`,
+		`statstest: no counter named "misses" with tags []`,
+		`statstest: no gauge named "hits" with tags []`,
+		`statstest: histogram "lookup" with tags []: got 2 observations, want 1`,
+	}, r.errors)
+}
+
+func TestFormat(t *testing.T) {
+	measures := []stats.Measure{
+		{
+			Name:   "http",
+			Fields: []stats.Field{stats.MakeField("requests", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "GET"), stats.T("code", "200")},
+		},
+		{
+			Name:       "http",
+			Fields:     []stats.Field{stats.MakeField("rtt", 150*time.Millisecond, stats.Histogram)},
+			SampleRate: 0.5,
+		},
+		{
+			Name:   "",
+			Fields: []stats.Field{stats.MakeField("up", true, stats.Gauge)},
+		},
+	}
+
+	assert.Equal(t, `http.requests{code=200,method=GET} counter 1
+http.rtt histogram 150ms @0.5
+up gauge true
+`, statstest.Format(measures...))
+}
+
+func TestAssertGolden(t *testing.T) {
+	h := &statstest.Handler{}
+	eng := statstest.Swap(t, h)
+	eng.Prefix = "app"
+	eng.Tags = []stats.Tag{stats.T("env", "test")}
+
+	eng.Incr("jobs.done", stats.T("queue", "default"))
+	eng.Set("jobs.pending", 12)
+	eng.Observe("jobs.time", 2*time.Second)
+
+	if !statstest.AssertGolden(t, h, filepath.Join("testdata", "jobs.golden")) || statstest.UpdateGolden {
+		return
+	}
+
+	r := &recorder{TB: t}
+	eng.Incr("jobs.done")
+	assert.False(t, statstest.AssertGolden(r, h, filepath.Join("testdata", "jobs.golden")))
+	assert.Len(t, r.errors, 1)
+}
+
+func TestSwap(t *testing.T) {
+	prev := stats.DefaultEngine
+	h := &statstest.Handler{}
+
+	t.Run("swap", func(t *testing.T) {
+		statstest.Swap(t, h)
+		stats.Incr("logins", stats.T("user", "luke"))
+	})
+
+	assert.Same(t, prev, stats.DefaultEngine, "the default engine must be restored")
+	assert.Equal(t, 1.0, h.Select("logins", stats.T("user", "luke")).Sum())
+	assert.Len(t, h.Measures(), 1, "the swapped engine must not report the versions")
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := statstest.NewClock(start)
+	h := &statstest.Handler{}
+	eng := stats.NewEngine("", h)
+	eng.Now = clock.Now
+
+	c := eng.WithTags(stats.T("step", "all")).Clock("work")
+	clock.Add(time.Second)
+	c.Stamp("read")
+	clock.Add(2 * time.Second)
+	c.Stamp("write")
+	c.Stop()
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, h.Select("work").Durations())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+}
@@ -0,0 +1,35 @@
+package statstest
+
+import (
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Swap replaces stats.DefaultEngine with a new engine forwarding measures to
+// handler, and restores the original engine when the test completes. It
+// returns the new engine, so the test can set its Now field for example.
+//
+// The new engine has no prefix and no tags, so the metrics produced by the
+// global functions of the stats package are named as the program names them.
+// It does not report the stats_version and go_version measures either, so the
+// measures recorded by handler don't depend on the version of Go.
+//
+// Tests calling Swap must not run in parallel with other tests using the
+// default engine.
+func Swap(t testing.TB, handler stats.Handler) *stats.Engine {
+	t.Helper()
+
+	// The versions are reported once per engine, before its first measure.
+	// Reporting an empty set of metrics while the engine discards measures
+	// uses up that report, then the engine is connected to handler.
+	eng := stats.NewEngine("", stats.Discard)
+	eng.Report(struct{}{})
+	eng.Handler = handler
+
+	prev := stats.DefaultEngine
+	stats.DefaultEngine = eng
+
+	t.Cleanup(func() { stats.DefaultEngine = prev })
+	return eng
+}
@@ -0,0 +1,130 @@
+package stats
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"weak"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// TagSet is an immutable set of tags, sorted and deduplicated like SortTags
+// does, and hashed once when the set is created.
+//
+// Tag sets are interned: creating a set of tags equal to a set that is still
+// referenced by the program returns the same set, so their tags share the same
+// memory and comparing them is cheap. Sets that are not referenced anymore are
+// reclaimed by the garbage collector.
+//
+// The zero value is an empty set.
+type TagSet struct {
+	set *tagSet
+}
+
+type tagSet struct {
+	tags []Tag
+	hash uint64
+}
+
+// NewTagSet returns the set of the given tags. The tags are copied, so the
+// program may reuse the slice after the call.
+func NewTagSet(tags ...Tag) TagSet {
+	if len(tags) == 0 {
+		return TagSet{}
+	}
+
+	tags = SortTags(copyTags(tags))
+	// Trim the capacity so appending to the tags of the set never writes to
+	// the interned memory.
+	tags = tags[:len(tags):len(tags)]
+	return TagSet{set: internTagSet(tags, HashTags(tags))}
+}
+
+// Tags returns the tags of the set, the returned slice must not be modified.
+func (s TagSet) Tags() []Tag {
+	if s.set == nil {
+		return nil
+	}
+	return s.set.tags
+}
+
+// Len returns the number of tags in the set.
+func (s TagSet) Len() int {
+	return len(s.Tags())
+}
+
+// Hash returns the hash of the tags in the set, it is equal to the value that
+// HashTags returns for the same tags.
+func (s TagSet) Hash() uint64 {
+	if s.set == nil {
+		return HashTags(nil)
+	}
+	return s.set.hash
+}
+
+// Equal returns true if s and other contain the same tags.
+func (s TagSet) Equal(other TagSet) bool {
+	return s.set == other.set || (s.Len() == 0 && other.Len() == 0)
+}
+
+func (s TagSet) String() string {
+	return "[" + strings.Join(stringTags(s.Tags()), ", ") + "]"
+}
+
+// HashTags returns a hash of tags, which are expected to be sorted. Handlers use
+// it to identify series of measures that don't carry a TagSet.
+func HashTags(tags []Tag) uint64 {
+	h := jody.Init64
+
+	for i := range tags {
+		h = jody.AddString64(h, tags[i].Name)
+		h = jody.AddString64(h, tags[i].Value)
+	}
+
+	return h
+}
+
+// The table of interned tag sets, indexed by hash. The sets are referenced by
+// weak pointers so they are reclaimed when the program stops using them.
+var tagSets struct {
+	mutex sync.Mutex
+	table map[uint64][]weak.Pointer[tagSet]
+}
+
+func internTagSet(tags []Tag, hash uint64) *tagSet {
+	tagSets.mutex.Lock()
+	defer tagSets.mutex.Unlock()
+
+	for _, p := range tagSets.table[hash] {
+		if s := p.Value(); s != nil && slices.Equal(s.tags, tags) {
+			return s
+		}
+	}
+
+	if tagSets.table == nil {
+		tagSets.table = make(map[uint64][]weak.Pointer[tagSet])
+	}
+
+	s := &tagSet{tags: tags, hash: hash}
+	tagSets.table[hash] = append(tagSets.table[hash], weak.Make(s))
+	runtime.AddCleanup(s, releaseTagSets, hash)
+	return s
+}
+
+// releaseTagSets removes the reclaimed sets from the table entry of hash.
+func releaseTagSets(hash uint64) {
+	tagSets.mutex.Lock()
+	defer tagSets.mutex.Unlock()
+
+	live := slices.DeleteFunc(tagSets.table[hash], func(p weak.Pointer[tagSet]) bool {
+		return p.Value() == nil
+	})
+
+	if len(live) == 0 {
+		delete(tagSets.table, hash)
+	} else {
+		tagSets.table[hash] = live
+	}
+}
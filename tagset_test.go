@@ -0,0 +1,75 @@
+package stats_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestTagSet(t *testing.T) {
+	s1 := stats.NewTagSet(stats.T("b", "2"), stats.T("a", "1"), stats.T("b", "3"))
+	s2 := stats.NewTagSet(stats.T("a", "1"), stats.T("b", "3"))
+	s3 := stats.NewTagSet(stats.T("a", "1"))
+
+	assert.Equal(t, []stats.Tag{stats.T("a", "1"), stats.T("b", "3")}, s1.Tags())
+	assert.Equal(t, 2, s1.Len())
+	assert.Equal(t, "[a=1, b=3]", s1.String())
+	assert.Equal(t, stats.HashTags(s1.Tags()), s1.Hash())
+
+	assert.True(t, s1.Equal(s2))
+	assert.False(t, s1.Equal(s3))
+	assert.True(t, stats.TagSet{}.Equal(stats.NewTagSet()))
+	assert.Equal(t, stats.HashTags(nil), stats.TagSet{}.Hash())
+
+	// Equal sets are interned, they share their tags.
+	assert.Same(t, &s1.Tags()[0], &s2.Tags()[0])
+}
+
+func TestTagSetCopiesTags(t *testing.T) {
+	tags := []stats.Tag{stats.T("a", "1")}
+	s := stats.NewTagSet(tags...)
+	tags[0].Value = "2"
+
+	assert.Equal(t, []stats.Tag{stats.T("a", "1")}, s.Tags())
+	// The capacity of the tags is trimmed so appending copies them.
+	assert.Equal(t, len(s.Tags()), cap(s.Tags()))
+}
+
+func TestMeasureTagSet(t *testing.T) {
+	s := stats.NewTagSet(stats.T("a", "1"), stats.T("b", "2"))
+	m := stats.Measure{Name: "m", Tags: s.Tags(), TagSet: s}
+
+	set, ok := m.ValidTagSet()
+	assert.True(t, ok)
+	assert.True(t, set.Equal(s))
+	assert.Equal(t, s.Hash(), m.TagsHash())
+
+	c := m.Clone()
+	_, ok = c.ValidTagSet()
+	assert.True(t, ok, "clones must retain the tag set")
+
+	// Replacing the tags of a measure invalidates its tag set.
+	m.Tags = []stats.Tag{stats.T("a", "1")}
+	_, ok = m.ValidTagSet()
+	assert.False(t, ok)
+	assert.Equal(t, stats.HashTags(m.Tags), m.TagsHash())
+
+	m.Tags = []stats.Tag{stats.T("a", "1"), stats.T("b", "2")}
+	_, ok = m.ValidTagSet()
+	assert.False(t, ok, "tags equal to the set but not shared with it must not use the set")
+}
+
+func BenchmarkNewTagSet(b *testing.B) {
+	tags := []stats.Tag{
+		stats.T("service", "api"),
+		stats.T("host", "web-1234"),
+		stats.T("cluster", "production"),
+		stats.T("status", "200"),
+	}
+
+	for b.Loop() {
+		stats.NewTagSet(tags...)
+	}
+}
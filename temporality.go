@@ -0,0 +1,313 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSeriesExpiration is the default amount of time after which the
+// CumulativeToDelta and DeltaToCumulative handlers forget the series that they
+// have not seen.
+const DefaultSeriesExpiration = 10 * time.Minute
+
+// CumulativeToDelta is a measure handler which converts the values of counter
+// fields from running totals to the difference with the previous value of the
+// same series, before forwarding the measures to another handler.
+//
+// It is intended for sources which report totals on counter fields, like the
+// procstats package or structs passed to Engine.Report, feeding handlers which
+// add up the counter values they receive, like the datadog client.
+//
+// Series are identified by the measure name, the field name, and the tags.
+// The first value of a series is the baseline that the next values are
+// compared to, so its field is not forwarded (measures left without fields
+// are dropped). A value lower than the previous one is a counter reset, for
+// example after the source restarted, in which case the value itself is
+// forwarded as the delta. The measures are forwarded unsampled, since the
+// deltas of totals are not scaled by sample rates. Fields of other types are
+// forwarded unchanged.
+//
+// Series expire based on the time that measures are passed with, or the
+// current time if it is zero.
+type CumulativeToDelta struct {
+	// The handler that measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler Handler
+
+	// Amount of time after which series that were not seen are forgotten, the
+	// next value of the series is a new baseline. If zero,
+	// DefaultSeriesExpiration is used.
+	Expiration time.Duration
+
+	series seriesTable
+}
+
+// NewCumulativeToDelta returns a new CumulativeToDelta handler forwarding
+// measures to handler.
+func NewCumulativeToDelta(handler Handler) *CumulativeToDelta {
+	return &CumulativeToDelta{Handler: handler}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *CumulativeToDelta) HandleMeasures(t time.Time, measures ...Measure) {
+	measures = h.series.convert(seriesTime(t), expiration(h.Expiration), false, measures, func(s *series, v Value) (Value, bool) {
+		prev, ok := s.value, s.ok
+		s.value, s.ok = v, true
+
+		switch {
+		case !ok:
+			return Value{}, false
+		case valueLess(v, prev):
+			return v, true
+		default:
+			return valueSub(v, prev), true
+		}
+	})
+
+	if len(measures) != 0 {
+		h.Handler.HandleMeasures(t, measures...)
+	}
+}
+
+// Flush satisfies the Flusher interface.
+func (h *CumulativeToDelta) Flush() {
+	flush(h.Handler)
+}
+
+// Close closes the handler (or flushes it if it doesn't implement Closer),
+// satisfies the Closer interface.
+func (h *CumulativeToDelta) Close() error {
+	return closeHandler(h.Handler)
+}
+
+// DeltaToCumulative is a measure handler which converts the values of counter
+// fields to the running totals of their series, before forwarding the
+// measures to another handler.
+//
+// It is intended for sources which report increments on counter fields, like
+// Engine.Incr or Engine.Add, feeding handlers which expect counter values to
+// be totals.
+//
+// Series are identified by the measure name, the field name, and the tags.
+// Sampled counter values are scaled by the inverse of the sample rate before
+// being added to the total, and the measures are forwarded unsampled. A
+// series which expired starts from zero again, which consumers of totals
+// handle as a counter reset. Fields of other types are forwarded unchanged.
+//
+// Series expire based on the time that measures are passed with, or the
+// current time if it is zero.
+type DeltaToCumulative struct {
+	// The handler that measures are forwarded to.
+	//
+	// This field cannot be nil.
+	Handler Handler
+
+	// Amount of time after which series that were not seen are forgotten, and
+	// their totals reset to zero. If zero, DefaultSeriesExpiration is used.
+	Expiration time.Duration
+
+	series seriesTable
+}
+
+// NewDeltaToCumulative returns a new DeltaToCumulative handler forwarding
+// measures to handler.
+func NewDeltaToCumulative(handler Handler) *DeltaToCumulative {
+	return &DeltaToCumulative{Handler: handler}
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *DeltaToCumulative) HandleMeasures(t time.Time, measures ...Measure) {
+	measures = h.series.convert(seriesTime(t), expiration(h.Expiration), true, measures, func(s *series, v Value) (Value, bool) {
+		s.value = addValues(s.value, v)
+		return s.value, true
+	})
+
+	if len(measures) != 0 {
+		h.Handler.HandleMeasures(t, measures...)
+	}
+}
+
+// Flush satisfies the Flusher interface.
+func (h *DeltaToCumulative) Flush() {
+	flush(h.Handler)
+}
+
+// Close closes the handler (or flushes it if it doesn't implement Closer),
+// satisfies the Closer interface.
+func (h *DeltaToCumulative) Close() error {
+	return closeHandler(h.Handler)
+}
+
+func expiration(d time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return DefaultSeriesExpiration
+}
+
+func seriesTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+type seriesKey struct {
+	measure string
+	field   string
+	tags    uint64
+}
+
+type series struct {
+	value Value
+	ok    bool
+	seen  time.Time
+}
+
+// seriesTable holds the state of the series converted by the CumulativeToDelta
+// and DeltaToCumulative handlers.
+type seriesTable struct {
+	mutex     sync.Mutex
+	series    map[seriesKey]*series
+	cleanTime time.Time
+}
+
+// convert returns measures with the values of counter fields replaced by the
+// results of fn, which is called with the state of their series. Fields for
+// which fn returns false are removed, as well as the measures left without
+// fields. Measures with counter fields are returned unsampled, and when
+// unsample is true, their values are first scaled by the inverse of their
+// sample rate. The input measures are not modified.
+func (table *seriesTable) convert(now time.Time, expiration time.Duration, unsample bool, measures []Measure, fn func(*series, Value) (Value, bool)) []Measure {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if table.series == nil {
+		table.series = make(map[seriesKey]*series)
+		table.cleanTime = now
+	}
+
+	if now.Sub(table.cleanTime) >= expiration {
+		table.clean(now.Add(-expiration))
+		table.cleanTime = now
+	}
+
+	converted := make([]Measure, 0, len(measures))
+
+	for i := range measures {
+		m := &measures[i]
+
+		if !hasCounter(m.Fields) {
+			converted = append(converted, *m)
+			continue
+		}
+
+		c := *m
+		c.Fields = make([]Field, 0, len(m.Fields))
+		c.SampleRate = 0
+		tags := seriesTagsHash(m)
+
+		for _, f := range m.Fields {
+			if f.Type() != Counter {
+				c.Fields = append(c.Fields, f)
+				continue
+			}
+
+			v := f.Value
+			if unsample && m.Sampled() {
+				v = unsampleValue(v, m.SampleRate)
+			}
+
+			key := seriesKey{measure: m.Name, field: f.Name, tags: tags}
+			s := table.series[key]
+			if s == nil {
+				s = &series{}
+				table.series[key] = s
+			}
+			s.seen = now
+
+			if v, ok := fn(s, v); ok {
+				c.Fields = append(c.Fields, Field{Name: f.Name, Value: v})
+			}
+		}
+
+		if len(c.Fields) != 0 {
+			converted = append(converted, c)
+		}
+	}
+
+	return converted
+}
+
+// clean removes the series which were not seen since the given time.
+func (table *seriesTable) clean(since time.Time) {
+	for key, s := range table.series {
+		if s.seen.Before(since) {
+			delete(table.series, key)
+		}
+	}
+}
+
+func hasCounter(fields []Field) bool {
+	for _, f := range fields {
+		if f.Type() == Counter {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesTagsHash returns the hash of the tags of m, independently of their
+// order.
+func seriesTagsHash(m *Measure) uint64 {
+	if _, ok := m.ValidTagSet(); ok || TagsAreSorted(m.Tags) {
+		return m.TagsHash()
+	}
+	return HashTags(SortTags(copyTags(m.Tags)))
+}
+
+// unsampleValue returns v scaled by the inverse of rate. Durations keep their
+// type, other values are converted to floats.
+func unsampleValue(v Value, rate float64) Value {
+	if v.Type() == Duration {
+		return ValueOf(time.Duration(float64(v.Duration()) / rate))
+	}
+	return ValueOf(valueFloat(v) / rate)
+}
+
+// valueLess returns true if a is less than b. Values of different types are
+// compared as floats.
+func valueLess(a, b Value) bool {
+	if a.Type() != b.Type() {
+		return valueFloat(a) < valueFloat(b)
+	}
+	switch a.Type() {
+	case Int:
+		return a.Int() < b.Int()
+	case Uint:
+		return a.Uint() < b.Uint()
+	case Duration:
+		return a.Duration() < b.Duration()
+	default:
+		return a.Float() < b.Float()
+	}
+}
+
+// valueSub returns a-b, with the type of a. Values of different types are
+// subtracted as floats.
+func valueSub(a, b Value) Value {
+	if a.Type() != b.Type() {
+		return ValueOf(valueFloat(a) - valueFloat(b))
+	}
+	switch a.Type() {
+	case Int:
+		return ValueOf(a.Int() - b.Int())
+	case Uint:
+		return ValueOf(a.Uint() - b.Uint())
+	case Duration:
+		return ValueOf(a.Duration() - b.Duration())
+	default:
+		return ValueOf(valueFloat(a) - valueFloat(b))
+	}
+}
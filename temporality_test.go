@@ -0,0 +1,185 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func counter(name string, value interface{}, tags ...stats.Tag) stats.Measure {
+	return stats.Measure{
+		Name:   name,
+		Fields: []stats.Field{stats.MakeField("count", value, stats.Counter)},
+		Tags:   tags,
+	}
+}
+
+func counterValues(measures []stats.Measure) []interface{} {
+	values := make([]interface{}, 0, len(measures))
+	for _, m := range measures {
+		for _, f := range m.Fields {
+			if f.Type() == stats.Counter {
+				values = append(values, f.Value.Interface())
+			}
+		}
+	}
+	return values
+}
+
+func TestCumulativeToDelta(t *testing.T) {
+	t.Run("deltas", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCumulativeToDelta(h)
+
+		for _, v := range []int{10, 15, 15, 22} {
+			c.HandleMeasures(time.Now(), counter("gc", v))
+		}
+
+		assert.Equal(t, []interface{}{int64(5), int64(0), int64(7)}, counterValues(h.Measures()))
+	})
+
+	t.Run("counter resets", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCumulativeToDelta(h)
+
+		for _, v := range []uint64{100, 120, 4, 10} {
+			c.HandleMeasures(time.Now(), counter("gc", v))
+		}
+
+		assert.Equal(t, []interface{}{uint64(20), uint64(4), uint64(6)}, counterValues(h.Measures()))
+	})
+
+	t.Run("series are keyed by name and tags", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCumulativeToDelta(h)
+		a, b := stats.T("a", "1"), stats.T("b", "2")
+
+		c.HandleMeasures(time.Now(), counter("x", 1, a, b), counter("x", 10), counter("y", 100, a, b))
+		c.HandleMeasures(time.Now(), counter("x", 2, b, a), counter("x", 20), counter("y", 200, a, b))
+
+		assert.Equal(t, []stats.Measure{
+			counter("x", int64(1), b, a),
+			counter("x", int64(10)),
+			counter("y", int64(100), a, b),
+		}, h.Measures())
+	})
+
+	t.Run("other fields are forwarded", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCumulativeToDelta(h)
+		m := func(total, size int) stats.Measure {
+			return stats.Measure{Name: "mem", Fields: []stats.Field{
+				stats.MakeField("total", total, stats.Counter),
+				stats.MakeField("size", size, stats.Gauge),
+			}}
+		}
+
+		c.HandleMeasures(time.Now(), m(10, 1))
+		c.HandleMeasures(time.Now(), m(30, 2))
+
+		assert.Equal(t, []stats.Measure{
+			{Name: "mem", Fields: []stats.Field{stats.MakeField("size", 1, stats.Gauge)}},
+			{Name: "mem", Fields: []stats.Field{
+				stats.MakeField("total", 20, stats.Counter),
+				stats.MakeField("size", 2, stats.Gauge),
+			}},
+		}, h.Measures())
+	})
+
+	t.Run("idle series expire", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := &stats.CumulativeToDelta{Handler: h, Expiration: 20 * time.Second}
+		now := time.Now()
+
+		c.HandleMeasures(now, counter("gc", 10))
+		c.HandleMeasures(now.Add(time.Minute), counter("other", 1))
+		c.HandleMeasures(now.Add(time.Minute), counter("gc", 12))
+
+		assert.Empty(t, h.Measures(), "the expired series must start from a new baseline")
+	})
+
+	t.Run("sampled measures are forwarded unsampled", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewCumulativeToDelta(h)
+		m := counter("gc", 10)
+		m.SampleRate = 0.5
+
+		c.HandleMeasures(time.Time{}, m)
+		m.Fields[0] = stats.MakeField("count", 15, stats.Counter)
+		c.HandleMeasures(time.Time{}, m)
+
+		measures := h.Measures()
+		assert.Equal(t, []interface{}{int64(5)}, counterValues(measures))
+		assert.False(t, measures[0].Sampled())
+	})
+}
+
+func TestDeltaToCumulative(t *testing.T) {
+	t.Run("totals", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewDeltaToCumulative(h)
+		a := stats.T("a", "1")
+
+		for _, v := range []int{1, 2, 3} {
+			c.HandleMeasures(time.Now(), counter("requests", v), counter("requests", 10*v, a))
+		}
+
+		assert.Equal(t,
+			[]interface{}{int64(1), int64(10), int64(3), int64(30), int64(6), int64(60)},
+			counterValues(h.Measures()),
+		)
+	})
+
+	t.Run("sampled measures", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewDeltaToCumulative(h)
+		m := counter("requests", 1)
+		m.SampleRate = 0.25
+
+		c.HandleMeasures(time.Now(), m)
+		c.HandleMeasures(time.Now(), m)
+
+		measures := h.Measures()
+		assert.Equal(t, []interface{}{float64(4), float64(8)}, counterValues(measures))
+		assert.False(t, measures[1].Sampled())
+		assert.Equal(t, 0.25, m.SampleRate, "the input measures must not be modified")
+	})
+
+	t.Run("idle series expire", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := &stats.DeltaToCumulative{Handler: h, Expiration: 20 * time.Second}
+		now := time.Now()
+
+		c.HandleMeasures(now, counter("requests", 5))
+		c.HandleMeasures(now.Add(time.Minute), counter("other", 1))
+		c.HandleMeasures(now.Add(time.Minute), counter("requests", 2))
+
+		assert.Equal(t, []interface{}{int64(5), int64(1), int64(2)}, counterValues(h.Measures()))
+	})
+
+	t.Run("flush and close", func(t *testing.T) {
+		h := &statstest.Handler{}
+		c := stats.NewDeltaToCumulative(h)
+
+		c.Flush()
+		assert.NoError(t, c.Close())
+		assert.Equal(t, 2, h.FlushCalls())
+	})
+}
+
+func BenchmarkCumulativeToDelta(b *testing.B) {
+	c := stats.NewCumulativeToDelta(stats.Discard)
+	measures := []stats.Measure{
+		counter("gc", 1, stats.T("a", "1")),
+		counter("alloc", 1, stats.T("a", "1"), stats.T("b", "2")),
+	}
+	now := time.Now()
+
+	for b.Loop() {
+		c.HandleMeasures(now, measures...)
+	}
+}
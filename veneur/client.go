@@ -78,9 +78,10 @@ func NewClientWith(config ClientConfig) *Client {
 
 	return &Client{
 		Client: datadog.NewClientWith(datadog.ClientConfig{
-			Address:    config.Address,
-			BufferSize: config.BufferSize,
-			Filters:    config.Filters,
+			Address:      config.Address,
+			BufferSize:   config.BufferSize,
+			Filters:      config.Filters,
+			ErrorHandler: config.ErrorHandler,
 		}),
 		tags: tags,
 	}